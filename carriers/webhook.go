@@ -0,0 +1,30 @@
+package carriers
+
+import (
+	"errors"
+	"os"
+	"time"
+)
+
+// SignatureHeader carries the utils.SignBody signature of the body a carrier posts
+const SignatureHeader = "X-Carrier-Signature"
+
+// TrackingUpdate is what a carrier posts when a parcel it carries changes status
+type TrackingUpdate struct {
+	ID             string    `json:"id"`
+	Carrier        string    `json:"carrier"`
+	TrackingNumber string    `json:"tracking_number"`
+	Status         string    `json:"status"`
+	Description    string    `json:"description,omitempty"`
+	Location       string    `json:"location,omitempty"`
+	OccurredAt     time.Time `json:"occurred_at"`
+}
+
+// WebhookSecret returns the key shared with carriers for signing webhooks
+func WebhookSecret() ([]byte, error) {
+	secret := os.Getenv("CARRIER_WEBHOOK_SECRET")
+	if secret == "" {
+		return nil, errors.New("CARRIER_WEBHOOK_SECRET not set")
+	}
+	return []byte(secret), nil
+}
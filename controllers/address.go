@@ -6,8 +6,8 @@ import (
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/nerokome/econo/database"
 	"github.com/nerokome/econo/models"
-	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
@@ -31,13 +31,7 @@ func (app *Application) AddAddress() gin.HandlerFunc {
 		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 		defer cancel()
 
-		result, err := app.UserCollection.UpdateOne(
-			ctx,
-			bson.M{"user_id": userID},
-			bson.M{"$push": bson.M{"address_details": address}},
-		)
-
-		if err != nil || result.MatchedCount == 0 {
+		if err := app.Users.AddAddress(ctx, userID, address); err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to add address"})
 			return
 		}
@@ -71,23 +65,8 @@ func (app *Application) EditAddress() gin.HandlerFunc {
 		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 		defer cancel()
 
-		result, err := app.UserCollection.UpdateOne(
-			ctx,
-			bson.M{
-				"user_id":             userID,
-				"address_details._id": objID,
-			},
-			bson.M{
-				"$set": bson.M{
-					"address_details.$.street":  updated.Street,
-					"address_details.$.city":    updated.City,
-					"address_details.$.pincode": updated.Pincode,
-					"address_details.$.house":   updated.House,
-				},
-			},
-		)
-
-		if err != nil || result.MatchedCount == 0 {
+		updated.ID = objID
+		if err := app.Users.UpdateAddress(ctx, userID, updated); err != nil {
 			c.JSON(http.StatusNotFound, gin.H{"error": "address not found"})
 			return
 		}
@@ -114,15 +93,12 @@ func (app *Application) DeleteAddress() gin.HandlerFunc {
 		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 		defer cancel()
 
-		result, err := app.UserCollection.UpdateOne(
-			ctx,
-			bson.M{"user_id": userID},
-			bson.M{"$pull": bson.M{
-				"address_details": bson.M{"_id": objID},
-			}},
-		)
-
-		if err != nil || result.MatchedCount == 0 {
+		err = app.Users.DeleteAddress(ctx, userID, objID)
+		if err == database.ErrAddressNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "address not found"})
+			return
+		}
+		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to delete address"})
 			return
 		}
@@ -1,21 +1,75 @@
 package controllers
 
 import (
-	"go.mongodb.org/mongo-driver/mongo"
+	"errors"
+	"fmt"
+
+	"github.com/nerokome/econo/database"
+	"github.com/nerokome/econo/models"
+	"github.com/nerokome/econo/payments"
+)
+
+var (
+	errDatabase     = errors.New("database error")
+	errUserNotFound = errors.New("user not found")
+	errNonPositive  = errors.New("amount must be greater than zero")
+	errNegative     = errors.New("amount cannot be negative")
+	errTooLarge     = fmt.Errorf("amount cannot be more than %d minor units", models.MaxAmount)
 )
 
 // Application holds all shared dependencies for controllers
 type Application struct {
-	UserCollection *mongo.Collection
-	ProdCollection *mongo.Collection
+	Users       database.UserStore
+	Products    database.ProductStore
+	Orders      database.OrderStore
+	Coupons     database.CouponStore
+	TaxRules    database.TaxRuleStore
+	Shipping    database.ShippingRateStore
+	Shipments   database.ShipmentStore
+	Rates       database.ExchangeRateStore
+	Tokens      database.TokenStore
+	Events      database.EventStore
+	Idempotency database.IdempotencyStore
+	Payments    payments.Providers
 }
 
-func NewApplication(
-	userColl *mongo.Collection,
-	prodColl *mongo.Collection,
-) *Application {
+func NewApplication(stores database.Stores, providers payments.Providers) *Application {
 	return &Application{
-		UserCollection: userColl,
-		ProdCollection: prodColl,
+		Users:       stores.Users,
+		Products:    stores.Products,
+		Orders:      stores.Orders,
+		Coupons:     stores.Coupons,
+		TaxRules:    stores.TaxRules,
+		Shipping:    stores.Shipping,
+		Shipments:   stores.Shipments,
+		Rates:       stores.Rates,
+		Tokens:      stores.Tokens,
+		Events:      stores.Events,
+		Idempotency: stores.Idempotency,
+		Payments:    providers,
+	}
+}
+
+// storeAmount checks an amount sent by a client is in the store currency and no more
+// than models.MaxAmount, filling the currency in when it was left out. positive
+// rejects zero as well as negatives.
+func storeAmount(m *models.Money, positive bool) error {
+	base := models.BaseCurrency()
+	m.Currency = models.NormalizeCurrency(m.Currency)
+	if m.Currency == "" {
+		m.Currency = base
+	}
+	if m.Currency != base {
+		return fmt.Errorf("amounts must be in %s", base)
+	}
+	if positive && !m.IsPositive() {
+		return errNonPositive
+	}
+	if m.IsNegative() {
+		return errNegative
+	}
+	if m.Amount > models.MaxAmount {
+		return errTooLarge
 	}
+	return nil
 }
@@ -8,21 +8,30 @@ import (
 
 	"github.com/gin-gonic/gin"
 	"github.com/nerokome/econo/database"
+	"github.com/nerokome/econo/payments"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
-// AddToCart adds a product to a user's cart
+// AddToCart adds one unit of a product to the caller's cart
 func (app *Application) AddToCart() gin.HandlerFunc {
 	return func(c *gin.Context) {
 
+		// The cart always belongs to the authenticated user
+		userID, err := primitive.ObjectIDFromHex(c.GetString("user_id"))
+		if err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{
+				"error": "unauthorized",
+			})
+			return
+		}
+
 		// Read query params
 		productIDStr := c.Query("product_id")
-		userIDStr := c.Query("user_id")
 
 		// Validate input
-		if productIDStr == "" || userIDStr == "" {
+		if productIDStr == "" {
 			c.JSON(http.StatusBadRequest, gin.H{
-				"error": "product_id and user_id are required",
+				"error": "product_id is required",
 			})
 			return
 		}
@@ -36,15 +45,6 @@ func (app *Application) AddToCart() gin.HandlerFunc {
 			return
 		}
 
-		// Convert user ID
-		userID, err := primitive.ObjectIDFromHex(userIDStr)
-		if err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{
-				"error": "invalid user_id",
-			})
-			return
-		}
-
 		// Context with timeout
 		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 		defer cancel()
@@ -52,15 +52,15 @@ func (app *Application) AddToCart() gin.HandlerFunc {
 		// DB call
 		err = database.AddProductToCart(
 			ctx,
-			app.UserCollection,
-			app.ProdCollection,
-			productID,
+			app.Users,
+			app.Products,
 			userID,
+			productID,
 		)
 
 		if err != nil {
 			log.Println("AddToCart error:", err)
-			c.JSON(http.StatusInternalServerError, gin.H{
+			c.JSON(cartErrorStatus(err), gin.H{
 				"error": err.Error(),
 			})
 			return
@@ -72,38 +72,414 @@ func (app *Application) AddToCart() gin.HandlerFunc {
 	}
 }
 
-// RemoveItem removes a product from cart (stub)
+// SetCartItemQuantity sets how many units of a product are in the caller's cart
+func (app *Application) SetCartItemQuantity() gin.HandlerFunc {
+	return func(c *gin.Context) {
+
+		userID, productID, ok := cartRequestIDs(c)
+		if !ok {
+			return
+		}
+
+		var body struct {
+			Quantity *int `json:"quantity" binding:"required,gte=0"`
+		}
+		if err := c.ShouldBindJSON(&body); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": err.Error(),
+			})
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		err := database.SetCartQuantity(ctx, app.Users, app.Products, userID, productID, *body.Quantity)
+		if err != nil {
+			c.JSON(cartErrorStatus(err), gin.H{
+				"error": err.Error(),
+			})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"product_id": productID,
+			"quantity":   *body.Quantity,
+		})
+	}
+}
+
+// IncrementCartItem adds one unit of a product to the caller's cart
+func (app *Application) IncrementCartItem() gin.HandlerFunc {
+	return app.changeCartItem(1)
+}
+
+// DecrementCartItem takes one unit of a product out of the caller's cart
+func (app *Application) DecrementCartItem() gin.HandlerFunc {
+	return app.changeCartItem(-1)
+}
+
+func (app *Application) changeCartItem(delta int) gin.HandlerFunc {
+	return func(c *gin.Context) {
+
+		userID, productID, ok := cartRequestIDs(c)
+		if !ok {
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		quantity, err := database.ChangeCartQuantity(ctx, app.Users, app.Products, userID, productID, delta)
+		if err != nil {
+			c.JSON(cartErrorStatus(err), gin.H{
+				"error": err.Error(),
+			})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"product_id": productID,
+			"quantity":   quantity,
+		})
+	}
+}
+
+// cartRequestIDs reads the caller's user ID and the product_id path param,
+// writing an error response when either is unusable
+func cartRequestIDs(c *gin.Context) (primitive.ObjectID, primitive.ObjectID, bool) {
+	userID, err := primitive.ObjectIDFromHex(c.GetString("user_id"))
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"error": "unauthorized",
+		})
+		return primitive.NilObjectID, primitive.NilObjectID, false
+	}
+
+	productID, err := primitive.ObjectIDFromHex(c.Param("product_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "invalid product_id",
+		})
+		return primitive.NilObjectID, primitive.NilObjectID, false
+	}
+
+	return userID, productID, true
+}
+
+// cartErrorStatus maps cart errors to an HTTP status
+func cartErrorStatus(err error) int {
+	switch err {
+	case database.ErrProductNotFound, database.ErrProductNotInCart:
+		return http.StatusNotFound
+	case database.ErrQuantityLimitExceeded, database.ErrInvalidQuantity:
+		return http.StatusBadRequest
+	case database.ErrInsufficientQuantity:
+		return http.StatusConflict
+	case database.ErrOrderTooLarge:
+		return http.StatusUnprocessableEntity
+	}
+	return http.StatusInternalServerError
+}
+
+// orderErrorStatus maps checkout errors to an HTTP status
+func orderErrorStatus(err error) int {
+	switch err {
+	case database.ErrInvalidPaymentMode, database.ErrCartEmpty, database.ErrCartUnavailable,
+		database.ErrInvalidQuantity, database.ErrQuantityLimitExceeded, payments.ErrPaymentTokenMissing,
+		database.ErrInvalidShippingMethod, database.ErrShippingMethodRequired:
+		return http.StatusBadRequest
+	case database.ErrAddressNotFound, database.ErrProductNotFound:
+		return http.StatusNotFound
+	case database.ErrInsufficientQuantity, database.ErrProductNotPriced:
+		return http.StatusConflict
+	case database.ErrShippingUnavailable, database.ErrOrderTooLarge:
+		return http.StatusUnprocessableEntity
+	case payments.ErrPaymentDeclined, database.ErrPaymentFailed:
+		return http.StatusPaymentRequired
+	}
+	if status, ok := couponErrorStatus(err); ok {
+		return status
+	}
+	return http.StatusInternalServerError
+}
+
+// RemoveItem removes a product line from the caller's cart
 func (app *Application) RemoveItem() gin.HandlerFunc {
 	return func(c *gin.Context) {
-		c.JSON(http.StatusNotImplemented, gin.H{
-			"message": "RemoveItem not implemented",
+
+		userID, productID, ok := cartRequestIDs(c)
+		if !ok {
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		if err := database.RemoveProductFromCart(ctx, app.Users, userID, productID); err != nil {
+			log.Println("RemoveItem error:", err)
+			c.JSON(cartErrorStatus(err), gin.H{
+				"error": err.Error(),
+			})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"message": "product removed from cart",
+		})
+	}
+}
+
+// ClearCart empties the caller's cart
+func (app *Application) ClearCart() gin.HandlerFunc {
+	return func(c *gin.Context) {
+
+		userID, err := primitive.ObjectIDFromHex(c.GetString("user_id"))
+		if err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{
+				"error": "unauthorized",
+			})
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		if err := database.ClearCart(ctx, app.Users, userID); err != nil {
+			log.Println("ClearCart error:", err)
+			c.JSON(cartErrorStatus(err), gin.H{
+				"error": err.Error(),
+			})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"message": "cart cleared",
 		})
 	}
 }
 
-// GetItemFromCart returns cart items (stub)
+// GetItemFromCart returns the caller's cart with current prices and totals. Tax is
+// worked out for ?address_id=, defaulting to the caller's first saved address, and
+// the totals are repeated in the display currency if one was asked for.
 func (app *Application) GetItemFromCart() gin.HandlerFunc {
 	return func(c *gin.Context) {
-		c.JSON(http.StatusNotImplemented, gin.H{
-			"message": "GetItemFromCart not implemented",
+
+		userID, err := primitive.ObjectIDFromHex(c.GetString("user_id"))
+		if err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{
+				"error": "unauthorized",
+			})
+			return
+		}
+
+		var addressID primitive.ObjectID
+		if id := c.Query("address_id"); id != "" {
+			addressID, err = primitive.ObjectIDFromHex(id)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{
+					"error": "invalid address id",
+				})
+				return
+			}
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		rate, ok := app.displayRate(ctx, c)
+		if !ok {
+			return
+		}
+
+		summary, err := database.GetCartSummary(ctx, app.Users, app.Products, app.Coupons, app.TaxRules, userID, addressID, rate)
+		if err == database.ErrAddressNotFound {
+			c.JSON(http.StatusNotFound, gin.H{
+				"error": err.Error(),
+			})
+			return
+		}
+		if err == database.ErrOrderTooLarge || err == database.ErrConversionOverflow {
+			c.JSON(http.StatusUnprocessableEntity, gin.H{
+				"error": err.Error(),
+			})
+			return
+		}
+		if err != nil {
+			log.Println("GetItemFromCart error:", err)
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error": err.Error(),
+			})
+			return
+		}
+
+		c.JSON(http.StatusOK, summary)
+	}
+}
+
+// GetShippingOptions quotes the shipping methods available for the caller's cart
+// sent to their saved address ?address_id=
+func (app *Application) GetShippingOptions() gin.HandlerFunc {
+	return func(c *gin.Context) {
+
+		userID, err := primitive.ObjectIDFromHex(c.GetString("user_id"))
+		if err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{
+				"error": "unauthorized",
+			})
+			return
+		}
+
+		addressID, err := primitive.ObjectIDFromHex(c.Query("address_id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "invalid address_id",
+			})
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		options, err := database.CartShippingOptions(ctx, app.Users, app.Products, app.Coupons, app.Shipping, userID, addressID)
+		if err != nil {
+			log.Println("GetShippingOptions error:", err)
+			c.JSON(orderErrorStatus(err), gin.H{
+				"error": err.Error(),
+			})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"address_id":       addressID,
+			"shipping_options": options,
 		})
 	}
 }
 
-// BuyFromCart converts cart to order (stub)
+// BuyFromCart places an order for everything in the caller's cart, charged in the
+// display currency if one was asked for
 func (app *Application) BuyFromCart() gin.HandlerFunc {
 	return func(c *gin.Context) {
-		c.JSON(http.StatusNotImplemented, gin.H{
-			"message": "BuyFromCart not implemented",
+
+		userID, err := primitive.ObjectIDFromHex(c.GetString("user_id"))
+		if err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{
+				"error": "unauthorized",
+			})
+			return
+		}
+
+		var body struct {
+			AddressID      string `json:"address_id" binding:"required"`
+			PaymentMode    string `json:"payment_mode" binding:"required"`
+			ShippingMethod string `json:"shipping_method"`
+			PaymentToken   string `json:"payment_token"`
+		}
+		if err := c.ShouldBindJSON(&body); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": err.Error(),
+			})
+			return
+		}
+
+		addressID, err := primitive.ObjectIDFromHex(body.AddressID)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "invalid address_id",
+			})
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		rate, ok := app.displayRate(ctx, c)
+		if !ok {
+			return
+		}
+
+		order, err := database.BuyFromCart(ctx, app.Users, app.Products, app.Orders, app.Coupons, app.TaxRules, app.Shipping, app.Payments, userID, addressID, body.PaymentMode, body.ShippingMethod, body.PaymentToken, rate)
+		if err != nil {
+			log.Println("BuyFromCart error:", err)
+			c.JSON(orderErrorStatus(err), gin.H{
+				"error": err.Error(),
+			})
+			return
+		}
+
+		c.JSON(http.StatusCreated, gin.H{
+			"message": "order placed",
+			"order":   order,
 		})
 	}
 }
 
-// InstantBuy buys product directly (stub)
+// InstantBuy orders a single product straight away, leaving the cart alone. It is
+// charged in the display currency if one was asked for.
 func (app *Application) InstantBuy() gin.HandlerFunc {
 	return func(c *gin.Context) {
-		c.JSON(http.StatusNotImplemented, gin.H{
-			"message": "InstantBuy not implemented",
+
+		userID, err := primitive.ObjectIDFromHex(c.GetString("user_id"))
+		if err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{
+				"error": "unauthorized",
+			})
+			return
+		}
+
+		var body struct {
+			ProductID      string `json:"product_id" binding:"required"`
+			Quantity       int    `json:"quantity" binding:"required,gte=1"`
+			AddressID      string `json:"address_id" binding:"required"`
+			PaymentMode    string `json:"payment_mode" binding:"required"`
+			ShippingMethod string `json:"shipping_method"`
+			PaymentToken   string `json:"payment_token"`
+			CouponCode     string `json:"coupon_code"`
+		}
+		if err := c.ShouldBindJSON(&body); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": err.Error(),
+			})
+			return
+		}
+
+		productID, err := primitive.ObjectIDFromHex(body.ProductID)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "invalid product_id",
+			})
+			return
+		}
+
+		addressID, err := primitive.ObjectIDFromHex(body.AddressID)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "invalid address_id",
+			})
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		rate, ok := app.displayRate(ctx, c)
+		if !ok {
+			return
+		}
+
+		order, err := database.InstantBuy(ctx, app.Users, app.Products, app.Orders, app.Coupons, app.TaxRules, app.Shipping, app.Payments, userID, productID, body.Quantity, addressID, body.PaymentMode, body.ShippingMethod, body.PaymentToken, body.CouponCode, rate)
+		if err != nil {
+			log.Println("InstantBuy error:", err)
+			c.JSON(orderErrorStatus(err), gin.H{
+				"error": err.Error(),
+			})
+			return
+		}
+
+		c.JSON(http.StatusCreated, gin.H{
+			"message": "order placed",
+			"order":   order,
 		})
 	}
 }
@@ -6,13 +6,17 @@ import (
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/nerokome/econo/database"
 	"github.com/nerokome/econo/models"
+	"github.com/nerokome/econo/utils"
 	"golang.org/x/crypto/bcrypt"
 
-	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
+// maxSessions caps how many token pairs are kept per user; the oldest are dropped first
+const maxSessions = 10
+
 func HashPassword(password string) string {
 	hashed, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
 	if err != nil {
@@ -47,17 +51,18 @@ func (app *Application) SignUp() gin.HandlerFunc {
 			return
 		}
 
-		count, err := app.UserCollection.CountDocuments(ctx, bson.M{"email": user.Email})
-		if err != nil {
+		_, err := app.Users.FindByEmail(ctx, user.Email)
+		if err != nil && err != database.ErrUserNotFound {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "database error"})
 			return
 		}
-		if count > 0 {
+		if err == nil {
 			c.JSON(http.StatusBadRequest, gin.H{"error": "email already exists"})
 			return
 		}
 
 		user.Password = HashPassword(user.Password)
+		user.Role = models.RoleCustomer
 		user.ID = primitive.NewObjectID()
 		user.UserID = user.ID.Hex()
 		user.CreatedAt = time.Now()
@@ -65,11 +70,17 @@ func (app *Application) SignUp() gin.HandlerFunc {
 
 		user.Tokens = []string{}
 		user.RefreshTokens = []string{}
-		user.UserCart = []models.ProductUser{}
+		user.UserCart = []models.CartItem{}
 		user.AddressDetails = []models.Address{}
-		user.OrderStatus = []models.Order{}
+		user.OrderStatus = []primitive.ObjectID{}
 
-		if _, err := app.UserCollection.InsertOne(ctx, user); err != nil {
+		err = app.Users.Create(ctx, &user)
+		if err == database.ErrEmailTaken {
+			// Signed up at the same time by another request
+			c.JSON(http.StatusBadRequest, gin.H{"error": "email already exists"})
+			return
+		}
+		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "user creation failed"})
 			return
 		}
@@ -96,39 +107,34 @@ func (app *Application) Login() gin.HandlerFunc {
 			return
 		}
 
-		var user models.User
-		err := app.UserCollection.FindOne(ctx, bson.M{"email": creds.Email}).Decode(&user)
+		user, err := app.Users.FindByEmail(ctx, creds.Email)
 		if err != nil || !VerifyPassword(user.Password, creds.Password) {
 			c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid email or password"})
 			return
 		}
 
-		c.JSON(http.StatusOK, gin.H{
-			"message": "login successful",
-			"user":    user,
-		})
-	}
-}
-func (app *Application) ProductViewerAdmin() gin.HandlerFunc {
-	return func(c *gin.Context) {
-
-		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-		defer cancel()
-
-		cursor, err := app.ProdCollection.Find(ctx, bson.M{})
+		accessToken, refreshToken, err := utils.GenerateTokens(user.UserID, user.Email, user.EffectiveRole(), utils.NewTokenFamily())
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to fetch products"})
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to generate tokens"})
 			return
 		}
-		defer cursor.Close(ctx)
 
-		var products []models.Product
-		if err := cursor.All(ctx, &products); err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to decode products"})
+		if err := app.Users.AddSession(ctx, user.UserID, accessToken, refreshToken, maxSessions); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to store tokens"})
 			return
 		}
 
-		c.JSON(http.StatusOK, gin.H{"products": products})
+		// Never send credentials or other sessions back to the client
+		user.Password = ""
+		user.Tokens = nil
+		user.RefreshTokens = nil
+
+		c.JSON(http.StatusOK, gin.H{
+			"message":       "login successful",
+			"token":         accessToken,
+			"refresh_token": refreshToken,
+			"user":          user,
+		})
 	}
 }
 func (app *Application) SearchProduct() gin.HandlerFunc {
@@ -137,29 +143,18 @@ func (app *Application) SearchProduct() gin.HandlerFunc {
 		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 		defer cancel()
 
-		cursor, err := app.ProdCollection.Find(ctx, bson.M{})
+		rate, ok := app.displayRate(ctx, c)
+		if !ok {
+			return
+		}
+
+		products, err := app.Products.List(ctx, database.ProductFilter{})
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to fetch products"})
 			return
 		}
-		defer cursor.Close(ctx)
-
-		var products []models.ProductUser
-		for cursor.Next(ctx) {
-			var p models.Product
-			if err := cursor.Decode(&p); err != nil {
-				continue
-			}
-			products = append(products, models.ProductUser{
-				ID:       p.ID,
-				Name:     p.Name,
-				Price:    p.Price,
-				Rating:   p.Rating,
-				ImageURL: p.ImageURL,
-			})
-		}
 
-		c.JSON(http.StatusOK, gin.H{"products": products})
+		c.JSON(productsResponse(products, rate))
 	}
 }
 func (app *Application) SearchProductByQuery() gin.HandlerFunc {
@@ -174,32 +169,51 @@ func (app *Application) SearchProductByQuery() gin.HandlerFunc {
 		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 		defer cancel()
 
-		filter := bson.M{
-			"name": bson.M{"$regex": query, "$options": "i"},
+		rate, ok := app.displayRate(ctx, c)
+		if !ok {
+			return
 		}
 
-		cursor, err := app.ProdCollection.Find(ctx, filter)
+		products, err := app.Products.List(ctx, database.ProductFilter{Query: query})
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to search products"})
 			return
 		}
-		defer cursor.Close(ctx)
-
-		var products []models.ProductUser
-		for cursor.Next(ctx) {
-			var p models.Product
-			if err := cursor.Decode(&p); err != nil {
-				continue
-			}
-			products = append(products, models.ProductUser{
-				ID:       p.ID,
-				Name:     p.Name,
-				Price:    p.Price,
-				Rating:   p.Rating,
-				ImageURL: p.ImageURL,
-			})
+
+		c.JSON(productsResponse(products, rate))
+	}
+}
+
+// productsResponse lists products for customers, priced in the rate's currency
+// when there is one
+func productsResponse(products []models.Product, rate *models.ExchangeRate) (int, gin.H) {
+	out := toProductUsers(products)
+	if rate == nil {
+		return http.StatusOK, gin.H{"products": out}
+	}
+	for i := range out {
+		price, err := rate.CheckedConvert(out[i].Price)
+		if err != nil {
+			return http.StatusUnprocessableEntity, gin.H{"error": database.ErrConversionOverflow.Error()}
 		}
+		out[i].Price = price
+	}
+	return http.StatusOK, gin.H{"products": out, "exchange_rate": rate}
+}
 
-		c.JSON(http.StatusOK, gin.H{"products": products})
+// toProductUsers strips catalog-only fields from products shown to customers
+func toProductUsers(products []models.Product) []models.ProductUser {
+	var out []models.ProductUser
+	for _, p := range products {
+		out = append(out, models.ProductUser{
+			ID:          p.ID,
+			Name:        p.Name,
+			Price:       p.Price,
+			Rating:      p.Rating,
+			ImageURL:    p.ImageURL,
+			Category:    p.Category,
+			WeightGrams: p.WeightGrams,
+		})
 	}
+	return out
 }
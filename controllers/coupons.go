@@ -0,0 +1,284 @@
+package controllers
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/nerokome/econo/database"
+	"github.com/nerokome/econo/models"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type couponInput struct {
+	Code         string       `json:"code" binding:"required,min=3,max=40,alphanum"`
+	Description  string       `json:"description" binding:"max=500"`
+	Type         string       `json:"type" binding:"required,oneof=percentage fixed"`
+	Value        float64      `json:"value" binding:"gte=0,lte=100"`
+	Amount       models.Money `json:"amount"`
+	MaxDiscount  models.Money `json:"max_discount"`
+	MinCartValue models.Money `json:"min_cart_value"`
+	UsageLimit   int          `json:"usage_limit" binding:"gte=0"`
+	PerUserLimit int          `json:"per_user_limit" binding:"gte=0"`
+	StartsAt     *time.Time   `json:"starts_at"`
+	EndsAt       *time.Time   `json:"ends_at"`
+	ProductIDs   []string     `json:"product_ids" binding:"dive,len=24,hexadecimal"`
+	Categories   []string     `json:"categories" binding:"dive,min=1,max=100"`
+	Active       *bool        `json:"active"`
+}
+
+type couponPatch struct {
+	Description  *string    `json:"description" binding:"omitempty,max=500"`
+	Active       *bool      `json:"active"`
+	StartsAt     *time.Time `json:"starts_at"`
+	EndsAt       *time.Time `json:"ends_at"`
+	UsageLimit   *int       `json:"usage_limit" binding:"omitempty,gte=0"`
+	PerUserLimit *int       `json:"per_user_limit" binding:"omitempty,gte=0"`
+}
+
+// ListCoupons lists every coupon, newest first
+func (app *Application) ListCoupons() gin.HandlerFunc {
+	return func(c *gin.Context) {
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		coupons, err := app.Coupons.List(ctx)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to fetch coupons"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"coupons": coupons})
+	}
+}
+
+// CreateCoupon adds a coupon; it is active straight away unless active is false
+func (app *Application) CreateCoupon() gin.HandlerFunc {
+	return func(c *gin.Context) {
+
+		var input couponInput
+		if err := c.ShouldBindJSON(&input); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		switch input.Type {
+		case models.CouponPercentage:
+			if input.Value <= 0 || !input.Amount.IsZero() {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "percentage coupons take a value between 0 and 100 and no amount"})
+				return
+			}
+		case models.CouponFixed:
+			if input.Value != 0 || !input.MaxDiscount.IsZero() {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "fixed coupons take an amount, not a value or max_discount"})
+				return
+			}
+			if err := storeAmount(&input.Amount, true); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "amount: " + err.Error()})
+				return
+			}
+		}
+		if err := storeAmount(&input.MaxDiscount, false); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "max_discount: " + err.Error()})
+			return
+		}
+		if err := storeAmount(&input.MinCartValue, false); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "min_cart_value: " + err.Error()})
+			return
+		}
+		if !database.ValidCouponWindow(input.StartsAt, input.EndsAt) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": database.ErrCouponWindow.Error()})
+			return
+		}
+
+		productIDs := make([]primitive.ObjectID, 0, len(input.ProductIDs))
+		for _, id := range input.ProductIDs {
+			productID, err := primitive.ObjectIDFromHex(id)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "invalid product id"})
+				return
+			}
+			productIDs = append(productIDs, productID)
+		}
+
+		coupon := models.Coupon{
+			ID:           primitive.NewObjectID(),
+			Code:         models.NormalizeCouponCode(input.Code),
+			Description:  input.Description,
+			Type:         input.Type,
+			Value:        input.Value,
+			Amount:       input.Amount,
+			MaxDiscount:  input.MaxDiscount,
+			MinCartValue: input.MinCartValue,
+			UsageLimit:   input.UsageLimit,
+			PerUserLimit: input.PerUserLimit,
+			StartsAt:     input.StartsAt,
+			EndsAt:       input.EndsAt,
+			ProductIDs:   productIDs,
+			Categories:   input.Categories,
+			Active:       input.Active == nil || *input.Active,
+			CreatedAt:    time.Now(),
+			CreatedBy:    c.GetString("user_id"),
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		err := app.Coupons.Create(ctx, &coupon)
+		if err == database.ErrCouponCodeTaken {
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to create coupon"})
+			return
+		}
+
+		c.JSON(http.StatusCreated, gin.H{"coupon": coupon})
+	}
+}
+
+// UpdateCoupon changes a coupon's availability; its discount rules stay as they were
+// issued
+func (app *Application) UpdateCoupon() gin.HandlerFunc {
+	return func(c *gin.Context) {
+
+		couponID, err := primitive.ObjectIDFromHex(c.Param("coupon_id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid coupon id"})
+			return
+		}
+
+		var patch couponPatch
+		if err := c.ShouldBindJSON(&patch); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		if patch == (couponPatch{}) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "no fields to update"})
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		coupon, err := app.Coupons.Update(ctx, couponID, database.CouponUpdate{
+			Description:  patch.Description,
+			Active:       patch.Active,
+			StartsAt:     patch.StartsAt,
+			EndsAt:       patch.EndsAt,
+			UsageLimit:   patch.UsageLimit,
+			PerUserLimit: patch.PerUserLimit,
+		})
+		if err == database.ErrCouponNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "coupon not found"})
+			return
+		}
+		if err == database.ErrCouponWindow {
+			// Checked against the stored dates, since the patch may move only one end
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to update coupon"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"coupon": coupon})
+	}
+}
+
+// ApplyCartCoupon puts a coupon on the caller's cart
+func (app *Application) ApplyCartCoupon() gin.HandlerFunc {
+	return func(c *gin.Context) {
+
+		userID, err := primitive.ObjectIDFromHex(c.GetString("user_id"))
+		if err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{
+				"error": "unauthorized",
+			})
+			return
+		}
+
+		var body struct {
+			Code string `json:"code" binding:"required,max=40"`
+		}
+		if err := c.ShouldBindJSON(&body); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": err.Error(),
+			})
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		summary, err := database.ApplyCartCoupon(ctx, app.Users, app.Products, app.Coupons, app.TaxRules, userID, body.Code)
+		if err != nil {
+			status, ok := couponErrorStatus(err)
+			if !ok {
+				log.Println("ApplyCartCoupon error:", err)
+				status = http.StatusInternalServerError
+			}
+			if err == database.ErrCartEmpty {
+				status = http.StatusBadRequest
+			}
+			c.JSON(status, gin.H{
+				"error": err.Error(),
+			})
+			return
+		}
+
+		c.JSON(http.StatusOK, summary)
+	}
+}
+
+// RemoveCartCoupon takes the coupon off the caller's cart
+func (app *Application) RemoveCartCoupon() gin.HandlerFunc {
+	return func(c *gin.Context) {
+
+		userID, err := primitive.ObjectIDFromHex(c.GetString("user_id"))
+		if err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{
+				"error": "unauthorized",
+			})
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		if err := database.RemoveCartCoupon(ctx, app.Users, userID); err != nil {
+			log.Println("RemoveCartCoupon error:", err)
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error": err.Error(),
+			})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"message": "coupon removed",
+		})
+	}
+}
+
+// couponErrorStatus maps the reasons a coupon can't be used to an HTTP status
+func couponErrorStatus(err error) (int, bool) {
+	switch err {
+	case database.ErrCouponNotFound:
+		return http.StatusNotFound, true
+	case database.ErrCouponInactive,
+		database.ErrCouponExpired,
+		database.ErrCouponExhausted,
+		database.ErrCouponUserLimit,
+		database.ErrCouponMinCartValue,
+		database.ErrCouponNotApplicable,
+		database.ErrCouponCurrency:
+		return http.StatusUnprocessableEntity, true
+	}
+	return 0, false
+}
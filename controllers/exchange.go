@@ -0,0 +1,135 @@
+package controllers
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/nerokome/econo/database"
+	"github.com/nerokome/econo/middleware"
+	"github.com/nerokome/econo/models"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type exchangeRateInput struct {
+	Currency      string     `json:"currency" binding:"required,len=3,alpha"`
+	Rate          float64    `json:"rate" binding:"required,gt=0"`
+	EffectiveFrom *time.Time `json:"effective_from"`
+}
+
+// displayRate looks up the rate for the currency the client asked to see amounts
+// in, by ?currency= or else the X-Currency header, or nil for the store currency.
+// If that currency can't be used it writes the error response and reports false.
+func (app *Application) displayRate(ctx context.Context, c *gin.Context) (*models.ExchangeRate, bool) {
+	currency := c.Query("currency")
+	if currency == "" {
+		currency = c.GetHeader(middleware.CurrencyHeader)
+	}
+
+	rate, err := database.ExchangeRateFor(ctx, app.Rates, currency, time.Now())
+	switch err {
+	case nil:
+		return rate, true
+	case database.ErrInvalidCurrency:
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case database.ErrExchangeRateNotFound:
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to fetch exchange rate"})
+	}
+	return nil, false
+}
+
+// ListExchangeRates returns the whole exchange-rate table, latest rates first
+func (app *Application) ListExchangeRates() gin.HandlerFunc {
+	return func(c *gin.Context) {
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		rates, err := app.Rates.List(ctx)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to fetch exchange rates"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"base":           models.BaseCurrency(),
+			"exchange_rates": rates,
+		})
+	}
+}
+
+// CreateExchangeRate adds a rate from the store currency, taking effect at
+// effective_from or straight away
+func (app *Application) CreateExchangeRate() gin.HandlerFunc {
+	return func(c *gin.Context) {
+
+		var input exchangeRateInput
+		if err := c.ShouldBindJSON(&input); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		base := models.BaseCurrency()
+		currency := models.NormalizeCurrency(input.Currency)
+		if currency == base {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "currency is the store currency"})
+			return
+		}
+
+		now := time.Now()
+		effectiveFrom := now
+		if input.EffectiveFrom != nil {
+			effectiveFrom = *input.EffectiveFrom
+		}
+
+		rate := models.ExchangeRate{
+			ID:            primitive.NewObjectID(),
+			Base:          base,
+			Currency:      currency,
+			Rate:          input.Rate,
+			EffectiveFrom: effectiveFrom,
+			CreatedAt:     now,
+			CreatedBy:     c.GetString("user_id"),
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		if err := app.Rates.Create(ctx, &rate); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to create exchange rate"})
+			return
+		}
+
+		c.JSON(http.StatusCreated, gin.H{"exchange_rate": rate})
+	}
+}
+
+// DeleteExchangeRate withdraws a rate that has not taken effect yet
+func (app *Application) DeleteExchangeRate() gin.HandlerFunc {
+	return func(c *gin.Context) {
+
+		rateID, err := primitive.ObjectIDFromHex(c.Param("rate_id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid exchange rate id"})
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		err = app.Rates.Delete(ctx, rateID, time.Now())
+		switch err {
+		case nil:
+			c.JSON(http.StatusOK, gin.H{"message": "exchange rate deleted"})
+		case database.ErrExchangeRateNotFound:
+			c.JSON(http.StatusNotFound, gin.H{"error": "exchange rate not found"})
+		case database.ErrExchangeRateInUse:
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to delete exchange rate"})
+		}
+	}
+}
@@ -0,0 +1,81 @@
+package controllers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/nerokome/econo/database"
+	"github.com/nerokome/econo/middleware"
+	"github.com/nerokome/econo/models"
+	"github.com/nerokome/econo/payments"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestDisplayRate(t *testing.T) {
+	t.Setenv("STORE_CURRENCY", "INR")
+	gin.SetMode(gin.TestMode)
+
+	app := NewApplication(database.NewMemoryStores(), payments.NewLocalProviders())
+	for currency, rate := range map[string]float64{"USD": 0.012, "EUR": 0.011} {
+		err := app.Rates.Create(context.Background(), &models.ExchangeRate{
+			ID:            primitive.NewObjectID(),
+			Base:          "INR",
+			Currency:      currency,
+			Rate:          rate,
+			EffectiveFrom: time.Now().Add(-time.Hour),
+		})
+		if err != nil {
+			t.Fatalf("create rate: %v", err)
+		}
+	}
+
+	router := gin.New()
+	router.GET("/products", func(c *gin.Context) {
+		rate, ok := app.displayRate(c.Request.Context(), c)
+		if !ok {
+			return
+		}
+		currency := ""
+		if rate != nil {
+			currency = rate.Currency
+		}
+		c.JSON(http.StatusOK, gin.H{"currency": currency})
+	})
+
+	tests := []struct {
+		name         string
+		query        string
+		header       string
+		wantStatus   int
+		wantCurrency string
+	}{
+		{name: "store currency", wantStatus: http.StatusOK},
+		{name: "query", query: "usd", wantStatus: http.StatusOK, wantCurrency: "USD"},
+		{name: "header", header: "EUR", wantStatus: http.StatusOK, wantCurrency: "EUR"},
+		{name: "query over header", query: "USD", header: "EUR", wantStatus: http.StatusOK, wantCurrency: "USD"},
+		{name: "not a currency code", query: "dollars", wantStatus: http.StatusBadRequest},
+		{name: "no rate", header: "GBP", wantStatus: http.StatusUnprocessableEntity},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/products?currency="+tt.query, nil)
+			if tt.header != "" {
+				req.Header.Set(middleware.CurrencyHeader, tt.header)
+			}
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d (%s)", w.Code, tt.wantStatus, w.Body.String())
+			}
+			if tt.wantStatus == http.StatusOK && w.Body.String() != `{"currency":"`+tt.wantCurrency+`"}` {
+				t.Errorf("body = %s, want currency %q", w.Body.String(), tt.wantCurrency)
+			}
+		})
+	}
+}
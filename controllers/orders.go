@@ -0,0 +1,300 @@
+package controllers
+
+import (
+	"context"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/nerokome/econo/database"
+	"github.com/nerokome/econo/models"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// UpdateOrderStatus moves an order along its lifecycle. Shipping and delivery follow
+// the order's shipments, so those statuses can't be set by hand.
+func (app *Application) UpdateOrderStatus() gin.HandlerFunc {
+	return func(c *gin.Context) {
+
+		orderID, err := primitive.ObjectIDFromHex(c.Param("order_id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid order id"})
+			return
+		}
+
+		var body struct {
+			Status string `json:"status" binding:"required"`
+			Note   string `json:"note" binding:"max=500"`
+		}
+		if err := c.ShouldBindJSON(&body); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		if !models.ValidOrderStatus(body.Status) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "unknown order status"})
+			return
+		}
+		if models.Dispatched(body.Status) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "shipping statuses are set by the order's shipments"})
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		order, err := database.AdvanceOrderStatus(ctx, app.Orders, app.Payments, orderID, body.Status, c.GetString("user_id"), body.Note)
+		if err != nil {
+			c.JSON(orderStatusErrorStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"order": order})
+	}
+}
+
+const (
+	defaultOrdersPerPage = 20
+	maxOrdersPerPage     = 100
+)
+
+// ListOrders pages through the caller's order history, newest first.
+// Query params: page, limit, status, and from/to as RFC 3339 times or YYYY-MM-DD dates.
+func (app *Application) ListOrders() gin.HandlerFunc {
+	return func(c *gin.Context) {
+
+		page, err := strconv.ParseInt(c.DefaultQuery("page", "1"), 10, 64)
+		if err != nil || page < 1 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "page must be a positive number"})
+			return
+		}
+		limit, err := strconv.ParseInt(c.DefaultQuery("limit", strconv.Itoa(defaultOrdersPerPage)), 10, 64)
+		if err != nil || limit < 1 || limit > maxOrdersPerPage {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "limit must be between 1 and 100"})
+			return
+		}
+		// Keeps the offset below from overflowing
+		if page > math.MaxInt64/limit {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "page is too large"})
+			return
+		}
+
+		status := c.Query("status")
+		if status != "" && !models.ValidOrderStatus(status) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "unknown order status"})
+			return
+		}
+
+		from, err := parseOrderDate(c.Query("from"), false)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid from date"})
+			return
+		}
+		to, err := parseOrderDate(c.Query("to"), true)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid to date"})
+			return
+		}
+		if !from.IsZero() && !to.IsZero() && !from.Before(to) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "from must be before to"})
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		orders, total, err := app.Orders.ListByUser(ctx, c.GetString("user_id"), database.OrderFilter{
+			Status: status,
+			From:   from,
+			To:     to,
+			Skip:   (page - 1) * limit,
+			Limit:  limit,
+		})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to fetch orders"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"orders": orders,
+			"page":   page,
+			"limit":  limit,
+			"total":  total,
+		})
+	}
+}
+
+// GetOrder returns one of the caller's orders as it was placed
+func (app *Application) GetOrder() gin.HandlerFunc {
+	return func(c *gin.Context) {
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		order, ok := app.userOrder(ctx, c)
+		if !ok {
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"order": order})
+	}
+}
+
+// parseOrderDate reads an RFC 3339 time or a YYYY-MM-DD date. A bare date used as the
+// end of a range covers that whole day. An empty value gives the zero time.
+func parseOrderDate(value string, endOfRange bool) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	day, err := time.Parse(time.DateOnly, value)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if endOfRange {
+		day = day.AddDate(0, 0, 1)
+	}
+	return day, nil
+}
+
+// GetOrderStatus shows the caller where one of their orders is
+func (app *Application) GetOrderStatus() gin.HandlerFunc {
+	return func(c *gin.Context) {
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		order, ok := app.userOrder(ctx, c)
+		if !ok {
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"order_id":       order.ID,
+			"status":         order.Status,
+			"status_history": order.StatusHistory,
+		})
+	}
+}
+
+// CancelOrder lets the caller cancel one of their orders before it ships
+func (app *Application) CancelOrder() gin.HandlerFunc {
+	return func(c *gin.Context) {
+
+		var body struct {
+			Reason string `json:"reason" binding:"required,max=500"`
+		}
+		if err := c.ShouldBindJSON(&body); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		order, ok := app.userOrder(ctx, c)
+		if !ok {
+			return
+		}
+
+		order, err := database.CancelOrder(ctx, app.Orders, app.Payments, order.ID, c.GetString("user_id"), body.Reason)
+		if err != nil {
+			c.JSON(orderStatusErrorStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"order": order})
+	}
+}
+
+// RefundOrderLines refunds some of the units on a paid order
+func (app *Application) RefundOrderLines() gin.HandlerFunc {
+	return func(c *gin.Context) {
+
+		orderID, err := primitive.ObjectIDFromHex(c.Param("order_id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid order id"})
+			return
+		}
+
+		var body struct {
+			Lines []struct {
+				ProductID string `json:"product_id" binding:"required"`
+				Quantity  int    `json:"quantity" binding:"required,min=1"`
+			} `json:"lines" binding:"required,min=1,dive"`
+			Restock bool   `json:"restock"`
+			Reason  string `json:"reason" binding:"required,max=500"`
+		}
+		if err := c.ShouldBindJSON(&body); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		items := make([]database.RefundItem, 0, len(body.Lines))
+		for _, line := range body.Lines {
+			productID, err := primitive.ObjectIDFromHex(line.ProductID)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "invalid product id"})
+				return
+			}
+			items = append(items, database.RefundItem{ProductID: productID, Quantity: line.Quantity})
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		order, refund, err := database.RefundOrderLines(ctx, app.Orders, app.Shipments, app.Payments, orderID, items, body.Restock, c.GetString("user_id"), body.Reason)
+		if err != nil {
+			c.JSON(orderStatusErrorStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusCreated, gin.H{"refund": refund, "order": order})
+	}
+}
+
+// userOrder loads the order named by the order_id path param, answering 404 when
+// it doesn't exist or belongs to someone other than the caller
+func (app *Application) userOrder(ctx context.Context, c *gin.Context) (*models.Order, bool) {
+	orderID, err := primitive.ObjectIDFromHex(c.Param("order_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid order id"})
+		return nil, false
+	}
+
+	order, err := app.Orders.FindByID(ctx, orderID)
+	if err == database.ErrOrderNotFound || (err == nil && order.UserID != c.GetString("user_id")) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "order not found"})
+		return nil, false
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to fetch order"})
+		return nil, false
+	}
+
+	return order, true
+}
+
+// orderStatusErrorStatus maps order lifecycle errors to an HTTP status
+func orderStatusErrorStatus(err error) int {
+	switch err {
+	case database.ErrOrderNotFound:
+		return http.StatusNotFound
+	case database.ErrInvalidTransition,
+		database.ErrStatusChanged,
+		database.ErrOrderNotCancellable,
+		database.ErrPaymentNotCollected,
+		database.ErrNothingToRefund,
+		database.ErrRefundsChanged:
+		return http.StatusConflict
+	case database.ErrPaymentFailed:
+		return http.StatusPaymentRequired
+	case database.ErrProductNotInOrder, database.ErrRefundExceedsOrder, database.ErrInvalidQuantity:
+		return http.StatusBadRequest
+	}
+	return http.StatusInternalServerError
+}
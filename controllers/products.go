@@ -0,0 +1,218 @@
+package controllers
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/nerokome/econo/database"
+	"github.com/nerokome/econo/models"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type productInput struct {
+	Name        string       `json:"product_name" binding:"required,max=200"`
+	Price       models.Money `json:"price"`
+	Rating      uint8        `json:"rating" binding:"lte=5"`
+	ImageURL    string       `json:"image_url" binding:"omitempty,url"`
+	Category    string       `json:"category" binding:"max=100"`
+	MaxPerOrder int          `json:"max_per_order" binding:"gte=0"`
+	Stock       int          `json:"stock" binding:"gte=0"`
+	WeightGrams int          `json:"weight_grams" binding:"gte=0"`
+}
+
+// productPatch is a partial product update. An empty image_url removes the image.
+type productPatch struct {
+	Name        *string       `json:"product_name" binding:"omitempty,min=1,max=200"`
+	Price       *models.Money `json:"price"`
+	Rating      *uint8        `json:"rating" binding:"omitempty,lte=5"`
+	ImageURL    *string       `json:"image_url"`
+	Category    *string       `json:"category" binding:"omitempty,max=100"`
+	MaxPerOrder *int          `json:"max_per_order" binding:"omitempty,gte=0"`
+	Stock       *int          `json:"stock" binding:"omitempty,gte=0"`
+	WeightGrams *int          `json:"weight_grams" binding:"omitempty,gte=0"`
+}
+
+// validURL reports whether s is an absolute URL, like the url binding checks
+func validURL(s string) bool {
+	u, err := url.Parse(s)
+	return err == nil && u.Scheme != "" && u.Host != ""
+}
+
+// ListProductsAdmin lists the whole catalog, including soft-deleted products
+// when include_deleted=true
+func (app *Application) ListProductsAdmin() gin.HandlerFunc {
+	return func(c *gin.Context) {
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		products, err := app.Products.List(ctx, database.ProductFilter{
+			IncludeDeleted: c.Query("include_deleted") == "true",
+		})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to fetch products"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"products": products})
+	}
+}
+
+// CreateProduct adds a product to the catalog
+func (app *Application) CreateProduct() gin.HandlerFunc {
+	return func(c *gin.Context) {
+
+		var input productInput
+		if err := c.ShouldBindJSON(&input); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if err := storeAmount(&input.Price, true); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "price: " + err.Error()})
+			return
+		}
+
+		now := time.Now()
+		product := models.Product{
+			ID:          primitive.NewObjectID(),
+			Name:        input.Name,
+			Price:       input.Price,
+			Rating:      input.Rating,
+			ImageURL:    input.ImageURL,
+			Category:    input.Category,
+			MaxPerOrder: input.MaxPerOrder,
+			Stock:       input.Stock,
+			WeightGrams: input.WeightGrams,
+			CreatedAt:   now,
+			UpdatedAt:   now,
+			CreatedBy:   c.GetString("user_id"),
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		if err := app.Products.Create(ctx, &product); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to create product"})
+			return
+		}
+
+		c.JSON(http.StatusCreated, gin.H{"product": product})
+	}
+}
+
+// UpdateProduct applies a partial update to a product that hasn't been deleted
+func (app *Application) UpdateProduct() gin.HandlerFunc {
+	return func(c *gin.Context) {
+
+		productID, err := primitive.ObjectIDFromHex(c.Param("product_id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid product id"})
+			return
+		}
+
+		var patch productPatch
+		if err := c.ShouldBindJSON(&patch); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		if patch == (productPatch{}) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "no fields to update"})
+			return
+		}
+		if patch.Price != nil {
+			if err := storeAmount(patch.Price, true); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "price: " + err.Error()})
+				return
+			}
+		}
+		patch.ImageURL = trimmed(patch.ImageURL)
+		if patch.ImageURL != nil && *patch.ImageURL != "" && !validURL(*patch.ImageURL) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "image_url must be a URL, or empty to remove the image"})
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		product, err := app.Products.Update(ctx, productID, database.ProductUpdate{
+			Name:        patch.Name,
+			Price:       patch.Price,
+			Rating:      patch.Rating,
+			ImageURL:    patch.ImageURL,
+			Category:    patch.Category,
+			MaxPerOrder: patch.MaxPerOrder,
+			Stock:       patch.Stock,
+			WeightGrams: patch.WeightGrams,
+			UpdatedBy:   c.GetString("user_id"),
+		})
+
+		if err == database.ErrProductNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "product not found"})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to update product"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"product": product})
+	}
+}
+
+// DeleteProduct hides a product from the catalog without removing its document
+func (app *Application) DeleteProduct() gin.HandlerFunc {
+	return func(c *gin.Context) {
+
+		productID, err := primitive.ObjectIDFromHex(c.Param("product_id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid product id"})
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		err = app.Products.SoftDelete(ctx, productID, c.GetString("user_id"))
+		if err == database.ErrProductNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "product not found"})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to delete product"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"message": "product deleted"})
+	}
+}
+
+// RestoreProduct brings a soft-deleted product back into the catalog
+func (app *Application) RestoreProduct() gin.HandlerFunc {
+	return func(c *gin.Context) {
+
+		productID, err := primitive.ObjectIDFromHex(c.Param("product_id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid product id"})
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		err = app.Products.Restore(ctx, productID, c.GetString("user_id"))
+		if err == database.ErrProductNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "deleted product not found"})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to restore product"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"message": "product restored"})
+	}
+}
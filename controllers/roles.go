@@ -0,0 +1,143 @@
+package controllers
+
+import (
+	"context"
+	"crypto/subtle"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/nerokome/econo/database"
+	"github.com/nerokome/econo/models"
+)
+
+// BootstrapAdmin promotes the caller to admin when no admin exists yet.
+// The caller has to present ADMIN_BOOTSTRAP_SECRET, so an unset secret disables it.
+func (app *Application) BootstrapAdmin() gin.HandlerFunc {
+	return func(c *gin.Context) {
+
+		secret := os.Getenv("ADMIN_BOOTSTRAP_SECRET")
+		if secret == "" {
+			c.JSON(http.StatusForbidden, gin.H{"error": "admin bootstrap is disabled"})
+			return
+		}
+
+		var body struct {
+			Secret string `json:"secret" binding:"required"`
+		}
+		if err := c.ShouldBindJSON(&body); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		if subtle.ConstantTimeCompare([]byte(body.Secret), []byte(secret)) != 1 {
+			c.JSON(http.StatusForbidden, gin.H{"error": "invalid bootstrap secret"})
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		userID := c.GetString("user_id")
+		err := app.Users.PromoteFirstAdmin(ctx, userID)
+		if err == database.ErrAdminExists {
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+			return
+		}
+		if status, err := app.roleChanged(ctx, userID, err); err != nil {
+			c.JSON(status, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"message": "you are now an admin, please log in again"})
+	}
+}
+
+// GrantRole sets the role of another user
+func (app *Application) GrantRole() gin.HandlerFunc {
+	return func(c *gin.Context) {
+
+		var body struct {
+			Role string `json:"role" binding:"required"`
+		}
+		if err := c.ShouldBindJSON(&body); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		if !models.ValidRole(body.Role) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "role must be one of customer, staff or admin"})
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		if status, err := app.setRole(ctx, c.Param("user_id"), body.Role); err != nil {
+			c.JSON(status, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"message": "role updated"})
+	}
+}
+
+// RevokeRole drops another user back to customer
+func (app *Application) RevokeRole() gin.HandlerFunc {
+	return func(c *gin.Context) {
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		if status, err := app.setRole(ctx, c.Param("user_id"), models.RoleCustomer); err != nil {
+			c.JSON(status, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"message": "role revoked"})
+	}
+}
+
+// setRole changes a user's role and ends their sessions so tokens carrying the
+// old role stop working. It refuses to demote the last remaining admin.
+func (app *Application) setRole(ctx context.Context, userID, role string) (int, error) {
+	user, err := app.Users.FindByID(ctx, userID)
+	if err == database.ErrUserNotFound {
+		return http.StatusNotFound, errUserNotFound
+	}
+	if err != nil {
+		return http.StatusInternalServerError, errDatabase
+	}
+
+	if user.EffectiveRole() == role {
+		return http.StatusOK, nil
+	}
+
+	err = app.Users.SetRole(ctx, userID, role)
+	if err == database.ErrLastAdmin {
+		return http.StatusConflict, err
+	}
+	return app.roleChanged(ctx, userID, err)
+}
+
+// roleChanged ends the sessions of a user whose role change returned err, mapping
+// err to a status if the change failed
+func (app *Application) roleChanged(ctx context.Context, userID string, err error) (int, error) {
+	if err == database.ErrUserNotFound {
+		return http.StatusNotFound, errUserNotFound
+	}
+	if err != nil {
+		return http.StatusInternalServerError, errDatabase
+	}
+
+	user, err := app.Users.FindByID(ctx, userID)
+	if err != nil {
+		return http.StatusInternalServerError, errDatabase
+	}
+	if err := app.revokeAllSessions(ctx, user); err != nil {
+		return http.StatusInternalServerError, errDatabase
+	}
+
+	return http.StatusOK, nil
+}
@@ -0,0 +1,223 @@
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/nerokome/econo/carriers"
+	"github.com/nerokome/econo/database"
+	"github.com/nerokome/econo/models"
+	"github.com/nerokome/econo/utils"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type trackingEventInput struct {
+	Status      string     `json:"status" binding:"required"`
+	Description string     `json:"description" binding:"max=500"`
+	Location    string     `json:"location" binding:"max=200"`
+	At          *time.Time `json:"at"`
+}
+
+// CreateShipment hands some or all of what is left of a packed order to a carrier.
+// Without lines the shipment holds every unit not shipped yet.
+func (app *Application) CreateShipment() gin.HandlerFunc {
+	return func(c *gin.Context) {
+
+		orderID, err := primitive.ObjectIDFromHex(c.Param("order_id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid order id"})
+			return
+		}
+
+		var body struct {
+			Carrier        string `json:"carrier" binding:"required,max=100"`
+			TrackingNumber string `json:"tracking_number" binding:"required,max=100"`
+			Lines          []struct {
+				ProductID string `json:"product_id" binding:"required"`
+				Quantity  int    `json:"quantity" binding:"required,min=1"`
+			} `json:"lines" binding:"dive"`
+		}
+		if err := c.ShouldBindJSON(&body); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		lines := make([]models.ShipmentLine, 0, len(body.Lines))
+		for _, line := range body.Lines {
+			productID, err := primitive.ObjectIDFromHex(line.ProductID)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "invalid product id"})
+				return
+			}
+			lines = append(lines, models.ShipmentLine{ProductID: productID, Quantity: line.Quantity})
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		shipment, err := database.CreateShipment(ctx, app.Orders, app.Shipments, app.Payments, orderID, lines, body.Carrier, body.TrackingNumber, c.GetString("user_id"))
+		if err != nil {
+			c.JSON(shipmentErrorStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusCreated, gin.H{"shipment": shipment})
+	}
+}
+
+// ListOrderShipmentsAdmin lists the shipments of any order and what is still
+// waiting to ship
+func (app *Application) ListOrderShipmentsAdmin() gin.HandlerFunc {
+	return func(c *gin.Context) {
+
+		orderID, err := primitive.ObjectIDFromHex(c.Param("order_id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid order id"})
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		order, err := app.Orders.FindByID(ctx, orderID)
+		if err != nil {
+			c.JSON(orderStatusErrorStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(app.orderShipments(ctx, order))
+	}
+}
+
+// GetOrderShipments shows the caller where the parcels of one of their orders are
+func (app *Application) GetOrderShipments() gin.HandlerFunc {
+	return func(c *gin.Context) {
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		order, ok := app.userOrder(ctx, c)
+		if !ok {
+			return
+		}
+
+		c.JSON(app.orderShipments(ctx, order))
+	}
+}
+
+// orderShipments is the response listing an order's shipments
+func (app *Application) orderShipments(ctx context.Context, order *models.Order) (int, gin.H) {
+	shipments, err := app.Shipments.ListByOrder(ctx, order.ID)
+	if err != nil {
+		return http.StatusInternalServerError, gin.H{"error": "failed to fetch shipments"}
+	}
+
+	return http.StatusOK, gin.H{
+		"order_id":  order.ID,
+		"status":    order.Status,
+		"shipments": shipments,
+		"unshipped": order.UnshippedLines(shipments),
+	}
+}
+
+// AddTrackingEvent records a tracking event on a shipment by hand, e.g. for a
+// carrier without webhooks. A delivered event can complete the order.
+func (app *Application) AddTrackingEvent() gin.HandlerFunc {
+	return func(c *gin.Context) {
+
+		shipmentID, err := primitive.ObjectIDFromHex(c.Param("shipment_id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid shipment id"})
+			return
+		}
+
+		var input trackingEventInput
+		if err := c.ShouldBindJSON(&input); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		at := time.Now()
+		if input.At != nil {
+			at = *input.At
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		shipment, err := database.AddTrackingEvent(ctx, app.Orders, app.Shipments, app.Payments, shipmentID, models.TrackingEvent{
+			Status:      input.Status,
+			Description: input.Description,
+			Location:    input.Location,
+			At:          at,
+			By:          c.GetString("user_id"),
+		})
+		if err != nil {
+			c.JSON(shipmentErrorStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusCreated, gin.H{"shipment": shipment})
+	}
+}
+
+// CarrierWebhook receives tracking updates from carriers
+func (app *Application) CarrierWebhook() gin.HandlerFunc {
+	return func(c *gin.Context) {
+
+		body, err := c.GetRawData()
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "unable to read body"})
+			return
+		}
+
+		secret, err := carriers.WebhookSecret()
+		if err != nil {
+			log.Println("CarrierWebhook error:", err)
+			c.JSON(http.StatusServiceUnavailable, gin.H{"error": "webhooks are not configured"})
+			return
+		}
+		if !utils.VerifyBody(secret, body, c.GetHeader(carriers.SignatureHeader)) {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid signature"})
+			return
+		}
+
+		var update carriers.TrackingUpdate
+		if err := json.Unmarshal(body, &update); err != nil || update.ID == "" || update.Carrier == "" || update.TrackingNumber == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid event"})
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		if _, err := database.ApplyCarrierEvent(ctx, app.Orders, app.Shipments, app.Payments, update); err != nil {
+			status := shipmentErrorStatus(err)
+			if status == http.StatusInternalServerError {
+				log.Println("CarrierWebhook error:", err)
+			}
+			c.JSON(status, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"message": "event processed"})
+	}
+}
+
+// shipmentErrorStatus maps shipment errors to an HTTP status
+func shipmentErrorStatus(err error) int {
+	switch err {
+	case database.ErrShipmentNotFound:
+		return http.StatusNotFound
+	case database.ErrTrackingNumberTaken, database.ErrShipmentChanged, database.ErrShipmentsChanged,
+		database.ErrOrderNotShippable, database.ErrNothingToShip:
+		return http.StatusConflict
+	case database.ErrInvalidShipmentStatus, database.ErrShipmentExceedsOrder:
+		return http.StatusBadRequest
+	}
+	return orderStatusErrorStatus(err)
+}
@@ -0,0 +1,227 @@
+package controllers
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/nerokome/econo/database"
+	"github.com/nerokome/econo/models"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type shippingRateInput struct {
+	Method         string       `json:"method" binding:"required,oneof=standard express pickup"`
+	Name           string       `json:"name" binding:"required,max=100"`
+	Pincodes       []string     `json:"pincodes" binding:"dive,min=1,max=20"`
+	MinWeightGrams int          `json:"min_weight_grams" binding:"gte=0"`
+	MaxWeightGrams int          `json:"max_weight_grams" binding:"gte=0"`
+	MinCartValue   models.Money `json:"min_cart_value"`
+	Cost           models.Money `json:"cost"`
+	PerKg          models.Money `json:"per_kg"`
+	FreeAbove      models.Money `json:"free_above"`
+	EstimatedDays  int          `json:"estimated_days" binding:"gte=0"`
+	Active         *bool        `json:"active"`
+}
+
+type shippingRatePatch struct {
+	Method         *string       `json:"method" binding:"omitempty,oneof=standard express pickup"`
+	Name           *string       `json:"name" binding:"omitempty,min=1,max=100"`
+	Pincodes       *[]string     `json:"pincodes" binding:"omitempty,dive,min=1,max=20"`
+	MinWeightGrams *int          `json:"min_weight_grams" binding:"omitempty,gte=0"`
+	MaxWeightGrams *int          `json:"max_weight_grams" binding:"omitempty,gte=0"`
+	MinCartValue   *models.Money `json:"min_cart_value"`
+	Cost           *models.Money `json:"cost"`
+	PerKg          *models.Money `json:"per_kg"`
+	FreeAbove      *models.Money `json:"free_above"`
+	EstimatedDays  *int          `json:"estimated_days" binding:"omitempty,gte=0"`
+	Active         *bool         `json:"active"`
+}
+
+// shippingAmounts checks the amounts of a shipping rate are in the store currency,
+// naming the field at fault
+func shippingAmounts(amounts map[string]*models.Money) (string, error) {
+	for name, m := range amounts {
+		if m == nil {
+			continue
+		}
+		if err := storeAmount(m, false); err != nil {
+			return name + ": " + err.Error(), err
+		}
+	}
+	return "", nil
+}
+
+// trimmedPincodes trims the pincode prefixes of a zone, dropping blank ones
+func trimmedPincodes(pincodes []string) []string {
+	out := []string{}
+	for _, p := range pincodes {
+		if p = strings.TrimSpace(p); p != "" {
+			out = append(out, p)
+		}
+	}
+	return out
+}
+
+// ListShippingRates returns the whole shipping table, including inactive rates
+func (app *Application) ListShippingRates() gin.HandlerFunc {
+	return func(c *gin.Context) {
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		rates, err := app.Shipping.List(ctx)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to fetch shipping rates"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"shipping_rates": rates})
+	}
+}
+
+// CreateShippingRate adds a rate to the shipping table; it is active unless active is false
+func (app *Application) CreateShippingRate() gin.HandlerFunc {
+	return func(c *gin.Context) {
+
+		var input shippingRateInput
+		if err := c.ShouldBindJSON(&input); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if msg, err := shippingAmounts(map[string]*models.Money{
+			"min_cart_value": &input.MinCartValue,
+			"cost":           &input.Cost,
+			"per_kg":         &input.PerKg,
+			"free_above":     &input.FreeAbove,
+		}); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+			return
+		}
+		if input.MaxWeightGrams > 0 && input.MaxWeightGrams < input.MinWeightGrams {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "max_weight_grams is below min_weight_grams"})
+			return
+		}
+
+		rate := models.ShippingRate{
+			ID:             primitive.NewObjectID(),
+			Method:         input.Method,
+			Name:           strings.TrimSpace(input.Name),
+			Pincodes:       trimmedPincodes(input.Pincodes),
+			MinWeightGrams: input.MinWeightGrams,
+			MaxWeightGrams: input.MaxWeightGrams,
+			MinCartValue:   input.MinCartValue,
+			Cost:           input.Cost,
+			PerKg:          input.PerKg,
+			FreeAbove:      input.FreeAbove,
+			EstimatedDays:  input.EstimatedDays,
+			Active:         input.Active == nil || *input.Active,
+			CreatedAt:      time.Now(),
+			CreatedBy:      c.GetString("user_id"),
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		if err := app.Shipping.Create(ctx, &rate); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to create shipping rate"})
+			return
+		}
+
+		c.JSON(http.StatusCreated, gin.H{"shipping_rate": rate})
+	}
+}
+
+// UpdateShippingRate changes a shipping rate. Orders already placed keep the
+// shipping they were charged.
+func (app *Application) UpdateShippingRate() gin.HandlerFunc {
+	return func(c *gin.Context) {
+
+		rateID, err := primitive.ObjectIDFromHex(c.Param("rate_id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid shipping rate id"})
+			return
+		}
+
+		var patch shippingRatePatch
+		if err := c.ShouldBindJSON(&patch); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		if patch == (shippingRatePatch{}) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "no fields to update"})
+			return
+		}
+		if msg, err := shippingAmounts(map[string]*models.Money{
+			"min_cart_value": patch.MinCartValue,
+			"cost":           patch.Cost,
+			"per_kg":         patch.PerKg,
+			"free_above":     patch.FreeAbove,
+		}); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+			return
+		}
+		if patch.Pincodes != nil {
+			pincodes := trimmedPincodes(*patch.Pincodes)
+			patch.Pincodes = &pincodes
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		rate, err := app.Shipping.Update(ctx, rateID, database.ShippingRateUpdate{
+			Method:         patch.Method,
+			Name:           trimmed(patch.Name),
+			Pincodes:       patch.Pincodes,
+			MinWeightGrams: patch.MinWeightGrams,
+			MaxWeightGrams: patch.MaxWeightGrams,
+			MinCartValue:   patch.MinCartValue,
+			Cost:           patch.Cost,
+			PerKg:          patch.PerKg,
+			FreeAbove:      patch.FreeAbove,
+			EstimatedDays:  patch.EstimatedDays,
+			Active:         patch.Active,
+			UpdatedBy:      c.GetString("user_id"),
+		})
+		if err == database.ErrShippingRateNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "shipping rate not found"})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to update shipping rate"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"shipping_rate": rate})
+	}
+}
+
+// DeleteShippingRate removes a rate from the shipping table
+func (app *Application) DeleteShippingRate() gin.HandlerFunc {
+	return func(c *gin.Context) {
+
+		rateID, err := primitive.ObjectIDFromHex(c.Param("rate_id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid shipping rate id"})
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		err = app.Shipping.Delete(ctx, rateID)
+		if err == database.ErrShippingRateNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "shipping rate not found"})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to delete shipping rate"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"message": "shipping rate deleted"})
+	}
+}
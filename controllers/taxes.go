@@ -0,0 +1,168 @@
+package controllers
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/nerokome/econo/database"
+	"github.com/nerokome/econo/models"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type taxRuleInput struct {
+	Name      string  `json:"name" binding:"required,max=100"`
+	City      string  `json:"city" binding:"max=100"`
+	Pincode   string  `json:"pincode" binding:"max=20"`
+	Category  string  `json:"category" binding:"max=100"`
+	Rate      float64 `json:"rate" binding:"gte=0,lte=100"`
+	Inclusive bool    `json:"inclusive"`
+	Active    *bool   `json:"active"`
+}
+
+type taxRulePatch struct {
+	Name      *string  `json:"name" binding:"omitempty,min=1,max=100"`
+	City      *string  `json:"city" binding:"omitempty,max=100"`
+	Pincode   *string  `json:"pincode" binding:"omitempty,max=20"`
+	Category  *string  `json:"category" binding:"omitempty,max=100"`
+	Rate      *float64 `json:"rate" binding:"omitempty,gte=0,lte=100"`
+	Inclusive *bool    `json:"inclusive"`
+	Active    *bool    `json:"active"`
+}
+
+// trimmed trims a patched string field, leaving nil alone
+func trimmed(s *string) *string {
+	if s == nil {
+		return nil
+	}
+	t := strings.TrimSpace(*s)
+	return &t
+}
+
+// ListTaxRules returns the whole tax table, including inactive rules
+func (app *Application) ListTaxRules() gin.HandlerFunc {
+	return func(c *gin.Context) {
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		rules, err := app.TaxRules.List(ctx)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to fetch tax rules"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"tax_rules": rules})
+	}
+}
+
+// CreateTaxRule adds a rule to the tax table; it is active unless active is false
+func (app *Application) CreateTaxRule() gin.HandlerFunc {
+	return func(c *gin.Context) {
+
+		var input taxRuleInput
+		if err := c.ShouldBindJSON(&input); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		rule := models.TaxRule{
+			ID:        primitive.NewObjectID(),
+			Name:      strings.TrimSpace(input.Name),
+			City:      strings.TrimSpace(input.City),
+			Pincode:   strings.TrimSpace(input.Pincode),
+			Category:  strings.TrimSpace(input.Category),
+			Rate:      input.Rate,
+			Inclusive: input.Inclusive,
+			Active:    input.Active == nil || *input.Active,
+			CreatedAt: time.Now(),
+			CreatedBy: c.GetString("user_id"),
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		if err := app.TaxRules.Create(ctx, &rule); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to create tax rule"})
+			return
+		}
+
+		c.JSON(http.StatusCreated, gin.H{"tax_rule": rule})
+	}
+}
+
+// UpdateTaxRule changes a tax rule. Orders already placed keep the tax they were charged.
+func (app *Application) UpdateTaxRule() gin.HandlerFunc {
+	return func(c *gin.Context) {
+
+		ruleID, err := primitive.ObjectIDFromHex(c.Param("rule_id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid tax rule id"})
+			return
+		}
+
+		var patch taxRulePatch
+		if err := c.ShouldBindJSON(&patch); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		if patch == (taxRulePatch{}) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "no fields to update"})
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		rule, err := app.TaxRules.Update(ctx, ruleID, database.TaxRuleUpdate{
+			Name:      trimmed(patch.Name),
+			City:      trimmed(patch.City),
+			Pincode:   trimmed(patch.Pincode),
+			Category:  trimmed(patch.Category),
+			Rate:      patch.Rate,
+			Inclusive: patch.Inclusive,
+			Active:    patch.Active,
+			UpdatedBy: c.GetString("user_id"),
+		})
+		if err == database.ErrTaxRuleNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "tax rule not found"})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to update tax rule"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"tax_rule": rule})
+	}
+}
+
+// DeleteTaxRule removes a rule from the tax table
+func (app *Application) DeleteTaxRule() gin.HandlerFunc {
+	return func(c *gin.Context) {
+
+		ruleID, err := primitive.ObjectIDFromHex(c.Param("rule_id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid tax rule id"})
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		err = app.TaxRules.Delete(ctx, ruleID)
+		if err == database.ErrTaxRuleNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "tax rule not found"})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to delete tax rule"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"message": "tax rule deleted"})
+	}
+}
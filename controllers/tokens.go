@@ -0,0 +1,204 @@
+package controllers
+
+import (
+	"context"
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/nerokome/econo/database"
+	"github.com/nerokome/econo/models"
+	"github.com/nerokome/econo/utils"
+)
+
+// RefreshToken exchanges a refresh token for a new access/refresh pair.
+// The presented refresh token is rotated out and can't be used again.
+func (app *Application) RefreshToken() gin.HandlerFunc {
+	return func(c *gin.Context) {
+
+		var body struct {
+			RefreshToken string `json:"refresh_token" binding:"required"`
+		}
+		if err := c.ShouldBindJSON(&body); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		claims, err := utils.ValidateToken(body.RefreshToken)
+		if err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid or expired refresh token"})
+			return
+		}
+
+		userID, _ := claims["user_id"].(string)
+		family, _ := claims["family"].(string)
+		if tokenType, _ := claims["token_type"].(string); tokenType != utils.TokenTypeRefresh || userID == "" {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid or expired refresh token"})
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		jti, _ := claims["jti"].(string)
+		revoked, err := app.Tokens.IsRevoked(ctx, jti, userID, utils.TokenIssuedAt(claims))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to check token"})
+			return
+		}
+		if revoked {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "token has been revoked"})
+			return
+		}
+
+		user, err := app.Users.FindByID(ctx, userID)
+		if err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid or expired refresh token"})
+			return
+		}
+
+		// A correctly signed refresh token that we no longer hold has already been
+		// rotated, so someone is replaying it. Kill every session from that login.
+		if !slices.Contains(user.RefreshTokens, body.RefreshToken) {
+			if err := app.revokeTokenFamily(ctx, user, family); err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to revoke sessions"})
+				return
+			}
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "refresh token reuse detected"})
+			return
+		}
+
+		accessToken, refreshToken, err := utils.GenerateTokens(user.UserID, user.Email, user.EffectiveRole(), family)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to generate tokens"})
+			return
+		}
+
+		err = app.Users.RotateRefreshToken(ctx, user.UserID, body.RefreshToken, refreshToken, accessToken, maxSessions)
+		if err == database.ErrTokenNotFound {
+			// Lost a race with another rotation of the same token
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "refresh token reuse detected"})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to store tokens"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"token":         accessToken,
+			"refresh_token": refreshToken,
+		})
+	}
+}
+
+// Logout ends the session the caller's token belongs to
+func (app *Application) Logout() gin.HandlerFunc {
+	return func(c *gin.Context) {
+
+		userID := c.GetString("user_id")
+		family := c.GetString("token_family")
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		// The presented token may already have been trimmed from the user's list
+		if err := app.Tokens.Revoke(ctx, c.GetString("jti"), c.GetTime("token_exp")); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to revoke token"})
+			return
+		}
+
+		user, err := app.Users.FindByID(ctx, userID)
+		if err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+			return
+		}
+
+		if err := app.revokeTokenFamily(ctx, user, family); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to revoke session"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"message": "logged out"})
+	}
+}
+
+// LogoutAll ends every session of the caller, e.g. after an account compromise
+func (app *Application) LogoutAll() gin.HandlerFunc {
+	return func(c *gin.Context) {
+
+		userID := c.GetString("user_id")
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		if err := app.Tokens.Revoke(ctx, c.GetString("jti"), c.GetTime("token_exp")); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to revoke token"})
+			return
+		}
+
+		user, err := app.Users.FindByID(ctx, userID)
+		if err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+			return
+		}
+
+		if err := app.revokeAllSessions(ctx, user); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to revoke sessions"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"message": "logged out of all sessions"})
+	}
+}
+
+// revokeTokenFamily revokes every access and refresh token issued from the same login
+func (app *Application) revokeTokenFamily(ctx context.Context, user *models.User, family string) error {
+	return app.revokeSessions(ctx, user, func(claims jwt.MapClaims) bool {
+		tokenFamily, _ := claims["family"].(string)
+		return family == "" || tokenFamily == family
+	})
+}
+
+// revokeAllSessions revokes every token the user holds and clears both token lists.
+// Tokens already trimmed from the lists are caught by a cutoff on when they were issued.
+func (app *Application) revokeAllSessions(ctx context.Context, user *models.User) error {
+	if err := app.Tokens.RevokeIssuedBefore(ctx, user.UserID, time.Now(), time.Now().Add(utils.RefreshTokenTTL)); err != nil {
+		return err
+	}
+	return app.revokeSessions(ctx, user, func(jwt.MapClaims) bool { return true })
+}
+
+// revokeSessions puts the stored tokens selected by match on the revocation list
+// and removes them from the user document
+func (app *Application) revokeSessions(ctx context.Context, user *models.User, match func(jwt.MapClaims) bool) error {
+	revoke := func(tokens []string) ([]string, error) {
+		kept := []string{}
+		for _, t := range tokens {
+			claims := utils.UnverifiedClaims(t)
+			if claims != nil && !match(claims) {
+				kept = append(kept, t)
+				continue
+			}
+			if jti, _ := claims["jti"].(string); jti != "" {
+				if err := app.Tokens.Revoke(ctx, jti, utils.TokenExpiry(claims)); err != nil {
+					return nil, err
+				}
+			}
+		}
+		return kept, nil
+	}
+
+	tokens, err := revoke(user.Tokens)
+	if err != nil {
+		return err
+	}
+	refreshTokens, err := revoke(user.RefreshTokens)
+	if err != nil {
+		return err
+	}
+
+	return app.Users.SetSessions(ctx, user.UserID, tokens, refreshTokens)
+}
@@ -0,0 +1,170 @@
+package controllers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/nerokome/econo/database"
+	"github.com/nerokome/econo/middleware"
+	"github.com/nerokome/econo/payments"
+)
+
+// sessionRouter serves the signup, login and session endpoints from memory stores
+func sessionRouter(t *testing.T) *gin.Engine {
+	t.Helper()
+	t.Setenv("JWT_SECRET", "secret")
+	gin.SetMode(gin.TestMode)
+
+	app := NewApplication(database.NewMemoryStores(), payments.NewLocalProviders())
+	router := gin.New()
+	router.POST("/signup", app.SignUp())
+	router.POST("/login", app.Login())
+	router.POST("/refresh", app.RefreshToken())
+	protected := router.Group("/")
+	protected.Use(middleware.Authenticate(app.Tokens))
+	protected.GET("/me", func(c *gin.Context) { c.Status(http.StatusOK) })
+	protected.POST("/logout-all", app.LogoutAll())
+	return router
+}
+
+// call sends a JSON request and decodes the JSON response
+func call(router *gin.Engine, method, path, body, token string) (int, map[string]any) {
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	var resp map[string]any
+	json.Unmarshal(w.Body.Bytes(), &resp)
+	return w.Code, resp
+}
+
+// login signs up a customer on first use and returns a fresh token pair
+func login(t *testing.T, router *gin.Engine) (access, refresh string) {
+	t.Helper()
+
+	creds := `{"email":"a@example.com","password":"pw"}`
+	call(router, http.MethodPost, "/signup", creds, "")
+	status, resp := call(router, http.MethodPost, "/login", creds, "")
+	if status != http.StatusOK {
+		t.Fatalf("login = %d %v", status, resp)
+	}
+	access, _ = resp["token"].(string)
+	refresh, _ = resp["refresh_token"].(string)
+	return access, refresh
+}
+
+func refreshBody(token string) string {
+	return `{"refresh_token":"` + token + `"}`
+}
+
+func TestRefreshToken(t *testing.T) {
+	tests := []struct {
+		name string
+		// present picks the token sent to /refresh from a fresh login
+		present    func(access, refresh string) string
+		wantStatus int
+	}{
+		{
+			name:       "refresh token",
+			present:    func(access, refresh string) string { return refresh },
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "access token",
+			present:    func(access, refresh string) string { return access },
+			wantStatus: http.StatusUnauthorized,
+		},
+		{
+			name:       "not a token",
+			present:    func(access, refresh string) string { return "garbage" },
+			wantStatus: http.StatusUnauthorized,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			router := sessionRouter(t)
+			access, refresh := login(t, router)
+
+			status, resp := call(router, http.MethodPost, "/refresh", refreshBody(tt.present(access, refresh)), "")
+			if status != tt.wantStatus {
+				t.Fatalf("status = %d, want %d (%v)", status, tt.wantStatus, resp)
+			}
+			if status != http.StatusOK {
+				return
+			}
+
+			// The pair handed back works and the presented refresh token is used up
+			newAccess, _ := resp["token"].(string)
+			if status, _ := call(router, http.MethodGet, "/me", "", newAccess); status != http.StatusOK {
+				t.Errorf("new access token = %d, want %d", status, http.StatusOK)
+			}
+			if status, _ := call(router, http.MethodPost, "/refresh", refreshBody(refresh), ""); status != http.StatusUnauthorized {
+				t.Errorf("rotated refresh token = %d, want %d", status, http.StatusUnauthorized)
+			}
+		})
+	}
+}
+
+func TestRefreshTokenReuseRevokesFamily(t *testing.T) {
+	router := sessionRouter(t)
+	_, stolen := login(t, router)
+	otherAccess, otherRefresh := login(t, router)
+
+	status, resp := call(router, http.MethodPost, "/refresh", refreshBody(stolen), "")
+	if status != http.StatusOK {
+		t.Fatalf("first refresh = %d %v", status, resp)
+	}
+	access, _ := resp["token"].(string)
+	refresh, _ := resp["refresh_token"].(string)
+
+	// Replaying the rotated token ends every session from that login
+	if status, _ := call(router, http.MethodPost, "/refresh", refreshBody(stolen), ""); status != http.StatusUnauthorized {
+		t.Fatalf("replayed refresh = %d, want %d", status, http.StatusUnauthorized)
+	}
+	if status, _ := call(router, http.MethodGet, "/me", "", access); status != http.StatusUnauthorized {
+		t.Errorf("access token from the same login = %d, want %d", status, http.StatusUnauthorized)
+	}
+	if status, _ := call(router, http.MethodPost, "/refresh", refreshBody(refresh), ""); status != http.StatusUnauthorized {
+		t.Errorf("refresh token from the same login = %d, want %d", status, http.StatusUnauthorized)
+	}
+
+	// Other logins are left alone
+	if status, _ := call(router, http.MethodGet, "/me", "", otherAccess); status != http.StatusOK {
+		t.Errorf("access token from another login = %d, want %d", status, http.StatusOK)
+	}
+	if status, _ := call(router, http.MethodPost, "/refresh", refreshBody(otherRefresh), ""); status != http.StatusOK {
+		t.Errorf("refresh token from another login = %d, want %d", status, http.StatusOK)
+	}
+}
+
+func TestLogoutAll(t *testing.T) {
+	router := sessionRouter(t)
+	access, refresh := login(t, router)
+
+	if status, resp := call(router, http.MethodPost, "/logout-all", "", access); status != http.StatusOK {
+		t.Fatalf("logout all = %d %v", status, resp)
+	}
+	if status, _ := call(router, http.MethodGet, "/me", "", access); status != http.StatusUnauthorized {
+		t.Errorf("old access token = %d, want %d", status, http.StatusUnauthorized)
+	}
+	if status, _ := call(router, http.MethodPost, "/refresh", refreshBody(refresh), ""); status != http.StatusUnauthorized {
+		t.Errorf("old refresh token = %d, want %d", status, http.StatusUnauthorized)
+	}
+
+	// Logging straight back in, most likely within the second of the cutoff, works
+	access, refresh = login(t, router)
+	if status, _ := call(router, http.MethodGet, "/me", "", access); status != http.StatusOK {
+		t.Errorf("new access token = %d, want %d", status, http.StatusOK)
+	}
+	if status, _ := call(router, http.MethodPost, "/refresh", refreshBody(refresh), ""); status != http.StatusOK {
+		t.Errorf("new refresh token = %d, want %d", status, http.StatusOK)
+	}
+}
@@ -0,0 +1,75 @@
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/nerokome/econo/database"
+	"github.com/nerokome/econo/payments"
+	"github.com/nerokome/econo/utils"
+)
+
+// PaymentWebhook receives payment outcomes from the gateway
+func (app *Application) PaymentWebhook() gin.HandlerFunc {
+	return func(c *gin.Context) {
+
+		// The signature covers the exact bytes sent, so read them before any decoding
+		body, err := c.GetRawData()
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "unable to read body"})
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		status, response := app.handlePaymentWebhook(ctx, body, c.GetHeader(payments.SignatureHeader))
+		c.JSON(status, response)
+	}
+}
+
+// DeliverPaymentWebhook processes a webhook handed over in process, as the mock
+// gateway does, exactly as if it had been posted to PaymentWebhook
+func (app *Application) DeliverPaymentWebhook(ctx context.Context, body []byte, signature string) error {
+	status, response := app.handlePaymentWebhook(ctx, body, signature)
+	if status >= http.StatusMultipleChoices {
+		return fmt.Errorf("webhook rejected with status %d: %v", status, response["error"])
+	}
+	return nil
+}
+
+func (app *Application) handlePaymentWebhook(ctx context.Context, body []byte, signature string) (int, gin.H) {
+	secret, err := payments.WebhookSecret()
+	if err != nil {
+		log.Println("PaymentWebhook error:", err)
+		return http.StatusServiceUnavailable, gin.H{"error": "webhooks are not configured"}
+	}
+	if !utils.VerifyBody(secret, body, signature) {
+		return http.StatusUnauthorized, gin.H{"error": "invalid signature"}
+	}
+
+	var event payments.WebhookEvent
+	if err := json.Unmarshal(body, &event); err != nil || event.ID == "" || event.OrderID.IsZero() {
+		return http.StatusBadRequest, gin.H{"error": "invalid event"}
+	}
+
+	err = database.ApplyPaymentEvent(ctx, app.Orders, app.Events, app.Payments, event)
+	switch err {
+	case nil:
+		return http.StatusOK, gin.H{"message": "event processed"}
+	case database.ErrDuplicateEvent:
+		// Already handled; a 2xx stops the gateway from retrying
+		return http.StatusOK, gin.H{"message": "event already processed"}
+	case database.ErrOrderNotFound:
+		return http.StatusNotFound, gin.H{"error": err.Error()}
+	case database.ErrPaymentMismatch, database.ErrUnknownEventType:
+		return http.StatusBadRequest, gin.H{"error": err.Error()}
+	}
+	log.Println("PaymentWebhook error:", err)
+	return http.StatusInternalServerError, gin.H{"error": "failed to process event"}
+}
@@ -3,84 +3,122 @@ package database
 import (
 	"context"
 	"errors"
+	"time"
 
-	"go.mongodb.org/mongo-driver/bson"
+	"github.com/nerokome/econo/models"
 	"go.mongodb.org/mongo-driver/bson/primitive"
-	"go.mongodb.org/mongo-driver/mongo"
 )
 
 var (
-	ErrCantFindProduct      = errors.New("cannot find product")
-	ErrorCantDecodeProducts = errors.New("cannot decode products")
-	ErrProductNotFound      = errors.New("product not found")
-	ErrCartEmpty            = errors.New("cart is empty")
-	ErrInsufficientQuantity = errors.New("insufficient quantity")
-	ErrUnableToUpdateCart   = errors.New("unable to update cart")
-	ErrUnableToCreateOrder  = errors.New("unable to create order")
-	ErrOrderCreationFailed  = errors.New("order creation failed")
-	ErrInstantBuyFailed     = errors.New("instant buy failed")
-	ErrUserIdIsnotValid     = errors.New("user id is not valid")
+	ErrCantFindProduct       = errors.New("cannot find product")
+	ErrorCantDecodeProducts  = errors.New("cannot decode products")
+	ErrProductNotFound       = errors.New("product not found")
+	ErrCartEmpty             = errors.New("cart is empty")
+	ErrInsufficientQuantity  = errors.New("insufficient quantity")
+	ErrUnableToUpdateCart    = errors.New("unable to update cart")
+	ErrUnableToCreateOrder   = errors.New("unable to create order")
+	ErrOrderCreationFailed   = errors.New("order creation failed")
+	ErrInstantBuyFailed      = errors.New("instant buy failed")
+	ErrUserIdIsnotValid      = errors.New("user id is not valid")
+	ErrProductNotInCart      = errors.New("product is not in cart")
+	ErrQuantityLimitExceeded = errors.New("quantity exceeds the per-order limit")
+	ErrInvalidQuantity       = errors.New("invalid quantity")
+	ErrOrderTooLarge         = errors.New("order total is more than a single order can take")
 )
 
 /*
-AddProductToCart pushes a product ID into user's cart
+AddProductToCart puts one more unit of a product into user's cart
 */
 func AddProductToCart(
 	ctx context.Context,
-	userCollection *mongo.Collection,
-	productCollection *mongo.Collection,
+	users UserStore,
+	products ProductStore,
 	userID primitive.ObjectID,
 	productID primitive.ObjectID,
 ) error {
 
-	// Check product exists
-	count, err := productCollection.CountDocuments(
-		ctx,
-		bson.M{"_id": productID},
-	)
-	if err != nil || count == 0 {
-		return ErrProductNotFound
-	}
-
-	// Add product to cart (no duplicates)
-	result, err := userCollection.UpdateOne(
-		ctx,
-		bson.M{"_id": userID},
-		bson.M{
-			"$addToSet": bson.M{
-				"cart": productID,
-			},
-		},
-	)
-
-	if err != nil || result.MatchedCount == 0 {
-		return ErrUnableToUpdateCart
+	_, err := ChangeCartQuantity(ctx, users, products, userID, productID, 1)
+	return err
+}
+
+/*
+ChangeCartQuantity adds delta units of a product to user's cart, or removes them
+when delta is negative, and returns the line's new quantity
+*/
+func ChangeCartQuantity(
+	ctx context.Context,
+	users UserStore,
+	products ProductStore,
+	userID primitive.ObjectID,
+	productID primitive.ObjectID,
+	delta int,
+) (int, error) {
+
+	if delta < 0 {
+		// Removing units doesn't need the product to still be in the catalog
+		quantity, err := users.ChangeCartQuantity(ctx, userID.Hex(), models.CartItem{ProductID: productID}, delta, 0)
+		return quantity, cartError(err)
 	}
 
-	return nil
+	product, err := activeProduct(ctx, products, productID)
+	if err != nil {
+		return 0, err
+	}
+
+	quantity, err := users.ChangeCartQuantity(ctx, userID.Hex(), newCartItem(product), delta, product.Available())
+	if err == ErrQuantityLimitExceeded && product.Stock < product.QuantityLimit() {
+		// It was stock, not the per-order limit, that ran out
+		err = ErrInsufficientQuantity
+	}
+	return quantity, cartError(err)
 }
 
 /*
-RemoveProductFromCart removes a product from user's cart
+SetCartQuantity sets how many units of a product are in user's cart; zero removes the line
+*/
+func SetCartQuantity(
+	ctx context.Context,
+	users UserStore,
+	products ProductStore,
+	userID primitive.ObjectID,
+	productID primitive.ObjectID,
+	quantity int,
+) error {
+
+	if quantity < 0 {
+		return ErrInvalidQuantity
+	}
+	if quantity == 0 {
+		return RemoveProductFromCart(ctx, users, userID, productID)
+	}
+
+	product, err := activeProduct(ctx, products, productID)
+	if err != nil {
+		return err
+	}
+	if quantity > product.QuantityLimit() {
+		return ErrQuantityLimitExceeded
+	}
+	if quantity > product.Stock {
+		return ErrInsufficientQuantity
+	}
+
+	item := newCartItem(product)
+	item.Quantity = quantity
+	return cartError(users.SetCartQuantity(ctx, userID.Hex(), item))
+}
+
+/*
+RemoveProductFromCart removes a product line from user's cart
 */
 func RemoveProductFromCart(
 	ctx context.Context,
-	userCollection *mongo.Collection,
+	users UserStore,
 	userID primitive.ObjectID,
 	productID primitive.ObjectID,
 ) error {
 
-	result, err := userCollection.UpdateOne(
-		ctx,
-		bson.M{"_id": userID},
-		bson.M{
-			"$pull": bson.M{
-				"cart": productID,
-			},
-		},
-	)
-
-	if err != nil || result.MatchedCount == 0 {
+	if err := users.RemoveCartProduct(ctx, userID.Hex(), productID); err != nil {
 		return ErrUnableToUpdateCart
 	}
 
@@ -88,30 +126,229 @@ func RemoveProductFromCart(
 }
 
 /*
-GetUserCart returns product IDs in cart
+ClearCart removes every line from user's cart
 */
-func GetUserCart(
+func ClearCart(
 	ctx context.Context,
-	userCollection *mongo.Collection,
+	users UserStore,
 	userID primitive.ObjectID,
-) ([]primitive.ObjectID, error) {
+) error {
 
-	var user struct {
-		Cart []primitive.ObjectID `bson:"cart"`
+	if err := users.ClearCart(ctx, userID.Hex()); err != nil {
+		return ErrUnableToUpdateCart
 	}
 
-	err := userCollection.FindOne(
-		ctx,
-		bson.M{"_id": userID},
-	).Decode(&user)
+	return nil
+}
+
+/*
+GetUserCart returns the lines in cart
+*/
+func GetUserCart(
+	ctx context.Context,
+	users UserStore,
+	userID primitive.ObjectID,
+) ([]models.CartItem, error) {
 
+	cart, err := users.Cart(ctx, userID.Hex())
 	if err != nil {
 		return nil, ErrUserIdIsnotValid
 	}
 
-	if len(user.Cart) == 0 {
+	if len(cart) == 0 {
 		return nil, ErrCartEmpty
 	}
 
-	return user.Cart, nil
+	return cart, nil
+}
+
+// activeProduct loads a product that can still be bought
+func activeProduct(ctx context.Context, products ProductStore, productID primitive.ObjectID) (*models.Product, error) {
+	product, err := products.FindByID(ctx, productID)
+	if err != nil || product.DeletedAt != nil {
+		return nil, ErrProductNotFound
+	}
+	return product, nil
+}
+
+// newCartItem starts a cart line, remembering the price the product was added at
+func newCartItem(product *models.Product) models.CartItem {
+	return models.CartItem{
+		ProductID: product.ID,
+		UnitPrice: product.Price,
+		AddedAt:   time.Now(),
+	}
+}
+
+// cartError keeps the errors callers act on and folds the rest into ErrUnableToUpdateCart
+func cartError(err error) error {
+	switch err {
+	case nil, ErrQuantityLimitExceeded, ErrInsufficientQuantity, ErrProductNotInCart:
+		return err
+	}
+	return ErrUnableToUpdateCart
+}
+
+/*
+GetCartSummary resolves the cart against the catalog and totals it.
+Lines whose product was deleted or repriced since it was added are flagged.
+The cart's coupon, if any, is priced against the lines that can still be bought.
+Tax is worked out for the address addressID, or the user's first saved address
+when it is zero. A non-nil display rate adds the totals in its currency.
+*/
+func GetCartSummary(
+	ctx context.Context,
+	users UserStore,
+	products ProductStore,
+	coupons CouponStore,
+	taxRules TaxRuleStore,
+	userID primitive.ObjectID,
+	addressID primitive.ObjectID,
+	display *models.ExchangeRate,
+) (*models.CartSummary, error) {
+
+	summary, err := cartSummary(ctx, users, products, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	coupon, err := cartCoupon(ctx, users, coupons, userID)
+	switch {
+	case err == ErrCouponNotFound:
+		summary.CouponError = err.Error()
+	case err != nil:
+		return nil, err
+	case coupon != nil:
+		applied, err := EvaluateCoupon(coupon, userID.Hex(), purchasableLines(summary), time.Now())
+		if err != nil {
+			summary.CouponError = err.Error()
+			break
+		}
+		summary.Coupon = applied
+		summary.Discount = applied.Amount
+	}
+
+	address, err := taxAddress(ctx, users, userID, addressID)
+	if err != nil {
+		return nil, err
+	}
+	if address != nil {
+		rules, err := taxRules.List(ctx)
+		if err != nil {
+			return nil, err
+		}
+		var discounts []models.AppliedDiscount
+		if summary.Coupon != nil {
+			discounts = []models.AppliedDiscount{*summary.Coupon}
+		}
+		summary.TaxAddress = address
+		summary.Taxes = CalculateTax(rules, *address, purchasableLines(summary), discounts)
+		summary.Tax = totalTax(summary.Taxes)
+	}
+
+	summary.Payable = summary.Total.Sub(summary.Discount).Add(models.AddedTax(summary.Taxes))
+	if err := convertSummary(summary, display); err != nil {
+		return nil, err
+	}
+	return summary, nil
+}
+
+// taxAddress picks the address a cart is taxed for: addressID if set, else the
+// user's first saved address. It returns nil if the user has none.
+func taxAddress(ctx context.Context, users UserStore, userID, addressID primitive.ObjectID) (*models.Address, error) {
+	if !addressID.IsZero() {
+		return userAddress(ctx, users, userID, addressID)
+	}
+	user, err := users.FindByID(ctx, userID.Hex())
+	if err != nil {
+		return nil, ErrUserIdIsnotValid
+	}
+	if len(user.AddressDetails) == 0 {
+		return nil, nil
+	}
+	return &user.AddressDetails[0], nil
+}
+
+// cartSummary hydrates and totals the cart lines
+func cartSummary(
+	ctx context.Context,
+	users UserStore,
+	products ProductStore,
+	userID primitive.ObjectID,
+) (*models.CartSummary, error) {
+
+	zero := models.NewMoney(0, models.BaseCurrency())
+	summary := &models.CartSummary{
+		Items:    []models.CartLine{},
+		Total:    zero,
+		Discount: zero,
+		Tax:      zero,
+		Payable:  zero,
+	}
+
+	cart, err := GetUserCart(ctx, users, userID)
+	if err == ErrCartEmpty {
+		return summary, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	ids := make([]primitive.ObjectID, 0, len(cart))
+	for _, item := range cart {
+		ids = append(ids, item.ProductID)
+	}
+
+	found, err := products.FindByIDs(ctx, ids)
+	if err != nil {
+		return nil, ErrCantFindProduct
+	}
+	current := make(map[primitive.ObjectID]models.Product, len(found))
+	for _, p := range found {
+		current[p.ID] = p
+	}
+
+	for _, item := range cart {
+		line := models.CartLine{
+			Product:    models.ProductUser{ID: item.ProductID, Price: item.UnitPrice},
+			AddedPrice: item.UnitPrice,
+			Quantity:   item.Quantity,
+			AddedAt:    item.AddedAt,
+		}
+
+		p, ok := current[item.ProductID]
+		// A product priced before the store currency changed can't be sold until repriced
+		if !ok || p.DeletedAt != nil || p.Price.Currency != zero.Currency {
+			line.Unavailable = true
+			summary.Items = append(summary.Items, line)
+			continue
+		}
+
+		line.Product = models.ProductUser{
+			ID:          p.ID,
+			Name:        p.Name,
+			Price:       p.Price,
+			Rating:      p.Rating,
+			ImageURL:    p.ImageURL,
+			Category:    p.Category,
+			WeightGrams: p.WeightGrams,
+		}
+		line.MaxQuantity = p.Available()
+		line.PriceChanged = p.Price != item.UnitPrice
+		line.OutOfStock = line.Quantity > p.Stock
+		subtotal, err := p.Price.CheckedMul(int64(line.Quantity))
+		if err != nil {
+			return nil, ErrOrderTooLarge
+		}
+		line.Subtotal = subtotal
+
+		summary.Items = append(summary.Items, line)
+		summary.ItemCount += line.Quantity
+		summary.Total, err = summary.Total.CheckedAdd(line.Subtotal)
+		if err != nil || summary.Total.Amount > models.MaxAmount {
+			return nil, ErrOrderTooLarge
+		}
+	}
+
+	return summary, nil
 }
@@ -0,0 +1,144 @@
+package database
+
+import (
+	"context"
+	"testing"
+
+	"github.com/nerokome/econo/models"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestChangeCartQuantity(t *testing.T) {
+	tests := []struct {
+		name        string
+		stock       int
+		maxPerOrder int
+		start       int
+		delta       int
+		deleted     bool
+		want        int
+		wantErr     error
+	}{
+		{name: "add to empty cart", stock: 5, maxPerOrder: 3, delta: 2, want: 2},
+		{name: "add up to the limit", stock: 5, maxPerOrder: 3, start: 1, delta: 2, want: 3},
+		{name: "past the per-order limit", stock: 5, maxPerOrder: 3, start: 2, delta: 2, want: 2, wantErr: ErrQuantityLimitExceeded},
+		{name: "past the stock", stock: 2, maxPerOrder: 3, start: 1, delta: 2, want: 1, wantErr: ErrInsufficientQuantity},
+		{name: "remove some", stock: 5, maxPerOrder: 3, start: 3, delta: -2, want: 1},
+		{name: "remove the rest", stock: 5, maxPerOrder: 3, start: 1, delta: -1, want: 0},
+		{name: "remove what isn't there", stock: 5, maxPerOrder: 3, delta: -1, wantErr: ErrProductNotInCart},
+		{name: "deleted product", stock: 5, maxPerOrder: 3, delta: 1, deleted: true, wantErr: ErrProductNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			f := newFixture(t)
+			product := f.product(t, 500, tt.stock, tt.maxPerOrder)
+
+			if tt.start > 0 {
+				if _, err := ChangeCartQuantity(ctx, f.stores.Users, f.stores.Products, f.userID, product.ID, tt.start); err != nil {
+					t.Fatalf("fill cart: %v", err)
+				}
+			}
+			if tt.deleted {
+				if err := f.stores.Products.SoftDelete(ctx, product.ID, "admin"); err != nil {
+					t.Fatalf("delete product: %v", err)
+				}
+			}
+
+			_, err := ChangeCartQuantity(ctx, f.stores.Users, f.stores.Products, f.userID, product.ID, tt.delta)
+			if err != tt.wantErr {
+				t.Fatalf("err = %v, want %v", err, tt.wantErr)
+			}
+
+			cart, err := f.stores.Users.Cart(ctx, f.userID.Hex())
+			if err != nil {
+				t.Fatalf("cart: %v", err)
+			}
+			got := 0
+			for _, item := range cart {
+				if item.ProductID == product.ID {
+					got = item.Quantity
+				}
+			}
+			if got != tt.want {
+				t.Errorf("quantity = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSetCartQuantity(t *testing.T) {
+	tests := []struct {
+		name     string
+		quantity int
+		wantErr  error
+	}{
+		{name: "within limits", quantity: 3},
+		{name: "zero removes the line", quantity: 0},
+		{name: "negative", quantity: -1, wantErr: ErrInvalidQuantity},
+		{name: "past the per-order limit", quantity: 4, wantErr: ErrQuantityLimitExceeded},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			f := newFixture(t)
+			product := f.product(t, 500, 10, 3)
+			if _, err := ChangeCartQuantity(ctx, f.stores.Users, f.stores.Products, f.userID, product.ID, 1); err != nil {
+				t.Fatalf("fill cart: %v", err)
+			}
+
+			err := SetCartQuantity(ctx, f.stores.Users, f.stores.Products, f.userID, product.ID, tt.quantity)
+			if err != tt.wantErr {
+				t.Fatalf("err = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestGetCartSummary(t *testing.T) {
+	ctx := context.Background()
+	f := newFixture(t)
+	cheap := f.product(t, 500, 10, 5)
+	repriced := f.product(t, 1000, 10, 5)
+	deleted := f.product(t, 700, 10, 5)
+
+	for _, id := range []primitive.ObjectID{cheap.ID, repriced.ID, deleted.ID} {
+		if _, err := ChangeCartQuantity(ctx, f.stores.Users, f.stores.Products, f.userID, id, 2); err != nil {
+			t.Fatalf("fill cart: %v", err)
+		}
+	}
+	price := models.NewMoney(1200, models.BaseCurrency())
+	if _, err := f.stores.Products.Update(ctx, repriced.ID, ProductUpdate{Price: &price}); err != nil {
+		t.Fatalf("reprice: %v", err)
+	}
+	if err := f.stores.Products.SoftDelete(ctx, deleted.ID, "admin"); err != nil {
+		t.Fatalf("delete: %v", err)
+	}
+
+	summary, err := GetCartSummary(ctx, f.stores.Users, f.stores.Products, f.stores.Coupons, f.stores.TaxRules, f.userID, primitive.NilObjectID, nil)
+	if err != nil {
+		t.Fatalf("summary: %v", err)
+	}
+
+	if want := models.NewMoney(2*500+2*1200, models.BaseCurrency()); summary.Total != want {
+		t.Errorf("total = %v, want %v", summary.Total, want)
+	}
+	for _, line := range summary.Items {
+		switch line.Product.ID {
+		case repriced.ID:
+			if !line.PriceChanged {
+				t.Error("repriced line not flagged")
+			}
+		case deleted.ID:
+			if !line.Unavailable {
+				t.Error("deleted line not flagged")
+			}
+		case cheap.ID:
+			if line.PriceChanged || line.Unavailable {
+				t.Error("unchanged line flagged")
+			}
+		}
+	}
+}
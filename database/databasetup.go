@@ -44,3 +44,76 @@ func DBSet() *mongo.Client {
 func Collection(client *mongo.Client, name string) *mongo.Collection {
 	return client.Database("econo").Collection(name)
 }
+
+// NewMongoStores wires every store to its collection in the econo database
+func NewMongoStores(client *mongo.Client) Stores {
+	return Stores{
+		Users:    NewMongoUserStore(Collection(client, "users")),
+		Products: NewMongoProductStore(Collection(client, "products")),
+		Orders: NewMongoOrderStore(
+			Collection(client, "orders"),
+			Collection(client, "users"),
+			Collection(client, "products"),
+			Collection(client, "coupons"),
+		),
+		Coupons:     NewMongoCouponStore(Collection(client, "coupons")),
+		TaxRules:    NewMongoTaxRuleStore(Collection(client, "tax_rules")),
+		Shipping:    NewMongoShippingRateStore(Collection(client, "shipping_rates")),
+		Shipments:   NewMongoShipmentStore(Collection(client, "shipments")),
+		Rates:       NewMongoExchangeRateStore(Collection(client, "exchange_rates")),
+		Tokens:      NewMongoTokenStore(Collection(client, "revoked_tokens")),
+		Events:      NewMongoEventStore(Collection(client, "payment_events")),
+		Idempotency: NewMongoIdempotencyStore(Collection(client, "idempotency_keys")),
+	}
+}
+
+// EnsureMongoIndexes creates the indexes the Mongo stores rely on
+func EnsureMongoIndexes(ctx context.Context, client *mongo.Client) error {
+	if err := NewMongoUserStore(Collection(client, "users")).EnsureIndexes(ctx); err != nil {
+		return err
+	}
+	if err := NewMongoTokenStore(Collection(client, "revoked_tokens")).EnsureIndexes(ctx); err != nil {
+		return err
+	}
+	if err := NewMongoEventStore(Collection(client, "payment_events")).EnsureIndexes(ctx); err != nil {
+		return err
+	}
+	if err := NewMongoCouponStore(Collection(client, "coupons")).EnsureIndexes(ctx); err != nil {
+		return err
+	}
+	if err := NewMongoExchangeRateStore(Collection(client, "exchange_rates")).EnsureIndexes(ctx); err != nil {
+		return err
+	}
+	if err := NewMongoIdempotencyStore(Collection(client, "idempotency_keys")).EnsureIndexes(ctx); err != nil {
+		return err
+	}
+	if err := NewMongoShipmentStore(Collection(client, "shipments")).EnsureIndexes(ctx); err != nil {
+		return err
+	}
+	return NewMongoOrderStore(
+		Collection(client, "orders"),
+		Collection(client, "users"),
+		Collection(client, "products"),
+		Collection(client, "coupons"),
+	).EnsureIndexes(ctx)
+}
+
+// NewMemoryStores returns empty in-memory stores, so the app can run without MongoDB
+func NewMemoryStores() Stores {
+	users := NewMemoryUserStore()
+	products := NewMemoryProductStore()
+	coupons := NewMemoryCouponStore()
+	return Stores{
+		Users:       users,
+		Products:    products,
+		Orders:      NewMemoryOrderStore(users, products, coupons),
+		Coupons:     coupons,
+		TaxRules:    NewMemoryTaxRuleStore(),
+		Shipping:    NewMemoryShippingRateStore(),
+		Shipments:   NewMemoryShipmentStore(),
+		Rates:       NewMemoryExchangeRateStore(),
+		Tokens:      NewMemoryTokenStore(),
+		Events:      NewMemoryEventStore(),
+		Idempotency: NewMemoryIdempotencyStore(),
+	}
+}
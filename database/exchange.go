@@ -0,0 +1,61 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/nerokome/econo/models"
+)
+
+var (
+	ErrExchangeRateNotFound = errors.New("no exchange rate for this currency")
+	ErrExchangeRateInUse    = errors.New("exchange rate has already taken effect")
+	ErrInvalidCurrency      = errors.New("currency must be a three-letter ISO 4217 code")
+	ErrConversionOverflow   = errors.New("amounts are too large to show in this currency")
+)
+
+/*
+ExchangeRateFor returns the rate from the store currency to currency in effect at
+the given time, or nil when currency is the store currency or empty so amounts are
+shown as they are.
+*/
+func ExchangeRateFor(
+	ctx context.Context,
+	rates ExchangeRateStore,
+	currency string,
+	at time.Time,
+) (*models.ExchangeRate, error) {
+
+	currency = models.NormalizeCurrency(currency)
+	base := models.BaseCurrency()
+	if currency == "" || currency == base {
+		return nil, nil
+	}
+	if !models.ValidCurrency(currency) {
+		return nil, ErrInvalidCurrency
+	}
+	return rates.Effective(ctx, base, currency, at)
+}
+
+// convertSummary adds the cart's totals in the rate's currency
+func convertSummary(summary *models.CartSummary, rate *models.ExchangeRate) error {
+	if rate == nil {
+		return nil
+	}
+	display := &models.CurrencyTotals{ExchangeRate: *rate}
+	for _, m := range []struct{ from, to *models.Money }{
+		{&summary.Total, &display.Total},
+		{&summary.Discount, &display.Discount},
+		{&summary.Tax, &display.Tax},
+		{&summary.Payable, &display.Payable},
+	} {
+		converted, err := rate.CheckedConvert(*m.from)
+		if err != nil {
+			return ErrConversionOverflow
+		}
+		*m.to = converted
+	}
+	summary.Display = display
+	return nil
+}
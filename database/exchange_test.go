@@ -0,0 +1,81 @@
+package database
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/nerokome/econo/models"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestExchangeRateFor(t *testing.T) {
+	t.Setenv("STORE_CURRENCY", "INR")
+	ctx := context.Background()
+	now := time.Now()
+	day := 24 * time.Hour
+
+	rates := NewMemoryExchangeRateStore()
+	add := func(currency string, rate float64, effectiveFrom, createdAt time.Time) {
+		t.Helper()
+		err := rates.Create(ctx, &models.ExchangeRate{
+			ID:            primitive.NewObjectID(),
+			Base:          "INR",
+			Currency:      currency,
+			Rate:          rate,
+			EffectiveFrom: effectiveFrom,
+			CreatedAt:     createdAt,
+		})
+		if err != nil {
+			t.Fatalf("create rate: %v", err)
+		}
+	}
+	add("USD", 0.012, now.Add(-2*day), now.Add(-3*day))
+	add("USD", 0.0125, now.Add(-day), now.Add(-3*day))
+	// Entered again later for the same moment, correcting the one above
+	add("USD", 0.013, now.Add(-day), now.Add(-2*day))
+	add("USD", 0.014, now.Add(day), now.Add(-2*day))
+	add("EUR", 0.011, now.Add(-2*day), now.Add(-3*day))
+
+	tests := []struct {
+		name     string
+		currency string
+		at       time.Time
+		want     float64
+		wantNil  bool
+		wantErr  error
+	}{
+		{name: "latest in effect", currency: "USD", at: now, want: 0.013},
+		{name: "in effect earlier", currency: "USD", at: now.Add(-36 * time.Hour), want: 0.012},
+		{name: "from the moment it takes effect", currency: "USD", at: now.Add(-day), want: 0.013},
+		{name: "scheduled rate once it takes effect", currency: "USD", at: now.Add(2 * day), want: 0.014},
+		{name: "other currency", currency: "EUR", at: now, want: 0.011},
+		{name: "lower case code", currency: " usd", at: now, want: 0.013},
+		{name: "before any rate", currency: "USD", at: now.Add(-3 * day), wantErr: ErrExchangeRateNotFound},
+		{name: "currency without rates", currency: "GBP", at: now, wantErr: ErrExchangeRateNotFound},
+		{name: "not a currency code", currency: "US", at: now, wantErr: ErrInvalidCurrency},
+		{name: "store currency", currency: "INR", at: now, wantNil: true},
+		{name: "no currency", at: now, wantNil: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rate, err := ExchangeRateFor(ctx, rates, tt.currency, tt.at)
+			if err != tt.wantErr {
+				t.Fatalf("err = %v, want %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if tt.wantNil {
+				if rate != nil {
+					t.Errorf("rate = %v, want none", rate)
+				}
+				return
+			}
+			if rate == nil || rate.Rate != tt.want {
+				t.Errorf("rate = %v, want %v", rate, tt.want)
+			}
+		})
+	}
+}
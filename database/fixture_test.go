@@ -0,0 +1,113 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/nerokome/econo/models"
+	"github.com/nerokome/econo/payments"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// fixture is a customer with one saved address, backed by the memory stores
+type fixture struct {
+	stores    Stores
+	providers payments.Providers
+	userID    primitive.ObjectID
+	addressID primitive.ObjectID
+}
+
+func newFixture(t *testing.T) *fixture {
+	t.Helper()
+
+	stores := NewMemoryStores()
+	user := newUser(t, stores.Users)
+	return &fixture{
+		stores:    stores,
+		providers: payments.NewLocalProviders(),
+		userID:    user.ID,
+		addressID: user.AddressDetails[0].ID,
+	}
+}
+
+// product adds a product priced at price minor units of the store currency
+func (f *fixture) product(t *testing.T, price int64, stock, maxPerOrder int) *models.Product {
+	t.Helper()
+
+	product := &models.Product{
+		ID:          primitive.NewObjectID(),
+		Name:        "Product",
+		Price:       models.NewMoney(price, models.BaseCurrency()),
+		MaxPerOrder: maxPerOrder,
+		Stock:       stock,
+		CreatedAt:   time.Now(),
+	}
+	if err := f.stores.Products.Create(context.Background(), product); err != nil {
+		t.Fatalf("create product: %v", err)
+	}
+	return product
+}
+
+// stock returns the product's current stock
+func (f *fixture) stock(t *testing.T, productID primitive.ObjectID) int {
+	t.Helper()
+
+	product, err := f.stores.Products.FindByID(context.Background(), productID)
+	if err != nil {
+		t.Fatalf("find product: %v", err)
+	}
+	return product.Stock
+}
+
+// buy places an instant buy order for quantity units of product
+func (f *fixture) buy(productID primitive.ObjectID, quantity int, paymentMode, token string) (*models.Order, error) {
+	return InstantBuy(context.Background(), f.stores.Users, f.stores.Products, f.stores.Orders, f.stores.Coupons,
+		f.stores.TaxRules, f.stores.Shipping, f.providers, f.userID, productID, quantity, f.addressID,
+		paymentMode, "", token, "", nil)
+}
+
+// mustBuy places an order that is expected to succeed
+func (f *fixture) mustBuy(t *testing.T, productID primitive.ObjectID, quantity int, paymentMode, token string) *models.Order {
+	t.Helper()
+
+	order, err := f.buy(productID, quantity, paymentMode, token)
+	if err != nil {
+		t.Fatalf("buy: %v", err)
+	}
+	return order
+}
+
+// order reloads an order
+func (f *fixture) order(t *testing.T, orderID primitive.ObjectID) *models.Order {
+	t.Helper()
+
+	order, err := f.stores.Orders.FindByID(context.Background(), orderID)
+	if err != nil {
+		t.Fatalf("find order: %v", err)
+	}
+	return order
+}
+
+var errProviderDown = errors.New("provider unavailable")
+
+// flakyProvider turns refunds down while down is set
+type flakyProvider struct {
+	payments.PaymentProvider
+	down bool
+}
+
+func (p *flakyProvider) Refund(ctx context.Context, payment models.Payment, amount models.Money, key string) (string, error) {
+	if p.down {
+		return "", errProviderDown
+	}
+	return p.PaymentProvider.Refund(ctx, payment, amount, key)
+}
+
+// flakyDigital swaps the card gateway for one whose refunds can be turned off
+func (f *fixture) flakyDigital() *flakyProvider {
+	provider := &flakyProvider{PaymentProvider: f.providers[models.PaymentModeDigital]}
+	f.providers[models.PaymentModeDigital] = provider
+	return provider
+}
@@ -0,0 +1,156 @@
+package database
+
+import (
+	"context"
+	"maps"
+	"slices"
+	"sync"
+
+	"github.com/nerokome/econo/models"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// MemoryCouponStore is an in-process CouponStore for local runs and tests
+type MemoryCouponStore struct {
+	mu      sync.RWMutex
+	coupons map[primitive.ObjectID]*models.Coupon
+}
+
+func NewMemoryCouponStore() *MemoryCouponStore {
+	return &MemoryCouponStore{coupons: map[primitive.ObjectID]*models.Coupon{}}
+}
+
+func cloneCoupon(c models.Coupon) *models.Coupon {
+	c.Redemptions = maps.Clone(c.Redemptions)
+	c.ProductIDs = slices.Clone(c.ProductIDs)
+	c.Categories = slices.Clone(c.Categories)
+	return &c
+}
+
+func (s *MemoryCouponStore) Create(ctx context.Context, coupon *models.Coupon) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, c := range s.coupons {
+		if c.Code == coupon.Code {
+			return ErrCouponCodeTaken
+		}
+	}
+	s.coupons[coupon.ID] = cloneCoupon(*coupon)
+	return nil
+}
+
+func (s *MemoryCouponStore) FindByID(ctx context.Context, couponID primitive.ObjectID) (*models.Coupon, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	c, ok := s.coupons[couponID]
+	if !ok {
+		return nil, ErrCouponNotFound
+	}
+	return cloneCoupon(*c), nil
+}
+
+func (s *MemoryCouponStore) FindByCode(ctx context.Context, code string) (*models.Coupon, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, c := range s.coupons {
+		if c.Code == code {
+			return cloneCoupon(*c), nil
+		}
+	}
+	return nil, ErrCouponNotFound
+}
+
+func (s *MemoryCouponStore) List(ctx context.Context) ([]models.Coupon, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	coupons := []models.Coupon{}
+	for _, c := range s.coupons {
+		coupons = append(coupons, *cloneCoupon(*c))
+	}
+	// Newest first, matching the Mongo store
+	slices.SortFunc(coupons, func(a, b models.Coupon) int {
+		return b.CreatedAt.Compare(a.CreatedAt)
+	})
+	return coupons, nil
+}
+
+func (s *MemoryCouponStore) Update(ctx context.Context, couponID primitive.ObjectID, update CouponUpdate) (*models.Coupon, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	c, ok := s.coupons[couponID]
+	if !ok {
+		return nil, ErrCouponNotFound
+	}
+
+	startsAt, endsAt := c.StartsAt, c.EndsAt
+	if update.StartsAt != nil {
+		startsAt = update.StartsAt
+	}
+	if update.EndsAt != nil {
+		endsAt = update.EndsAt
+	}
+	if !ValidCouponWindow(startsAt, endsAt) {
+		return nil, ErrCouponWindow
+	}
+
+	if update.Description != nil {
+		c.Description = *update.Description
+	}
+	if update.Active != nil {
+		c.Active = *update.Active
+	}
+	if update.StartsAt != nil {
+		startsAt := *update.StartsAt
+		c.StartsAt = &startsAt
+	}
+	if update.EndsAt != nil {
+		endsAt := *update.EndsAt
+		c.EndsAt = &endsAt
+	}
+	if update.UsageLimit != nil {
+		c.UsageLimit = *update.UsageLimit
+	}
+	if update.PerUserLimit != nil {
+		c.PerUserLimit = *update.PerUserLimit
+	}
+	return cloneCoupon(*c), nil
+}
+
+func (s *MemoryCouponStore) Redeem(ctx context.Context, coupon *models.Coupon, userID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	c, ok := s.coupons[coupon.ID]
+	if !ok {
+		return ErrCouponNotFound
+	}
+	if c.UsageLimit > 0 && c.UsedCount >= c.UsageLimit {
+		return ErrCouponExhausted
+	}
+	if c.PerUserLimit > 0 && c.Redemptions[userID] >= c.PerUserLimit {
+		return ErrCouponUserLimit
+	}
+
+	if c.Redemptions == nil {
+		c.Redemptions = map[string]int{}
+	}
+	c.UsedCount++
+	c.Redemptions[userID]++
+	return nil
+}
+
+func (s *MemoryCouponStore) Unredeem(ctx context.Context, couponID primitive.ObjectID, userID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if c, ok := s.coupons[couponID]; ok {
+		c.UsedCount--
+		c.Redemptions[userID]--
+	}
+	return nil
+}
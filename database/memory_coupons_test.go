@@ -0,0 +1,71 @@
+package database
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/nerokome/econo/models"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestMemoryCouponStoreUpdateWindow(t *testing.T) {
+	startsAt := time.Now()
+	endsAt := startsAt.Add(24 * time.Hour)
+	at := func(d time.Duration) *time.Time {
+		v := startsAt.Add(d)
+		return &v
+	}
+
+	tests := []struct {
+		name    string
+		noEnd   bool
+		update  CouponUpdate
+		wantErr error
+	}{
+		{name: "later start", update: CouponUpdate{StartsAt: at(time.Hour)}},
+		{name: "start at the stored end", update: CouponUpdate{StartsAt: at(24 * time.Hour)}, wantErr: ErrCouponWindow},
+		{name: "end before the stored start", update: CouponUpdate{EndsAt: at(-time.Hour)}, wantErr: ErrCouponWindow},
+		{name: "both moved", update: CouponUpdate{StartsAt: at(48 * time.Hour), EndsAt: at(72 * time.Hour)}},
+		{name: "both inverted", update: CouponUpdate{StartsAt: at(72 * time.Hour), EndsAt: at(48 * time.Hour)}, wantErr: ErrCouponWindow},
+		{name: "start with no end", noEnd: true, update: CouponUpdate{StartsAt: at(48 * time.Hour)}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			coupons := NewMemoryCouponStore()
+			coupon := &models.Coupon{
+				ID:       primitive.NewObjectID(),
+				Code:     "SAVE10",
+				Type:     models.CouponPercentage,
+				Value:    10,
+				StartsAt: &startsAt,
+				EndsAt:   &endsAt,
+				Active:   true,
+			}
+			if tt.noEnd {
+				coupon.EndsAt = nil
+			}
+			if err := coupons.Create(ctx, coupon); err != nil {
+				t.Fatalf("create coupon: %v", err)
+			}
+
+			_, err := coupons.Update(ctx, coupon.ID, tt.update)
+			if err != tt.wantErr {
+				t.Fatalf("err = %v, want %v", err, tt.wantErr)
+			}
+
+			stored, err := coupons.FindByID(ctx, coupon.ID)
+			if err != nil {
+				t.Fatalf("find coupon: %v", err)
+			}
+			if !ValidCouponWindow(stored.StartsAt, stored.EndsAt) {
+				t.Errorf("stored window %v to %v is empty", stored.StartsAt, stored.EndsAt)
+			}
+			if tt.wantErr != nil && !stored.StartsAt.Equal(startsAt) {
+				t.Errorf("starts_at = %v, want it left at %v", stored.StartsAt, startsAt)
+			}
+		})
+	}
+}
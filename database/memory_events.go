@@ -0,0 +1,36 @@
+package database
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// MemoryEventStore is an in-process EventStore for local runs and tests
+type MemoryEventStore struct {
+	mu     sync.Mutex
+	events map[string]time.Time
+}
+
+func NewMemoryEventStore() *MemoryEventStore {
+	return &MemoryEventStore{events: map[string]time.Time{}}
+}
+
+func (s *MemoryEventStore) Claim(ctx context.Context, eventID string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if receivedAt, ok := s.events[eventID]; ok && time.Since(receivedAt) < EventRetention {
+		return false, nil
+	}
+	s.events[eventID] = time.Now()
+	return true, nil
+}
+
+func (s *MemoryEventStore) Release(ctx context.Context, eventID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.events, eventID)
+	return nil
+}
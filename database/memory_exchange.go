@@ -0,0 +1,82 @@
+package database
+
+import (
+	"cmp"
+	"context"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/nerokome/econo/models"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// MemoryExchangeRateStore is an in-process ExchangeRateStore for local runs and tests
+type MemoryExchangeRateStore struct {
+	mu    sync.RWMutex
+	rates map[primitive.ObjectID]models.ExchangeRate
+}
+
+func NewMemoryExchangeRateStore() *MemoryExchangeRateStore {
+	return &MemoryExchangeRateStore{rates: map[primitive.ObjectID]models.ExchangeRate{}}
+}
+
+func (s *MemoryExchangeRateStore) Create(ctx context.Context, rate *models.ExchangeRate) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.rates[rate.ID] = *rate
+	return nil
+}
+
+// sorted returns the rates in List order; callers hold the lock
+func (s *MemoryExchangeRateStore) sorted() []models.ExchangeRate {
+	rates := []models.ExchangeRate{}
+	for _, r := range s.rates {
+		rates = append(rates, r)
+	}
+	slices.SortFunc(rates, func(a, b models.ExchangeRate) int {
+		return cmp.Or(
+			strings.Compare(a.Base, b.Base),
+			strings.Compare(a.Currency, b.Currency),
+			b.EffectiveFrom.Compare(a.EffectiveFrom),
+			b.CreatedAt.Compare(a.CreatedAt),
+		)
+	})
+	return rates
+}
+
+func (s *MemoryExchangeRateStore) List(ctx context.Context) ([]models.ExchangeRate, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.sorted(), nil
+}
+
+func (s *MemoryExchangeRateStore) Effective(ctx context.Context, base, currency string, at time.Time) (*models.ExchangeRate, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, r := range s.sorted() {
+		if r.Base == base && r.Currency == currency && !r.EffectiveFrom.After(at) {
+			return &r, nil
+		}
+	}
+	return nil, ErrExchangeRateNotFound
+}
+
+func (s *MemoryExchangeRateStore) Delete(ctx context.Context, rateID primitive.ObjectID, now time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	r, ok := s.rates[rateID]
+	if !ok {
+		return ErrExchangeRateNotFound
+	}
+	if !r.EffectiveFrom.After(now) {
+		return ErrExchangeRateInUse
+	}
+	delete(s.rates, rateID)
+	return nil
+}
@@ -0,0 +1,62 @@
+package database
+
+import (
+	"context"
+	"slices"
+	"sync"
+	"time"
+)
+
+// MemoryIdempotencyStore is an in-process IdempotencyStore for local runs and tests
+type MemoryIdempotencyStore struct {
+	mu      sync.Mutex
+	records map[string]*IdempotencyRecord
+}
+
+func NewMemoryIdempotencyStore() *MemoryIdempotencyStore {
+	return &MemoryIdempotencyStore{records: map[string]*IdempotencyRecord{}}
+}
+
+func (s *MemoryIdempotencyStore) Reserve(ctx context.Context, key, requestHash string) (*IdempotencyRecord, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	// Same effect as the TTL index on the Mongo collection; a key whose request
+	// never finished is taken over once its lease runs out
+	if r, ok := s.records[key]; ok && now.Before(r.ExpiresAt) && (r.Status != 0 || now.Before(r.LockedUntil)) {
+		existing := *r
+		existing.Body = slices.Clone(r.Body)
+		return &existing, false, nil
+	}
+
+	record := &IdempotencyRecord{
+		Key:         key,
+		RequestHash: requestHash,
+		LockedUntil: now.Add(IdempotencyLease),
+		ExpiresAt:   now.Add(IdempotencyTTL),
+	}
+	s.records[key] = record
+	reserved := *record
+	return &reserved, true, nil
+}
+
+func (s *MemoryIdempotencyStore) Complete(ctx context.Context, key string, status int, contentType string, body []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if r, ok := s.records[key]; ok {
+		r.Status = status
+		r.ContentType = contentType
+		r.Body = slices.Clone(body)
+	}
+	return nil
+}
+
+func (s *MemoryIdempotencyStore) Release(ctx context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.records, key)
+	return nil
+}
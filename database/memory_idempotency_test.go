@@ -0,0 +1,50 @@
+package database
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestMemoryIdempotencyStoreReserve(t *testing.T) {
+	tests := []struct {
+		name         string
+		complete     bool
+		leaseExpired bool
+		wantReserved bool
+	}{
+		{name: "in progress", wantReserved: false},
+		{name: "completed", complete: true, wantReserved: false},
+		{name: "in progress past its lease", leaseExpired: true, wantReserved: true},
+		{name: "completed past the lease", complete: true, leaseExpired: true, wantReserved: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			store := NewMemoryIdempotencyStore()
+			if _, reserved, err := store.Reserve(ctx, "key", "hash"); err != nil || !reserved {
+				t.Fatalf("first reserve = %v, %v", reserved, err)
+			}
+			if tt.complete {
+				if err := store.Complete(ctx, "key", 201, "application/json", []byte(`{}`)); err != nil {
+					t.Fatalf("complete: %v", err)
+				}
+			}
+			if tt.leaseExpired {
+				store.records["key"].LockedUntil = time.Now().Add(-time.Second)
+			}
+
+			record, reserved, err := store.Reserve(ctx, "key", "hash")
+			if err != nil {
+				t.Fatalf("reserve: %v", err)
+			}
+			if reserved != tt.wantReserved {
+				t.Errorf("reserved = %v, want %v", reserved, tt.wantReserved)
+			}
+			if tt.complete && record.Status != 201 {
+				t.Errorf("status = %d, want the stored response", record.Status)
+			}
+		})
+	}
+}
@@ -0,0 +1,292 @@
+package database
+
+import (
+	"context"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/nerokome/econo/models"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// MemoryOrderStore is an in-process OrderStore for local runs and tests
+type MemoryOrderStore struct {
+	mu       sync.RWMutex
+	orders   map[primitive.ObjectID]*models.Order
+	users    *MemoryUserStore
+	products *MemoryProductStore
+	coupons  *MemoryCouponStore
+}
+
+func NewMemoryOrderStore(users *MemoryUserStore, products *MemoryProductStore, coupons *MemoryCouponStore) *MemoryOrderStore {
+	return &MemoryOrderStore{
+		orders:   map[primitive.ObjectID]*models.Order{},
+		users:    users,
+		products: products,
+		coupons:  coupons,
+	}
+}
+
+func cloneOrder(o models.Order) *models.Order {
+	o.OrderCart = slices.Clone(o.OrderCart)
+	o.StatusHistory = slices.Clone(o.StatusHistory)
+	o.Refunds = slices.Clone(o.Refunds)
+	o.Effects = slices.Clone(o.Effects)
+	return &o
+}
+
+// adjustStock moves each line's quantity out of (sign -1) or back into (sign 1) stock.
+// Callers must hold s.mu; lock order is orders, then products, then users, then coupons.
+func (s *MemoryOrderStore) adjustStock(lines []models.ProductUser, sign int) error {
+	s.products.mu.Lock()
+	defer s.products.mu.Unlock()
+
+	if sign < 0 {
+		for _, line := range lines {
+			p, ok := s.products.products[line.ID]
+			if !ok || p.DeletedAt != nil || p.Stock < line.Quantity {
+				return ErrInsufficientQuantity
+			}
+		}
+	}
+	for _, line := range lines {
+		if p, ok := s.products.products[line.ID]; ok {
+			p.Stock += sign * line.Quantity
+		}
+	}
+	return nil
+}
+
+func (s *MemoryOrderStore) PlaceOrder(ctx context.Context, order *models.Order, clearCart bool) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, err := s.users.FindByID(ctx, order.UserID); err != nil {
+		return err
+	}
+	if err := s.adjustStock(order.OrderCart, -1); err != nil {
+		return err
+	}
+
+	// Holding the order lock makes the order and the user update one step
+	err := s.users.modify(order.UserID, func(u *models.User) error {
+		u.OrderStatus = append(u.OrderStatus, order.ID)
+		if clearCart {
+			u.UserCart = []models.CartItem{}
+			u.CartCoupon = ""
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	s.orders[order.ID] = cloneOrder(*order)
+	return nil
+}
+
+func (s *MemoryOrderStore) ConfirmReservation(ctx context.Context, orderID primitive.ObjectID) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	o, ok := s.orders[orderID]
+	if !ok || o.Reservation.Status != models.ReservationHeld {
+		return ErrNotReserved
+	}
+	o.Reservation.Status = models.ReservationConfirmed
+	return nil
+}
+
+func (s *MemoryOrderStore) ReleaseReservation(ctx context.Context, orderID primitive.ObjectID) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	o, ok := s.orders[orderID]
+	if !ok || o.Reservation.Status == models.ReservationReleased {
+		return ErrNotReserved
+	}
+	o.Reservation.Status = models.ReservationReleased
+	return s.adjustStock(o.HeldLines(), 1)
+}
+
+func (s *MemoryOrderStore) ReturnCoupons(ctx context.Context, orderID primitive.ObjectID) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	o, ok := s.orders[orderID]
+	if !ok || o.Unredeemed {
+		return nil
+	}
+	o.Unredeemed = true
+	for _, d := range o.Discounts {
+		if err := s.coupons.Unredeem(ctx, d.CouponID, o.UserID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *MemoryOrderStore) ExpiredReservations(ctx context.Context, now time.Time) ([]primitive.ObjectID, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var ids []primitive.ObjectID
+	for id, o := range s.orders {
+		if o.Reservation.Status == models.ReservationHeld && o.Reservation.ExpiresAt.Before(now) {
+			ids = append(ids, id)
+		}
+	}
+	return ids, nil
+}
+
+func (s *MemoryOrderStore) FindByID(ctx context.Context, orderID primitive.ObjectID) (*models.Order, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	o, ok := s.orders[orderID]
+	if !ok {
+		return nil, ErrOrderNotFound
+	}
+	return cloneOrder(*o), nil
+}
+
+func (s *MemoryOrderStore) UpdateStatus(ctx context.Context, orderID primitive.ObjectID, from string, change models.OrderStatusChange, effects []string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	o, ok := s.orders[orderID]
+	if !ok || o.Status != from {
+		return ErrStatusChanged
+	}
+	o.Status = change.Status
+	o.StatusHistory = append(o.StatusHistory, change)
+	for _, effect := range effects {
+		if !slices.Contains(o.Effects, effect) {
+			o.Effects = append(o.Effects, effect)
+		}
+	}
+	return nil
+}
+
+func (s *MemoryOrderStore) ClearEffect(ctx context.Context, orderID primitive.ObjectID, effect string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	o, ok := s.orders[orderID]
+	if !ok {
+		return ErrOrderNotFound
+	}
+	o.Effects = slices.DeleteFunc(o.Effects, func(e string) bool { return e == effect })
+	return nil
+}
+
+func (s *MemoryOrderStore) PendingEffects(ctx context.Context) ([]primitive.ObjectID, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var ids []primitive.ObjectID
+	for id, o := range s.orders {
+		if len(o.Effects) > 0 {
+			ids = append(ids, id)
+		}
+	}
+	return ids, nil
+}
+
+func (s *MemoryOrderStore) SetPayment(ctx context.Context, orderID primitive.ObjectID, payment models.Payment) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	o, ok := s.orders[orderID]
+	if !ok {
+		return ErrOrderNotFound
+	}
+	o.Payment = payment
+	return nil
+}
+
+func (s *MemoryOrderStore) AddRefund(ctx context.Context, orderID primitive.ObjectID, known int, refund models.Refund) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	o, ok := s.orders[orderID]
+	if !ok {
+		return ErrOrderNotFound
+	}
+	restock := restockedLines(refund)
+	if len(o.Refunds) != known || (len(restock) > 0 && o.Reservation.Status == models.ReservationReleased) {
+		return ErrRefundsChanged
+	}
+
+	if err := s.adjustStock(restock, 1); err != nil {
+		return err
+	}
+	o.Refunds = append(o.Refunds, refund)
+	return nil
+}
+
+func (s *MemoryOrderStore) CompleteRefund(ctx context.Context, orderID, refundID primitive.ObjectID, reference string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	o, ok := s.orders[orderID]
+	if !ok {
+		return ErrOrderNotFound
+	}
+	for i := range o.Refunds {
+		if o.Refunds[i].ID == refundID {
+			o.Refunds[i].Status = models.RefundCompleted
+			o.Refunds[i].Reference = reference
+			return nil
+		}
+	}
+	return ErrRefundNotFound
+}
+
+func (s *MemoryOrderStore) PendingRefunds(ctx context.Context) ([]primitive.ObjectID, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var ids []primitive.ObjectID
+	for id, o := range s.orders {
+		if len(o.PendingRefunds()) > 0 {
+			ids = append(ids, id)
+		}
+	}
+	return ids, nil
+}
+
+func (s *MemoryOrderStore) ListByUser(ctx context.Context, userID string, filter OrderFilter) ([]models.Order, int64, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	orders := []models.Order{}
+	for _, o := range s.orders {
+		if o.UserID != userID {
+			continue
+		}
+		if filter.Status != "" && o.Status != filter.Status {
+			continue
+		}
+		if !filter.From.IsZero() && o.OrderedAt.Before(filter.From) {
+			continue
+		}
+		if !filter.To.IsZero() && !o.OrderedAt.Before(filter.To) {
+			continue
+		}
+		orders = append(orders, *cloneOrder(*o))
+	}
+	// Newest first, matching the Mongo store
+	slices.SortFunc(orders, func(a, b models.Order) int {
+		return b.OrderedAt.Compare(a.OrderedAt)
+	})
+
+	total := int64(len(orders))
+	start := min(filter.Skip, total)
+	end := total
+	if filter.Limit > 0 {
+		end = min(start+filter.Limit, total)
+	}
+	return orders[start:end], total, nil
+}
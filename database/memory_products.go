@@ -0,0 +1,155 @@
+package database
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/nerokome/econo/models"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// MemoryProductStore is an in-process ProductStore for local runs and tests
+type MemoryProductStore struct {
+	mu       sync.RWMutex
+	products map[primitive.ObjectID]*models.Product
+	// order keeps listings in insertion order like a fresh Mongo collection
+	order []primitive.ObjectID
+}
+
+func NewMemoryProductStore() *MemoryProductStore {
+	return &MemoryProductStore{products: map[primitive.ObjectID]*models.Product{}}
+}
+
+func cloneProduct(p models.Product) *models.Product {
+	if p.DeletedAt != nil {
+		deletedAt := *p.DeletedAt
+		p.DeletedAt = &deletedAt
+	}
+	return &p
+}
+
+func (s *MemoryProductStore) Create(ctx context.Context, product *models.Product) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.products[product.ID]; !ok {
+		s.order = append(s.order, product.ID)
+	}
+	s.products[product.ID] = cloneProduct(*product)
+	return nil
+}
+
+func (s *MemoryProductStore) FindByID(ctx context.Context, productID primitive.ObjectID) (*models.Product, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	p, ok := s.products[productID]
+	if !ok {
+		return nil, ErrProductNotFound
+	}
+	return cloneProduct(*p), nil
+}
+
+func (s *MemoryProductStore) FindByIDs(ctx context.Context, productIDs []primitive.ObjectID) ([]models.Product, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	products := []models.Product{}
+	for _, id := range productIDs {
+		if p, ok := s.products[id]; ok {
+			products = append(products, *cloneProduct(*p))
+		}
+	}
+	return products, nil
+}
+
+func (s *MemoryProductStore) List(ctx context.Context, filter ProductFilter) ([]models.Product, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	query := strings.ToLower(filter.Query)
+	products := []models.Product{}
+	for _, id := range s.order {
+		p := s.products[id]
+		if p.DeletedAt != nil && !filter.IncludeDeleted {
+			continue
+		}
+		if query != "" && !strings.Contains(strings.ToLower(p.Name), query) {
+			continue
+		}
+		products = append(products, *cloneProduct(*p))
+	}
+	return products, nil
+}
+
+func (s *MemoryProductStore) Update(ctx context.Context, productID primitive.ObjectID, update ProductUpdate) (*models.Product, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	p, ok := s.products[productID]
+	if !ok || p.DeletedAt != nil {
+		return nil, ErrProductNotFound
+	}
+
+	if update.Name != nil {
+		p.Name = *update.Name
+	}
+	if update.Price != nil {
+		p.Price = *update.Price
+	}
+	if update.Rating != nil {
+		p.Rating = *update.Rating
+	}
+	if update.ImageURL != nil {
+		p.ImageURL = *update.ImageURL
+	}
+	if update.Category != nil {
+		p.Category = *update.Category
+	}
+	if update.MaxPerOrder != nil {
+		p.MaxPerOrder = *update.MaxPerOrder
+	}
+	if update.WeightGrams != nil {
+		p.WeightGrams = *update.WeightGrams
+	}
+	if update.Stock != nil {
+		p.Stock = *update.Stock
+	}
+	p.UpdatedAt = time.Now()
+	p.UpdatedBy = update.UpdatedBy
+
+	return cloneProduct(*p), nil
+}
+
+func (s *MemoryProductStore) SoftDelete(ctx context.Context, productID primitive.ObjectID, deletedBy string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	p, ok := s.products[productID]
+	if !ok || p.DeletedAt != nil {
+		return ErrProductNotFound
+	}
+
+	now := time.Now()
+	p.DeletedAt = &now
+	p.UpdatedAt = now
+	p.UpdatedBy = deletedBy
+	return nil
+}
+
+func (s *MemoryProductStore) Restore(ctx context.Context, productID primitive.ObjectID, restoredBy string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	p, ok := s.products[productID]
+	if !ok || p.DeletedAt == nil {
+		return ErrProductNotFound
+	}
+
+	p.DeletedAt = nil
+	p.UpdatedAt = time.Now()
+	p.UpdatedBy = restoredBy
+	return nil
+}
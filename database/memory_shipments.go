@@ -0,0 +1,108 @@
+package database
+
+import (
+	"context"
+	"slices"
+	"sync"
+
+	"github.com/nerokome/econo/models"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// MemoryShipmentStore is an in-process ShipmentStore for local runs and tests
+type MemoryShipmentStore struct {
+	mu        sync.RWMutex
+	shipments map[primitive.ObjectID]*models.Shipment
+	// order keeps listings in creation order like the Mongo store
+	order []primitive.ObjectID
+}
+
+func NewMemoryShipmentStore() *MemoryShipmentStore {
+	return &MemoryShipmentStore{shipments: map[primitive.ObjectID]*models.Shipment{}}
+}
+
+func cloneShipment(s models.Shipment) *models.Shipment {
+	s.Events = slices.Clone(s.Events)
+	return &s
+}
+
+func (s *MemoryShipmentStore) Create(ctx context.Context, shipment *models.Shipment) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, existing := range s.shipments {
+		if existing.OrderID == shipment.OrderID && existing.Sequence == shipment.Sequence {
+			return ErrShipmentsChanged
+		}
+		if existing.Carrier == shipment.Carrier && existing.TrackingNumber == shipment.TrackingNumber {
+			return ErrTrackingNumberTaken
+		}
+	}
+	s.shipments[shipment.ID] = cloneShipment(*shipment)
+	s.order = append(s.order, shipment.ID)
+	return nil
+}
+
+func (s *MemoryShipmentStore) FindByID(ctx context.Context, shipmentID primitive.ObjectID) (*models.Shipment, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	shipment, ok := s.shipments[shipmentID]
+	if !ok {
+		return nil, ErrShipmentNotFound
+	}
+	return cloneShipment(*shipment), nil
+}
+
+func (s *MemoryShipmentStore) FindByTracking(ctx context.Context, carrier, trackingNumber string) (*models.Shipment, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, shipment := range s.shipments {
+		if shipment.Carrier == carrier && shipment.TrackingNumber == trackingNumber {
+			return cloneShipment(*shipment), nil
+		}
+	}
+	return nil, ErrShipmentNotFound
+}
+
+func (s *MemoryShipmentStore) ListByOrder(ctx context.Context, orderID primitive.ObjectID) ([]models.Shipment, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	shipments := []models.Shipment{}
+	for _, id := range s.order {
+		if shipment := s.shipments[id]; shipment.OrderID == orderID {
+			shipments = append(shipments, *cloneShipment(*shipment))
+		}
+	}
+	return shipments, nil
+}
+
+func (s *MemoryShipmentStore) AddEvent(ctx context.Context, shipmentID primitive.ObjectID, known int, event models.TrackingEvent, status string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	shipment, ok := s.shipments[shipmentID]
+	if !ok {
+		return ErrShipmentNotFound
+	}
+	if len(shipment.Events) != known {
+		return ErrShipmentChanged
+	}
+	shipment.Events = append(shipment.Events, event)
+	shipment.Status = status
+	return nil
+}
+
+func (s *MemoryShipmentStore) Delete(ctx context.Context, shipmentID primitive.ObjectID) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.shipments[shipmentID]; !ok {
+		return ErrShipmentNotFound
+	}
+	delete(s.shipments, shipmentID)
+	s.order = slices.DeleteFunc(s.order, func(id primitive.ObjectID) bool { return id == shipmentID })
+	return nil
+}
@@ -0,0 +1,115 @@
+package database
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/nerokome/econo/models"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// MemoryShippingRateStore is an in-process ShippingRateStore for local runs and tests
+type MemoryShippingRateStore struct {
+	mu    sync.RWMutex
+	rates map[primitive.ObjectID]*models.ShippingRate
+	// order keeps listings in insertion order like the Mongo store
+	order []primitive.ObjectID
+}
+
+func NewMemoryShippingRateStore() *MemoryShippingRateStore {
+	return &MemoryShippingRateStore{rates: map[primitive.ObjectID]*models.ShippingRate{}}
+}
+
+func (s *MemoryShippingRateStore) Create(ctx context.Context, rate *models.ShippingRate) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.rates[rate.ID]; !ok {
+		s.order = append(s.order, rate.ID)
+	}
+	r := *rate
+	r.Pincodes = append([]string(nil), rate.Pincodes...)
+	s.rates[rate.ID] = &r
+	return nil
+}
+
+func (s *MemoryShippingRateStore) List(ctx context.Context) ([]models.ShippingRate, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	rates := []models.ShippingRate{}
+	for _, id := range s.order {
+		r := *s.rates[id]
+		r.Pincodes = append([]string(nil), r.Pincodes...)
+		rates = append(rates, r)
+	}
+	return rates, nil
+}
+
+func (s *MemoryShippingRateStore) Update(ctx context.Context, rateID primitive.ObjectID, update ShippingRateUpdate) (*models.ShippingRate, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	r, ok := s.rates[rateID]
+	if !ok {
+		return nil, ErrShippingRateNotFound
+	}
+
+	if update.Method != nil {
+		r.Method = *update.Method
+	}
+	if update.Name != nil {
+		r.Name = *update.Name
+	}
+	if update.Pincodes != nil {
+		r.Pincodes = append([]string(nil), (*update.Pincodes)...)
+	}
+	if update.MinWeightGrams != nil {
+		r.MinWeightGrams = *update.MinWeightGrams
+	}
+	if update.MaxWeightGrams != nil {
+		r.MaxWeightGrams = *update.MaxWeightGrams
+	}
+	if update.MinCartValue != nil {
+		r.MinCartValue = *update.MinCartValue
+	}
+	if update.Cost != nil {
+		r.Cost = *update.Cost
+	}
+	if update.PerKg != nil {
+		r.PerKg = *update.PerKg
+	}
+	if update.FreeAbove != nil {
+		r.FreeAbove = *update.FreeAbove
+	}
+	if update.EstimatedDays != nil {
+		r.EstimatedDays = *update.EstimatedDays
+	}
+	if update.Active != nil {
+		r.Active = *update.Active
+	}
+	r.UpdatedAt = time.Now()
+	r.UpdatedBy = update.UpdatedBy
+
+	rate := *r
+	rate.Pincodes = append([]string(nil), r.Pincodes...)
+	return &rate, nil
+}
+
+func (s *MemoryShippingRateStore) Delete(ctx context.Context, rateID primitive.ObjectID) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.rates[rateID]; !ok {
+		return ErrShippingRateNotFound
+	}
+	delete(s.rates, rateID)
+	for i, id := range s.order {
+		if id == rateID {
+			s.order = append(s.order[:i], s.order[i+1:]...)
+			break
+		}
+	}
+	return nil
+}
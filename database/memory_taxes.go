@@ -0,0 +1,99 @@
+package database
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/nerokome/econo/models"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// MemoryTaxRuleStore is an in-process TaxRuleStore for local runs and tests
+type MemoryTaxRuleStore struct {
+	mu    sync.RWMutex
+	rules map[primitive.ObjectID]*models.TaxRule
+	// order keeps listings in insertion order like the Mongo store
+	order []primitive.ObjectID
+}
+
+func NewMemoryTaxRuleStore() *MemoryTaxRuleStore {
+	return &MemoryTaxRuleStore{rules: map[primitive.ObjectID]*models.TaxRule{}}
+}
+
+func (s *MemoryTaxRuleStore) Create(ctx context.Context, rule *models.TaxRule) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.rules[rule.ID]; !ok {
+		s.order = append(s.order, rule.ID)
+	}
+	r := *rule
+	s.rules[rule.ID] = &r
+	return nil
+}
+
+func (s *MemoryTaxRuleStore) List(ctx context.Context) ([]models.TaxRule, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	rules := []models.TaxRule{}
+	for _, id := range s.order {
+		rules = append(rules, *s.rules[id])
+	}
+	return rules, nil
+}
+
+func (s *MemoryTaxRuleStore) Update(ctx context.Context, ruleID primitive.ObjectID, update TaxRuleUpdate) (*models.TaxRule, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	r, ok := s.rules[ruleID]
+	if !ok {
+		return nil, ErrTaxRuleNotFound
+	}
+
+	if update.Name != nil {
+		r.Name = *update.Name
+	}
+	if update.City != nil {
+		r.City = *update.City
+	}
+	if update.Pincode != nil {
+		r.Pincode = *update.Pincode
+	}
+	if update.Category != nil {
+		r.Category = *update.Category
+	}
+	if update.Rate != nil {
+		r.Rate = *update.Rate
+	}
+	if update.Inclusive != nil {
+		r.Inclusive = *update.Inclusive
+	}
+	if update.Active != nil {
+		r.Active = *update.Active
+	}
+	r.UpdatedAt = time.Now()
+	r.UpdatedBy = update.UpdatedBy
+
+	rule := *r
+	return &rule, nil
+}
+
+func (s *MemoryTaxRuleStore) Delete(ctx context.Context, ruleID primitive.ObjectID) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.rules[ruleID]; !ok {
+		return ErrTaxRuleNotFound
+	}
+	delete(s.rules, ruleID)
+	for i, id := range s.order {
+		if id == ruleID {
+			s.order = append(s.order[:i], s.order[i+1:]...)
+			break
+		}
+	}
+	return nil
+}
@@ -0,0 +1,73 @@
+package database
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// MemoryTokenStore is an in-process TokenStore for local runs and tests
+type MemoryTokenStore struct {
+	mu      sync.Mutex
+	revoked map[string]time.Time
+	cutoffs map[string]tokenCutoff
+}
+
+// tokenCutoff is the time up to which a user's tokens are revoked
+type tokenCutoff struct {
+	before    time.Time
+	expiresAt time.Time
+}
+
+func NewMemoryTokenStore() *MemoryTokenStore {
+	return &MemoryTokenStore{
+		revoked: map[string]time.Time{},
+		cutoffs: map[string]tokenCutoff{},
+	}
+}
+
+func (s *MemoryTokenStore) Revoke(ctx context.Context, jti string, expiresAt time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.revoked[jti] = expiresAt
+	return nil
+}
+
+func (s *MemoryTokenStore) RevokeIssuedBefore(ctx context.Context, userID string, before, expiresAt time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	cutoff := s.cutoffs[userID]
+	cutoff.before = maxTime(cutoff.before, before)
+	cutoff.expiresAt = maxTime(cutoff.expiresAt, expiresAt)
+	s.cutoffs[userID] = cutoff
+	return nil
+}
+
+func (s *MemoryTokenStore) IsRevoked(ctx context.Context, jti, userID string, issuedAt time.Time) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// Same effect as the TTL index on the Mongo collection
+	now := time.Now()
+	if expiresAt, ok := s.revoked[jti]; ok && now.After(expiresAt) {
+		delete(s.revoked, jti)
+	}
+	if cutoff, ok := s.cutoffs[userID]; ok && now.After(cutoff.expiresAt) {
+		delete(s.cutoffs, userID)
+	}
+
+	if _, ok := s.revoked[jti]; ok {
+		return true, nil
+	}
+	cutoff, ok := s.cutoffs[userID]
+	return ok && !issuedAt.After(cutoff.before), nil
+}
+
+func maxTime(a, b time.Time) time.Time {
+	if a.After(b) {
+		return a
+	}
+	return b
+}
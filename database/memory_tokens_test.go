@@ -0,0 +1,47 @@
+package database
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestMemoryTokenStoreIsRevoked(t *testing.T) {
+	cutoff := time.Now()
+
+	tests := []struct {
+		name     string
+		jti      string
+		userID   string
+		issuedAt time.Time
+		want     bool
+	}{
+		{name: "revoked jti", jti: "revoked", userID: "other", issuedAt: cutoff, want: true},
+		{name: "issued before the cutoff", jti: "old", userID: "user", issuedAt: cutoff.Add(-time.Minute), want: true},
+		{name: "issued earlier in the same second", jti: "old", userID: "user", issuedAt: cutoff.Add(-time.Millisecond), want: true},
+		{name: "issued at the cutoff", jti: "old", userID: "user", issuedAt: cutoff, want: true},
+		{name: "issued just after the cutoff", jti: "new", userID: "user", issuedAt: cutoff.Add(time.Microsecond), want: false},
+		{name: "another user", jti: "old", userID: "other", issuedAt: cutoff.Add(-time.Minute), want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			store := NewMemoryTokenStore()
+			if err := store.Revoke(ctx, "revoked", time.Now().Add(time.Hour)); err != nil {
+				t.Fatalf("revoke: %v", err)
+			}
+			if err := store.RevokeIssuedBefore(ctx, "user", cutoff, time.Now().Add(time.Hour)); err != nil {
+				t.Fatalf("revoke issued before: %v", err)
+			}
+
+			got, err := store.IsRevoked(ctx, tt.jti, tt.userID, tt.issuedAt)
+			if err != nil {
+				t.Fatalf("is revoked: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("revoked = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,282 @@
+package database
+
+import (
+	"context"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/nerokome/econo/models"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// MemoryUserStore is an in-process UserStore for local runs and tests
+type MemoryUserStore struct {
+	mu    sync.RWMutex
+	users map[string]*models.User
+}
+
+func NewMemoryUserStore() *MemoryUserStore {
+	return &MemoryUserStore{users: map[string]*models.User{}}
+}
+
+// cloneUser copies the slices of a user so callers can't mutate stored state
+func cloneUser(u models.User) *models.User {
+	u.Tokens = slices.Clone(u.Tokens)
+	u.RefreshTokens = slices.Clone(u.RefreshTokens)
+	u.UserCart = slices.Clone(u.UserCart)
+	u.AddressDetails = slices.Clone(u.AddressDetails)
+	u.OrderStatus = slices.Clone(u.OrderStatus)
+	return &u
+}
+
+// keepNewest trims a token list to its last n entries
+func keepNewest(tokens []string, n int) []string {
+	if len(tokens) > n {
+		return slices.Clone(tokens[len(tokens)-n:])
+	}
+	return tokens
+}
+
+func (s *MemoryUserStore) Create(ctx context.Context, user *models.User) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// Same effect as the unique email index on the Mongo collection
+	for _, u := range s.users {
+		if u.Email == user.Email {
+			return ErrEmailTaken
+		}
+	}
+	s.users[user.UserID] = cloneUser(*user)
+	return nil
+}
+
+func (s *MemoryUserStore) FindByID(ctx context.Context, userID string) (*models.User, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	u, ok := s.users[userID]
+	if !ok {
+		return nil, ErrUserNotFound
+	}
+	return cloneUser(*u), nil
+}
+
+func (s *MemoryUserStore) FindByEmail(ctx context.Context, email string) (*models.User, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, u := range s.users {
+		if u.Email == email {
+			return cloneUser(*u), nil
+		}
+	}
+	return nil, ErrUserNotFound
+}
+
+// admins counts the admins. Callers must hold s.mu.
+func (s *MemoryUserStore) admins() int {
+	count := 0
+	for _, u := range s.users {
+		if u.Role == models.RoleAdmin {
+			count++
+		}
+	}
+	return count
+}
+
+// modify runs fn against a stored user under the write lock
+func (s *MemoryUserStore) modify(userID string, fn func(u *models.User) error) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	u, ok := s.users[userID]
+	if !ok {
+		return ErrUserNotFound
+	}
+	return fn(u)
+}
+
+func (s *MemoryUserStore) SetRole(ctx context.Context, userID, role string) error {
+	return s.modify(userID, func(u *models.User) error {
+		if u.EffectiveRole() == models.RoleAdmin && role != models.RoleAdmin && s.admins() <= 1 {
+			return ErrLastAdmin
+		}
+		u.Role = role
+		u.UpdatedAt = time.Now()
+		return nil
+	})
+}
+
+func (s *MemoryUserStore) PromoteFirstAdmin(ctx context.Context, userID string) error {
+	return s.modify(userID, func(u *models.User) error {
+		if s.admins() > 0 {
+			return ErrAdminExists
+		}
+		u.Role = models.RoleAdmin
+		u.UpdatedAt = time.Now()
+		return nil
+	})
+}
+
+func (s *MemoryUserStore) AddSession(ctx context.Context, userID, accessToken, refreshToken string, maxSessions int) error {
+	return s.modify(userID, func(u *models.User) error {
+		u.Tokens = keepNewest(append(u.Tokens, accessToken), maxSessions)
+		u.RefreshTokens = keepNewest(append(u.RefreshTokens, refreshToken), maxSessions)
+		u.UpdatedAt = time.Now()
+		return nil
+	})
+}
+
+func (s *MemoryUserStore) RotateRefreshToken(ctx context.Context, userID, oldRefresh, newRefresh, newAccess string, maxSessions int) error {
+	err := s.modify(userID, func(u *models.User) error {
+		i := slices.Index(u.RefreshTokens, oldRefresh)
+		if i < 0 {
+			return ErrTokenNotFound
+		}
+		u.RefreshTokens[i] = newRefresh
+		u.Tokens = keepNewest(append(u.Tokens, newAccess), maxSessions)
+		u.UpdatedAt = time.Now()
+		return nil
+	})
+	if err == ErrUserNotFound {
+		return ErrTokenNotFound
+	}
+	return err
+}
+
+func (s *MemoryUserStore) SetSessions(ctx context.Context, userID string, tokens, refreshTokens []string) error {
+	return s.modify(userID, func(u *models.User) error {
+		u.Tokens = slices.Clone(tokens)
+		u.RefreshTokens = slices.Clone(refreshTokens)
+		u.UpdatedAt = time.Now()
+		return nil
+	})
+}
+
+func (s *MemoryUserStore) AddAddress(ctx context.Context, userID string, address models.Address) error {
+	return s.modify(userID, func(u *models.User) error {
+		u.AddressDetails = append(u.AddressDetails, address)
+		return nil
+	})
+}
+
+func (s *MemoryUserStore) UpdateAddress(ctx context.Context, userID string, address models.Address) error {
+	err := s.modify(userID, func(u *models.User) error {
+		for i := range u.AddressDetails {
+			if u.AddressDetails[i].ID == address.ID {
+				u.AddressDetails[i] = address
+				return nil
+			}
+		}
+		return ErrAddressNotFound
+	})
+	if err == ErrUserNotFound {
+		return ErrAddressNotFound
+	}
+	return err
+}
+
+func (s *MemoryUserStore) DeleteAddress(ctx context.Context, userID string, addressID primitive.ObjectID) error {
+	err := s.modify(userID, func(u *models.User) error {
+		i := slices.IndexFunc(u.AddressDetails, func(a models.Address) bool {
+			return a.ID == addressID
+		})
+		if i < 0 {
+			return ErrAddressNotFound
+		}
+		u.AddressDetails = slices.Delete(u.AddressDetails, i, i+1)
+		return nil
+	})
+	if err == ErrUserNotFound {
+		return ErrAddressNotFound
+	}
+	return err
+}
+
+func (s *MemoryUserStore) ChangeCartQuantity(ctx context.Context, userID string, item models.CartItem, delta, max int) (int, error) {
+	var quantity int
+	err := s.modify(userID, func(u *models.User) error {
+		i := slices.IndexFunc(u.UserCart, func(line models.CartItem) bool {
+			return line.ProductID == item.ProductID
+		})
+
+		current := 0
+		if i >= 0 {
+			current = u.UserCart[i].Quantity
+		}
+		quantity = current + delta
+
+		switch {
+		case delta < 0 && i < 0:
+			return ErrProductNotInCart
+		case delta > 0 && quantity > max:
+			quantity = current
+			return ErrQuantityLimitExceeded
+		case quantity <= 0:
+			quantity = 0
+			u.UserCart = slices.Delete(u.UserCart, i, i+1)
+		case i >= 0:
+			u.UserCart[i].Quantity = quantity
+		default:
+			item.Quantity = quantity
+			u.UserCart = append(u.UserCart, item)
+		}
+		return nil
+	})
+	return quantity, err
+}
+
+func (s *MemoryUserStore) SetCartQuantity(ctx context.Context, userID string, item models.CartItem) error {
+	return s.modify(userID, func(u *models.User) error {
+		i := slices.IndexFunc(u.UserCart, func(line models.CartItem) bool {
+			return line.ProductID == item.ProductID
+		})
+
+		switch {
+		case item.Quantity <= 0 && i >= 0:
+			u.UserCart = slices.Delete(u.UserCart, i, i+1)
+		case item.Quantity <= 0:
+		case i >= 0:
+			u.UserCart[i].Quantity = item.Quantity
+		default:
+			u.UserCart = append(u.UserCart, item)
+		}
+		return nil
+	})
+}
+
+func (s *MemoryUserStore) RemoveCartProduct(ctx context.Context, userID string, productID primitive.ObjectID) error {
+	return s.modify(userID, func(u *models.User) error {
+		u.UserCart = slices.DeleteFunc(u.UserCart, func(line models.CartItem) bool {
+			return line.ProductID == productID
+		})
+		return nil
+	})
+}
+
+func (s *MemoryUserStore) ClearCart(ctx context.Context, userID string) error {
+	return s.modify(userID, func(u *models.User) error {
+		u.UserCart = []models.CartItem{}
+		return nil
+	})
+}
+
+func (s *MemoryUserStore) SetCartCoupon(ctx context.Context, userID, code string) error {
+	return s.modify(userID, func(u *models.User) error {
+		u.CartCoupon = code
+		return nil
+	})
+}
+
+func (s *MemoryUserStore) Cart(ctx context.Context, userID string) ([]models.CartItem, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	u, ok := s.users[userID]
+	if !ok {
+		return nil, ErrUserNotFound
+	}
+	return slices.Clone(u.UserCart), nil
+}
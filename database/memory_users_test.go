@@ -0,0 +1,150 @@
+package database
+
+import (
+	"context"
+	"testing"
+
+	"github.com/nerokome/econo/models"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// newUser adds a customer with one saved address
+func newUser(t *testing.T, users UserStore) *models.User {
+	t.Helper()
+
+	id := primitive.NewObjectID()
+	user := &models.User{
+		ID:     id,
+		UserID: id.Hex(),
+		Email:  id.Hex() + "@example.com",
+		Role:   models.RoleCustomer,
+		AddressDetails: []models.Address{{
+			ID:      primitive.NewObjectID(),
+			Street:  "1 Main Street",
+			City:    "Pune",
+			Pincode: "411001",
+		}},
+	}
+	if err := users.Create(context.Background(), user); err != nil {
+		t.Fatalf("create user: %v", err)
+	}
+	return user
+}
+
+func TestMemoryUserStoreCreate(t *testing.T) {
+	tests := []struct {
+		name    string
+		email   string
+		wantErr error
+	}{
+		{name: "new email", email: "b@example.com"},
+		{name: "email taken", email: "a@example.com", wantErr: ErrEmailTaken},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			users := NewMemoryUserStore()
+			first := primitive.NewObjectID()
+			if err := users.Create(ctx, &models.User{ID: first, UserID: first.Hex(), Email: "a@example.com"}); err != nil {
+				t.Fatalf("create first user: %v", err)
+			}
+
+			second := primitive.NewObjectID()
+			err := users.Create(ctx, &models.User{ID: second, UserID: second.Hex(), Email: tt.email})
+			if err != tt.wantErr {
+				t.Fatalf("err = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestMemoryUserStoreDeleteAddress(t *testing.T) {
+	tests := []struct {
+		name      string
+		otherUser bool
+		otherID   bool
+		wantErr   error
+		wantLeft  int
+	}{
+		{name: "saved address", wantLeft: 0},
+		{name: "unknown address", otherID: true, wantErr: ErrAddressNotFound, wantLeft: 1},
+		{name: "unknown user", otherUser: true, wantErr: ErrAddressNotFound, wantLeft: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			users := NewMemoryUserStore()
+			user := newUser(t, users)
+
+			userID, addressID := user.ID, user.AddressDetails[0].ID
+			if tt.otherUser {
+				userID = primitive.NewObjectID()
+			}
+			if tt.otherID {
+				addressID = primitive.NewObjectID()
+			}
+
+			err := users.DeleteAddress(ctx, userID.Hex(), addressID)
+			if err != tt.wantErr {
+				t.Fatalf("err = %v, want %v", err, tt.wantErr)
+			}
+
+			user, err = users.FindByID(ctx, user.UserID)
+			if err != nil {
+				t.Fatalf("find user: %v", err)
+			}
+			if len(user.AddressDetails) != tt.wantLeft {
+				t.Errorf("addresses = %d, want %d", len(user.AddressDetails), tt.wantLeft)
+			}
+		})
+	}
+}
+
+func TestMemoryUserStoreRoles(t *testing.T) {
+	promote := func(ctx context.Context, users UserStore, userID string) error {
+		return users.PromoteFirstAdmin(ctx, userID)
+	}
+	demote := func(ctx context.Context, users UserStore, userID string) error {
+		return users.SetRole(ctx, userID, models.RoleCustomer)
+	}
+
+	tests := []struct {
+		name        string
+		admin       bool
+		otherAdmins int
+		change      func(ctx context.Context, users UserStore, userID string) error
+		wantErr     error
+	}{
+		{name: "first admin", change: promote},
+		{name: "second bootstrap", otherAdmins: 1, change: promote, wantErr: ErrAdminExists},
+		{name: "demote the last admin", admin: true, change: demote, wantErr: ErrLastAdmin},
+		{name: "demote one of two admins", admin: true, otherAdmins: 1, change: demote},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			users := NewMemoryUserStore()
+			user := newUser(t, users)
+
+			admins := []string{}
+			if tt.admin {
+				admins = append(admins, user.UserID)
+			}
+			for i := 0; i < tt.otherAdmins; i++ {
+				admins = append(admins, newUser(t, users).UserID)
+			}
+			for _, id := range admins {
+				if err := users.SetRole(ctx, id, models.RoleAdmin); err != nil {
+					t.Fatalf("make admin: %v", err)
+				}
+			}
+
+			if err := tt.change(ctx, users, user.UserID); err != tt.wantErr {
+				t.Fatalf("err = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,337 @@
+package database
+
+import (
+	"context"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/nerokome/econo/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// legacyNumber matches a field still holding a bare number rather than a Money document
+var legacyNumber = bson.M{"$type": "number"}
+
+// moneyMigration lists the fields of one collection that used to hold bare numbers.
+// Paths step into arrays, so "order_cart.price" is the price of every cart line.
+type moneyMigration struct {
+	collection string
+	filter     bson.M
+	paths      []string
+	// fix makes any other change the document needs once its amounts are converted
+	fix func(doc bson.M, currency string)
+}
+
+var moneyMigrations = []moneyMigration{
+	{
+		collection: "products",
+		filter:     bson.M{"price": legacyNumber},
+		paths:      []string{"price"},
+	},
+	{
+		collection: "users",
+		filter:     bson.M{"user_cart.unit_price": legacyNumber},
+		paths:      []string{"user_cart.unit_price"},
+	},
+	{
+		collection: "orders",
+		filter: bson.M{"$or": bson.A{
+			bson.M{"price": legacyNumber},
+			bson.M{"payment.amount": legacyNumber},
+			bson.M{"refunds.amount": legacyNumber},
+		}},
+		paths: []string{
+			"price", "discount", "tax",
+			"order_cart.price",
+			"payment.amount",
+			"discounts.amount", "discounts.lines.amount",
+			"taxes.taxable", "taxes.amount",
+			"refunds.amount", "refunds.lines.amount",
+		},
+	},
+	{
+		collection: "coupons",
+		filter: bson.M{"$or": bson.A{
+			bson.M{"min_cart_value": legacyNumber},
+			bson.M{"max_discount": legacyNumber},
+			bson.M{"type": models.CouponFixed, "value": bson.M{"$exists": true}},
+		}},
+		paths: []string{"min_cart_value", "max_discount"},
+		// Fixed coupons kept their amount in value, which is now only a percentage
+		fix: func(doc bson.M, currency string) {
+			if doc["type"] != models.CouponFixed {
+				return
+			}
+			if value, ok := doc["value"]; ok {
+				doc["amount"] = value
+				delete(doc, "value")
+				convertMoneyPath(doc, []string{"amount"}, currency)
+			}
+		},
+	},
+}
+
+/*
+MigrateMoney converts amounts stored as bare numbers, from before they carried a
+currency, into Money documents in currency. Product and cart prices used to be whole
+units and order amounts float64 units; both become minor units. Converted documents
+no longer match the filters, so it is safe to run on every start.
+*/
+func MigrateMoney(ctx context.Context, client *mongo.Client, currency string) error {
+	for _, m := range moneyMigrations {
+		coll := Collection(client, m.collection)
+
+		cursor, err := coll.Find(ctx, m.filter)
+		if err != nil {
+			return err
+		}
+
+		migrated := 0
+		for cursor.Next(ctx) {
+			var doc bson.M
+			if err := cursor.Decode(&doc); err != nil {
+				cursor.Close(ctx)
+				return err
+			}
+
+			for _, path := range m.paths {
+				convertMoneyPath(doc, strings.Split(path, "."), currency)
+			}
+			if m.fix != nil {
+				m.fix(doc, currency)
+			}
+
+			// Matching the filter again skips documents changed since they were read
+			filter := bson.M{"$and": bson.A{bson.M{"_id": doc["_id"]}, m.filter}}
+			if _, err := coll.ReplaceOne(ctx, filter, doc); err != nil {
+				cursor.Close(ctx)
+				return err
+			}
+			migrated++
+		}
+		err = cursor.Err()
+		cursor.Close(ctx)
+		if err != nil {
+			return err
+		}
+
+		if migrated > 0 {
+			log.Printf("Converted amounts in %d %s documents to %s", migrated, m.collection, currency)
+		}
+	}
+	return nil
+}
+
+/*
+runOnce runs migrate unless the migrations collection says the migration called
+name has already been done, and records it there once migrate succeeds. Use it for
+migrations whose filter alone would mean scanning a whole collection on every start.
+*/
+func runOnce(ctx context.Context, client *mongo.Client, name string, migrate func() error) error {
+	coll := Collection(client, "migrations")
+
+	err := coll.FindOne(ctx, bson.M{"_id": name}).Err()
+	if err == nil {
+		return nil
+	}
+	if err != mongo.ErrNoDocuments {
+		return err
+	}
+
+	if err := migrate(); err != nil {
+		return err
+	}
+
+	// Another instance may have finished the same migration first
+	_, err = coll.UpdateOne(
+		ctx,
+		bson.M{"_id": name},
+		bson.M{"$setOnInsert": bson.M{"done_at": time.Now()}},
+		options.Update().SetUpsert(true),
+	)
+	return err
+}
+
+/*
+MigrateCarts rewrites carts saved before they held quantities, when user_cart was a
+set of product snapshots, into cart lines of one unit each at the snapshot's price.
+Run it before MigrateMoney, which converts the prices it carries over. It only runs
+once per database; rewritten carts no longer match its filter, so a second instance
+starting at the same time does no harm.
+*/
+func MigrateCarts(ctx context.Context, client *mongo.Client) error {
+	return runOnce(ctx, client, "cart_lines", func() error {
+		return migrateCarts(ctx, Collection(client, "users"))
+	})
+}
+
+// migrateCarts does the work of MigrateCarts
+func migrateCarts(ctx context.Context, coll *mongo.Collection) error {
+	// Cart lines are keyed by product_id; only the old snapshots have an _id
+	legacy := bson.M{"user_cart._id": bson.M{"$exists": true}}
+
+	cursor, err := coll.Find(ctx, legacy)
+	if err != nil {
+		return err
+	}
+
+	migrated := 0
+	for cursor.Next(ctx) {
+		var doc struct {
+			ID   primitive.ObjectID `bson:"_id"`
+			Cart bson.A             `bson:"user_cart"`
+		}
+		if err := cursor.Decode(&doc); err != nil {
+			cursor.Close(ctx)
+			return err
+		}
+
+		// Matching the cart as read skips carts changed since
+		filter := bson.M{"_id": doc.ID, "user_cart": doc.Cart}
+		update := bson.M{"$set": bson.M{"user_cart": cartLines(doc.Cart, time.Now())}}
+		if _, err := coll.UpdateOne(ctx, filter, update); err != nil {
+			cursor.Close(ctx)
+			return err
+		}
+		migrated++
+	}
+	err = cursor.Err()
+	cursor.Close(ctx)
+	if err != nil {
+		return err
+	}
+
+	if migrated > 0 {
+		log.Printf("Converted the carts of %d users to cart lines", migrated)
+	}
+	return nil
+}
+
+// cartLines turns the product snapshots in an old cart into lines of one unit,
+// keeping any lines already in the new shape. A product with both keeps its line.
+func cartLines(cart bson.A, addedAt time.Time) bson.A {
+	lines := bson.A{}
+	seen := map[any]bool{}
+	var snapshots []primitive.D
+	for _, item := range cart {
+		doc, ok := item.(primitive.D)
+		if !ok {
+			continue
+		}
+		if _, isSnapshot := docValue(doc, "_id"); isSnapshot {
+			snapshots = append(snapshots, doc)
+			continue
+		}
+		productID, _ := docValue(doc, "product_id")
+		seen[productID] = true
+		lines = append(lines, doc)
+	}
+
+	for _, doc := range snapshots {
+		productID, _ := docValue(doc, "_id")
+		if seen[productID] {
+			continue
+		}
+		seen[productID] = true
+		price, _ := docValue(doc, "price")
+		lines = append(lines, bson.D{
+			{Key: "product_id", Value: productID},
+			{Key: "quantity", Value: 1},
+			{Key: "unit_price", Value: price},
+			{Key: "added_at", Value: addedAt},
+		})
+	}
+	return lines
+}
+
+// docValue looks up a field of a document
+func docValue(doc primitive.D, key string) (any, bool) {
+	for _, e := range doc {
+		if e.Key == key {
+			return e.Value, true
+		}
+	}
+	return nil, false
+}
+
+/*
+MigrateStock gives products saved before stock was tracked, which have no stock field
+and so read as sold out, initial units of stock. Products with a stock field are left
+alone, so it is safe to run on every start.
+*/
+func MigrateStock(ctx context.Context, client *mongo.Client, initial int) error {
+	result, err := Collection(client, "products").UpdateMany(
+		ctx,
+		bson.M{"stock": bson.M{"$exists": false}},
+		bson.M{"$set": bson.M{"stock": initial}},
+	)
+	if err != nil {
+		return err
+	}
+	if result.ModifiedCount > 0 {
+		log.Printf("Set the stock of %d products without one to %d", result.ModifiedCount, initial)
+	}
+	return nil
+}
+
+// convertMoneyPath replaces the bare numbers found at path in v with Money documents
+func convertMoneyPath(v any, path []string, currency string) {
+	switch node := v.(type) {
+	case bson.A:
+		for _, item := range node {
+			convertMoneyPath(item, path, currency)
+		}
+	case bson.M:
+		value, ok := node[path[0]]
+		if !ok {
+			return
+		}
+		if len(path) > 1 {
+			convertMoneyPath(value, path[1:], currency)
+			return
+		}
+		if money, ok := legacyMoney(value, currency); ok {
+			node[path[0]] = money
+		}
+	case primitive.D:
+		for i := range node {
+			if node[i].Key != path[0] {
+				continue
+			}
+			if len(path) > 1 {
+				convertMoneyPath(node[i].Value, path[1:], currency)
+				return
+			}
+			if money, ok := legacyMoney(node[i].Value, currency); ok {
+				node[i].Value = money
+			}
+			return
+		}
+	}
+}
+
+// legacyMoney reads a bare number in whole currency units as Money. Numbers too large
+// for Money are left alone.
+func legacyMoney(v any, currency string) (models.Money, bool) {
+	var major float64
+	switch n := v.(type) {
+	case int32:
+		major = float64(n)
+	case int64:
+		major = float64(n)
+	case float64:
+		major = n
+	default:
+		return models.Money{}, false
+	}
+	money, err := models.MoneyFromMajor(major, currency)
+	if err != nil {
+		log.Println("Money migration skipped an amount:", major, err)
+		return models.Money{}, false
+	}
+	return money, true
+}
@@ -0,0 +1,48 @@
+package database
+
+import (
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestCartLines(t *testing.T) {
+	a, b := primitive.NewObjectID(), primitive.NewObjectID()
+	now := time.Now()
+	snapshot := func(id primitive.ObjectID, price int64) primitive.D {
+		return primitive.D{{Key: "_id", Value: id}, {Key: "product_name", Value: "Product"}, {Key: "price", Value: price}}
+	}
+	line := func(id primitive.ObjectID, quantity int) primitive.D {
+		return primitive.D{{Key: "product_id", Value: id}, {Key: "quantity", Value: quantity}}
+	}
+
+	tests := []struct {
+		name string
+		cart bson.A
+		want map[primitive.ObjectID]int
+	}{
+		{name: "snapshots become single units", cart: bson.A{snapshot(a, 5), snapshot(b, 7)}, want: map[primitive.ObjectID]int{a: 1, b: 1}},
+		{name: "lines are kept", cart: bson.A{snapshot(a, 5), line(b, 3)}, want: map[primitive.ObjectID]int{a: 1, b: 3}},
+		{name: "a line wins over a snapshot of the same product", cart: bson.A{snapshot(a, 5), line(a, 2)}, want: map[primitive.ObjectID]int{a: 2}},
+		{name: "repeated snapshots", cart: bson.A{snapshot(a, 5), snapshot(a, 5)}, want: map[primitive.ObjectID]int{a: 1}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lines := cartLines(tt.cart, now)
+			if len(lines) != len(tt.want) {
+				t.Fatalf("lines = %d, want %d", len(lines), len(tt.want))
+			}
+			for _, l := range lines {
+				doc := l.(primitive.D)
+				id, _ := docValue(doc, "product_id")
+				quantity, _ := docValue(doc, "quantity")
+				if quantity != tt.want[id.(primitive.ObjectID)] {
+					t.Errorf("quantity of %v = %v, want %d", id, quantity, tt.want[id.(primitive.ObjectID)])
+				}
+			}
+		})
+	}
+}
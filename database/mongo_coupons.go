@@ -0,0 +1,168 @@
+package database
+
+import (
+	"context"
+
+	"github.com/nerokome/econo/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// MongoCouponStore is the CouponStore backed by the coupons collection
+type MongoCouponStore struct {
+	coll *mongo.Collection
+}
+
+func NewMongoCouponStore(coll *mongo.Collection) *MongoCouponStore {
+	return &MongoCouponStore{coll: coll}
+}
+
+/*
+EnsureIndexes keeps coupon codes unique
+*/
+func (s *MongoCouponStore) EnsureIndexes(ctx context.Context) error {
+	_, err := s.coll.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "code", Value: 1}},
+		Options: options.Index().SetUnique(true),
+	})
+	return err
+}
+
+func (s *MongoCouponStore) Create(ctx context.Context, coupon *models.Coupon) error {
+	_, err := s.coll.InsertOne(ctx, coupon)
+	if mongo.IsDuplicateKeyError(err) {
+		return ErrCouponCodeTaken
+	}
+	return err
+}
+
+func (s *MongoCouponStore) findOne(ctx context.Context, filter bson.M) (*models.Coupon, error) {
+	var coupon models.Coupon
+	err := s.coll.FindOne(ctx, filter).Decode(&coupon)
+	if err == mongo.ErrNoDocuments {
+		return nil, ErrCouponNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &coupon, nil
+}
+
+func (s *MongoCouponStore) FindByID(ctx context.Context, couponID primitive.ObjectID) (*models.Coupon, error) {
+	return s.findOne(ctx, bson.M{"_id": couponID})
+}
+
+func (s *MongoCouponStore) FindByCode(ctx context.Context, code string) (*models.Coupon, error) {
+	return s.findOne(ctx, bson.M{"code": code})
+}
+
+func (s *MongoCouponStore) List(ctx context.Context) ([]models.Coupon, error) {
+	cursor, err := s.coll.Find(ctx, bson.M{}, options.Find().SetSort(bson.D{{Key: "created_at", Value: -1}}))
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	coupons := []models.Coupon{}
+	if err := cursor.All(ctx, &coupons); err != nil {
+		return nil, err
+	}
+	return coupons, nil
+}
+
+func (s *MongoCouponStore) Update(ctx context.Context, couponID primitive.ObjectID, update CouponUpdate) (*models.Coupon, error) {
+	set := bson.M{}
+	if update.Description != nil {
+		set["description"] = *update.Description
+	}
+	if update.Active != nil {
+		set["active"] = *update.Active
+	}
+	if update.StartsAt != nil {
+		set["starts_at"] = *update.StartsAt
+	}
+	if update.EndsAt != nil {
+		set["ends_at"] = *update.EndsAt
+	}
+	if update.UsageLimit != nil {
+		set["usage_limit"] = *update.UsageLimit
+	}
+	if update.PerUserLimit != nil {
+		set["per_user_limit"] = *update.PerUserLimit
+	}
+
+	// Moving one end of the window only goes through if the stored other end still
+	// leaves it open. $not also matches coupons without that end.
+	filter := bson.M{"_id": couponID}
+	switch {
+	case update.StartsAt != nil && update.EndsAt != nil:
+		if !ValidCouponWindow(update.StartsAt, update.EndsAt) {
+			return nil, ErrCouponWindow
+		}
+	case update.StartsAt != nil:
+		filter["ends_at"] = bson.M{"$not": bson.M{"$lte": *update.StartsAt}}
+	case update.EndsAt != nil:
+		filter["starts_at"] = bson.M{"$not": bson.M{"$gte": *update.EndsAt}}
+	}
+
+	var coupon models.Coupon
+	err := s.coll.FindOneAndUpdate(
+		ctx,
+		filter,
+		bson.M{"$set": set},
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(&coupon)
+
+	if err == mongo.ErrNoDocuments {
+		if _, err := s.FindByID(ctx, couponID); err != nil {
+			return nil, err
+		}
+		return nil, ErrCouponWindow
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &coupon, nil
+}
+
+func (s *MongoCouponStore) Redeem(ctx context.Context, coupon *models.Coupon, userID string) error {
+	filter := bson.M{"_id": coupon.ID}
+	if coupon.UsageLimit > 0 {
+		filter["used_count"] = bson.M{"$lt": coupon.UsageLimit}
+	}
+	if coupon.PerUserLimit > 0 {
+		// $not also matches users who have no redemptions yet
+		filter["redemptions."+userID] = bson.M{"$not": bson.M{"$gte": coupon.PerUserLimit}}
+	}
+
+	result, err := s.coll.UpdateOne(ctx, filter, bson.M{"$inc": bson.M{
+		"used_count":            1,
+		"redemptions." + userID: 1,
+	}})
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount > 0 {
+		return nil
+	}
+
+	// Someone got to the last use first; work out which limit was hit
+	current, err := s.FindByID(ctx, coupon.ID)
+	if err != nil {
+		return err
+	}
+	if current.UsageLimit > 0 && current.UsedCount >= current.UsageLimit {
+		return ErrCouponExhausted
+	}
+	return ErrCouponUserLimit
+}
+
+func (s *MongoCouponStore) Unredeem(ctx context.Context, couponID primitive.ObjectID, userID string) error {
+	_, err := s.coll.UpdateOne(ctx, bson.M{"_id": couponID}, bson.M{"$inc": bson.M{
+		"used_count":            -1,
+		"redemptions." + userID: -1,
+	}})
+	return err
+}
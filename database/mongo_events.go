@@ -0,0 +1,46 @@
+package database
+
+import (
+	"context"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// MongoEventStore is the EventStore backed by the payment_events collection
+type MongoEventStore struct {
+	coll *mongo.Collection
+}
+
+func NewMongoEventStore(coll *mongo.Collection) *MongoEventStore {
+	return &MongoEventStore{coll: coll}
+}
+
+/*
+EnsureIndexes forgets events once gateways have long stopped retrying them
+*/
+func (s *MongoEventStore) EnsureIndexes(ctx context.Context) error {
+	_, err := s.coll.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "received_at", Value: 1}},
+		Options: options.Index().SetExpireAfterSeconds(int32(EventRetention / time.Second)),
+	})
+	return err
+}
+
+func (s *MongoEventStore) Claim(ctx context.Context, eventID string) (bool, error) {
+	_, err := s.coll.InsertOne(ctx, bson.M{"_id": eventID, "received_at": time.Now()})
+	if mongo.IsDuplicateKeyError(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+func (s *MongoEventStore) Release(ctx context.Context, eventID string) error {
+	_, err := s.coll.DeleteOne(ctx, bson.M{"_id": eventID})
+	return err
+}
@@ -0,0 +1,94 @@
+package database
+
+import (
+	"context"
+	"time"
+
+	"github.com/nerokome/econo/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// MongoExchangeRateStore is the ExchangeRateStore backed by the exchange_rates collection
+type MongoExchangeRateStore struct {
+	coll *mongo.Collection
+}
+
+func NewMongoExchangeRateStore(coll *mongo.Collection) *MongoExchangeRateStore {
+	return &MongoExchangeRateStore{coll: coll}
+}
+
+/*
+EnsureIndexes serves the lookup of the latest rate for a currency pair
+*/
+func (s *MongoExchangeRateStore) EnsureIndexes(ctx context.Context) error {
+	_, err := s.coll.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{
+			{Key: "base", Value: 1},
+			{Key: "currency", Value: 1},
+			{Key: "effective_from", Value: -1},
+		},
+	})
+	return err
+}
+
+func (s *MongoExchangeRateStore) Create(ctx context.Context, rate *models.ExchangeRate) error {
+	_, err := s.coll.InsertOne(ctx, rate)
+	return err
+}
+
+func (s *MongoExchangeRateStore) List(ctx context.Context) ([]models.ExchangeRate, error) {
+	cursor, err := s.coll.Find(ctx, bson.M{}, options.Find().SetSort(bson.D{
+		{Key: "base", Value: 1},
+		{Key: "currency", Value: 1},
+		{Key: "effective_from", Value: -1},
+	}))
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	rates := []models.ExchangeRate{}
+	if err := cursor.All(ctx, &rates); err != nil {
+		return nil, err
+	}
+	return rates, nil
+}
+
+func (s *MongoExchangeRateStore) Effective(ctx context.Context, base, currency string, at time.Time) (*models.ExchangeRate, error) {
+	var rate models.ExchangeRate
+	err := s.coll.FindOne(
+		ctx,
+		bson.M{"base": base, "currency": currency, "effective_from": bson.M{"$lte": at}},
+		options.FindOne().SetSort(bson.D{{Key: "effective_from", Value: -1}, {Key: "created_at", Value: -1}}),
+	).Decode(&rate)
+	if err == mongo.ErrNoDocuments {
+		return nil, ErrExchangeRateNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &rate, nil
+}
+
+func (s *MongoExchangeRateStore) Delete(ctx context.Context, rateID primitive.ObjectID, now time.Time) error {
+	result, err := s.coll.DeleteOne(ctx, bson.M{"_id": rateID, "effective_from": bson.M{"$gt": now}})
+	if err != nil {
+		return err
+	}
+	if result.DeletedCount == 1 {
+		return nil
+	}
+
+	// Tell a rate already in effect apart from one that doesn't exist
+	count, err := s.coll.CountDocuments(ctx, bson.M{"_id": rateID})
+	if err != nil {
+		return err
+	}
+	if count > 0 {
+		return ErrExchangeRateInUse
+	}
+	return ErrExchangeRateNotFound
+}
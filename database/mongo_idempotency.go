@@ -0,0 +1,88 @@
+package database
+
+import (
+	"context"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// MongoIdempotencyStore is the IdempotencyStore backed by the idempotency_keys collection
+type MongoIdempotencyStore struct {
+	coll *mongo.Collection
+}
+
+func NewMongoIdempotencyStore(coll *mongo.Collection) *MongoIdempotencyStore {
+	return &MongoIdempotencyStore{coll: coll}
+}
+
+/*
+EnsureIndexes lets Mongo drop stored responses once their key expires
+*/
+func (s *MongoIdempotencyStore) EnsureIndexes(ctx context.Context) error {
+	_, err := s.coll.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "expires_at", Value: 1}},
+		Options: options.Index().SetExpireAfterSeconds(0),
+	})
+	return err
+}
+
+func (s *MongoIdempotencyStore) Reserve(ctx context.Context, key, requestHash string) (*IdempotencyRecord, bool, error) {
+	now := time.Now()
+	record := IdempotencyRecord{
+		Key:         key,
+		RequestHash: requestHash,
+		LockedUntil: now.Add(IdempotencyLease),
+		ExpiresAt:   now.Add(IdempotencyTTL),
+	}
+	_, err := s.coll.InsertOne(ctx, record)
+	if err == nil {
+		return &record, true, nil
+	}
+	if !mongo.IsDuplicateKeyError(err) {
+		return nil, false, err
+	}
+
+	// Take over a key whose request never finished
+	result, err := s.coll.ReplaceOne(ctx, bson.M{
+		"_id":    key,
+		"status": 0,
+		"$or": bson.A{
+			bson.M{"locked_until": bson.M{"$lt": now}},
+			bson.M{"locked_until": bson.M{"$exists": false}},
+		},
+	}, record)
+	if err != nil {
+		return nil, false, err
+	}
+	if result.MatchedCount > 0 {
+		return &record, true, nil
+	}
+
+	var existing IdempotencyRecord
+	err = s.coll.FindOne(ctx, bson.M{"_id": key}).Decode(&existing)
+	if err == mongo.ErrNoDocuments {
+		// Expired or released in between; the caller can simply retry
+		return nil, false, ErrKeyChanged
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	return &existing, false, nil
+}
+
+func (s *MongoIdempotencyStore) Complete(ctx context.Context, key string, status int, contentType string, body []byte) error {
+	_, err := s.coll.UpdateOne(ctx, bson.M{"_id": key}, bson.M{"$set": bson.M{
+		"status":       status,
+		"content_type": contentType,
+		"body":         body,
+	}})
+	return err
+}
+
+func (s *MongoIdempotencyStore) Release(ctx context.Context, key string) error {
+	_, err := s.coll.DeleteOne(ctx, bson.M{"_id": key})
+	return err
+}
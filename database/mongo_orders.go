@@ -0,0 +1,331 @@
+package database
+
+import (
+	"context"
+	"time"
+
+	"github.com/nerokome/econo/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// MongoOrderStore is the OrderStore backed by the orders collection.
+// Placing an order also writes stock to products and the order link to users, and
+// cancelling it gives coupon uses back in coupons.
+type MongoOrderStore struct {
+	coll     *mongo.Collection
+	users    *mongo.Collection
+	products *mongo.Collection
+	coupons  *mongo.Collection
+}
+
+func NewMongoOrderStore(coll, users, products, coupons *mongo.Collection) *MongoOrderStore {
+	return &MongoOrderStore{coll: coll, users: users, products: products, coupons: coupons}
+}
+
+/*
+EnsureIndexes backs the per-user order history listing
+*/
+func (s *MongoOrderStore) EnsureIndexes(ctx context.Context) error {
+	_, err := s.coll.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{{Key: "user_id", Value: 1}, {Key: "ordered_at", Value: -1}},
+	})
+	return err
+}
+
+// inTransaction runs fn in a multi-document transaction
+func (s *MongoOrderStore) inTransaction(ctx context.Context, fn func(sc mongo.SessionContext) error) error {
+	session, err := s.coll.Database().Client().StartSession()
+	if err != nil {
+		return err
+	}
+	defer session.EndSession(ctx)
+
+	_, err = session.WithTransaction(ctx, func(sc mongo.SessionContext) (interface{}, error) {
+		return nil, fn(sc)
+	})
+	return err
+}
+
+// adjustStock moves each line's quantity out of (sign -1) or back into (sign 1) stock
+func (s *MongoOrderStore) adjustStock(sc mongo.SessionContext, lines []models.ProductUser, sign int) error {
+	for _, line := range lines {
+		filter := bson.M{"_id": line.ID}
+		if sign < 0 {
+			filter["deleted_at"] = nil
+			filter["stock"] = bson.M{"$gte": line.Quantity}
+		}
+
+		result, err := s.products.UpdateOne(sc, filter, bson.M{"$inc": bson.M{"stock": sign * line.Quantity}})
+		if err != nil {
+			return err
+		}
+		if result.MatchedCount == 0 && sign < 0 {
+			return ErrInsufficientQuantity
+		}
+	}
+	return nil
+}
+
+func (s *MongoOrderStore) PlaceOrder(ctx context.Context, order *models.Order, clearCart bool) error {
+	return s.inTransaction(ctx, func(sc mongo.SessionContext) error {
+		if err := s.adjustStock(sc, order.OrderCart, -1); err != nil {
+			return err
+		}
+
+		if _, err := s.coll.InsertOne(sc, order); err != nil {
+			return ErrUnableToCreateOrder
+		}
+
+		update := bson.M{"$push": bson.M{"order_status": order.ID}}
+		if clearCart {
+			update["$set"] = bson.M{"user_cart": []models.CartItem{}}
+			update["$unset"] = bson.M{"cart_coupon": ""}
+		}
+
+		result, err := s.users.UpdateOne(sc, bson.M{"user_id": order.UserID}, update)
+		if err != nil {
+			return err
+		}
+		if result.MatchedCount == 0 {
+			return ErrUserNotFound
+		}
+		return nil
+	})
+}
+
+func (s *MongoOrderStore) ConfirmReservation(ctx context.Context, orderID primitive.ObjectID) error {
+	result, err := s.coll.UpdateOne(
+		ctx,
+		bson.M{"_id": orderID, "reservation.status": models.ReservationHeld},
+		bson.M{"$set": bson.M{"reservation.status": models.ReservationConfirmed}},
+	)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return ErrNotReserved
+	}
+	return nil
+}
+
+func (s *MongoOrderStore) ReleaseReservation(ctx context.Context, orderID primitive.ObjectID) error {
+	return s.inTransaction(ctx, func(sc mongo.SessionContext) error {
+		var order models.Order
+		err := s.coll.FindOneAndUpdate(
+			sc,
+			bson.M{"_id": orderID, "reservation.status": bson.M{"$ne": models.ReservationReleased}},
+			bson.M{"$set": bson.M{"reservation.status": models.ReservationReleased}},
+		).Decode(&order)
+		if err == mongo.ErrNoDocuments {
+			return ErrNotReserved
+		}
+		if err != nil {
+			return err
+		}
+		return s.adjustStock(sc, order.HeldLines(), 1)
+	})
+}
+
+func (s *MongoOrderStore) ReturnCoupons(ctx context.Context, orderID primitive.ObjectID) error {
+	return s.inTransaction(ctx, func(sc mongo.SessionContext) error {
+		var order models.Order
+		err := s.coll.FindOneAndUpdate(
+			sc,
+			bson.M{"_id": orderID, "unredeemed": bson.M{"$ne": true}},
+			bson.M{"$set": bson.M{"unredeemed": true}},
+		).Decode(&order)
+		if err == mongo.ErrNoDocuments {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		for _, d := range order.Discounts {
+			_, err := s.coupons.UpdateOne(sc, bson.M{"_id": d.CouponID}, bson.M{"$inc": bson.M{
+				"used_count":                  -1,
+				"redemptions." + order.UserID: -1,
+			}})
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (s *MongoOrderStore) ExpiredReservations(ctx context.Context, now time.Time) ([]primitive.ObjectID, error) {
+	return s.findIDs(ctx, bson.M{
+		"reservation.status":     models.ReservationHeld,
+		"reservation.expires_at": bson.M{"$lt": now},
+	})
+}
+
+func (s *MongoOrderStore) FindByID(ctx context.Context, orderID primitive.ObjectID) (*models.Order, error) {
+	var order models.Order
+	err := s.coll.FindOne(ctx, bson.M{"_id": orderID}).Decode(&order)
+	if err == mongo.ErrNoDocuments {
+		return nil, ErrOrderNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &order, nil
+}
+
+func (s *MongoOrderStore) UpdateStatus(ctx context.Context, orderID primitive.ObjectID, from string, change models.OrderStatusChange, effects []string) error {
+	update := bson.M{
+		"$set":  bson.M{"status": change.Status},
+		"$push": bson.M{"status_history": change},
+	}
+	if len(effects) > 0 {
+		update["$addToSet"] = bson.M{"pending_effects": bson.M{"$each": effects}}
+	}
+
+	result, err := s.coll.UpdateOne(ctx, bson.M{"_id": orderID, "status": from}, update)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return ErrStatusChanged
+	}
+	return nil
+}
+
+func (s *MongoOrderStore) ClearEffect(ctx context.Context, orderID primitive.ObjectID, effect string) error {
+	result, err := s.coll.UpdateOne(ctx, bson.M{"_id": orderID}, bson.M{"$pull": bson.M{"pending_effects": effect}})
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return ErrOrderNotFound
+	}
+	return nil
+}
+
+func (s *MongoOrderStore) PendingEffects(ctx context.Context) ([]primitive.ObjectID, error) {
+	return s.findIDs(ctx, bson.M{"pending_effects.0": bson.M{"$exists": true}})
+}
+
+func (s *MongoOrderStore) SetPayment(ctx context.Context, orderID primitive.ObjectID, payment models.Payment) error {
+	result, err := s.coll.UpdateOne(ctx, bson.M{"_id": orderID}, bson.M{"$set": bson.M{"payment": payment}})
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return ErrOrderNotFound
+	}
+	return nil
+}
+
+func (s *MongoOrderStore) AddRefund(ctx context.Context, orderID primitive.ObjectID, known int, refund models.Refund) error {
+	return s.inTransaction(ctx, func(sc mongo.SessionContext) error {
+		filter := bson.M{"_id": orderID}
+		if known == 0 {
+			filter["refunds"] = bson.M{"$exists": false}
+		} else {
+			filter["refunds"] = bson.M{"$size": known}
+		}
+		restock := restockedLines(refund)
+		if len(restock) > 0 {
+			// Stock already went back with the reservation
+			filter["reservation.status"] = bson.M{"$ne": models.ReservationReleased}
+		}
+
+		result, err := s.coll.UpdateOne(sc, filter, bson.M{"$push": bson.M{"refunds": refund}})
+		if err != nil {
+			return err
+		}
+		if result.MatchedCount == 0 {
+			return ErrRefundsChanged
+		}
+		return s.adjustStock(sc, restock, 1)
+	})
+}
+
+func (s *MongoOrderStore) CompleteRefund(ctx context.Context, orderID, refundID primitive.ObjectID, reference string) error {
+	result, err := s.coll.UpdateOne(
+		ctx,
+		bson.M{"_id": orderID, "refunds._id": refundID},
+		bson.M{"$set": bson.M{
+			"refunds.$.status":    models.RefundCompleted,
+			"refunds.$.reference": reference,
+		}},
+	)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return ErrRefundNotFound
+	}
+	return nil
+}
+
+func (s *MongoOrderStore) PendingRefunds(ctx context.Context) ([]primitive.ObjectID, error) {
+	return s.findIDs(ctx, bson.M{"refunds.status": models.RefundPending})
+}
+
+// findIDs lists the IDs of the orders matching filter
+func (s *MongoOrderStore) findIDs(ctx context.Context, filter bson.M) ([]primitive.ObjectID, error) {
+	cursor, err := s.coll.Find(ctx, filter, options.Find().SetProjection(bson.M{"_id": 1}))
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var ids []primitive.ObjectID
+	for cursor.Next(ctx) {
+		var doc struct {
+			ID primitive.ObjectID `bson:"_id"`
+		}
+		if err := cursor.Decode(&doc); err != nil {
+			return nil, err
+		}
+		ids = append(ids, doc.ID)
+	}
+	return ids, cursor.Err()
+}
+
+func (s *MongoOrderStore) ListByUser(ctx context.Context, userID string, filter OrderFilter) ([]models.Order, int64, error) {
+	query := bson.M{"user_id": userID}
+	if filter.Status != "" {
+		query["status"] = filter.Status
+	}
+	orderedAt := bson.M{}
+	if !filter.From.IsZero() {
+		orderedAt["$gte"] = filter.From
+	}
+	if !filter.To.IsZero() {
+		orderedAt["$lt"] = filter.To
+	}
+	if len(orderedAt) > 0 {
+		query["ordered_at"] = orderedAt
+	}
+
+	total, err := s.coll.CountDocuments(ctx, query)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	opts := options.Find().
+		SetSort(bson.D{{Key: "ordered_at", Value: -1}}).
+		SetSkip(filter.Skip)
+	if filter.Limit > 0 {
+		opts.SetLimit(filter.Limit)
+	}
+
+	cursor, err := s.coll.Find(ctx, query, opts)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer cursor.Close(ctx)
+
+	orders := []models.Order{}
+	if err := cursor.All(ctx, &orders); err != nil {
+		return nil, 0, err
+	}
+	return orders, total, nil
+}
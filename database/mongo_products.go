@@ -0,0 +1,163 @@
+package database
+
+import (
+	"context"
+	"regexp"
+	"time"
+
+	"github.com/nerokome/econo/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// MongoProductStore is the ProductStore backed by the products collection
+type MongoProductStore struct {
+	coll *mongo.Collection
+}
+
+func NewMongoProductStore(coll *mongo.Collection) *MongoProductStore {
+	return &MongoProductStore{coll: coll}
+}
+
+func (s *MongoProductStore) Create(ctx context.Context, product *models.Product) error {
+	_, err := s.coll.InsertOne(ctx, product)
+	return err
+}
+
+func (s *MongoProductStore) FindByID(ctx context.Context, productID primitive.ObjectID) (*models.Product, error) {
+	var product models.Product
+	err := s.coll.FindOne(ctx, bson.M{"_id": productID}).Decode(&product)
+	if err == mongo.ErrNoDocuments {
+		return nil, ErrProductNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &product, nil
+}
+
+func (s *MongoProductStore) FindByIDs(ctx context.Context, productIDs []primitive.ObjectID) ([]models.Product, error) {
+	cursor, err := s.coll.Find(ctx, bson.M{"_id": bson.M{"$in": productIDs}})
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	products := []models.Product{}
+	if err := cursor.All(ctx, &products); err != nil {
+		return nil, ErrorCantDecodeProducts
+	}
+	return products, nil
+}
+
+func (s *MongoProductStore) List(ctx context.Context, filter ProductFilter) ([]models.Product, error) {
+	query := bson.M{}
+	if !filter.IncludeDeleted {
+		query["deleted_at"] = nil
+	}
+	if filter.Query != "" {
+		query["product_name"] = bson.M{"$regex": regexp.QuoteMeta(filter.Query), "$options": "i"}
+	}
+
+	cursor, err := s.coll.Find(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	products := []models.Product{}
+	if err := cursor.All(ctx, &products); err != nil {
+		return nil, ErrorCantDecodeProducts
+	}
+	return products, nil
+}
+
+func (s *MongoProductStore) Update(ctx context.Context, productID primitive.ObjectID, update ProductUpdate) (*models.Product, error) {
+	set := bson.M{
+		"updated_at": time.Now(),
+		"updated_by": update.UpdatedBy,
+	}
+	if update.Name != nil {
+		set["product_name"] = *update.Name
+	}
+	if update.Price != nil {
+		set["price"] = *update.Price
+	}
+	if update.Rating != nil {
+		set["rating"] = *update.Rating
+	}
+	if update.ImageURL != nil {
+		set["image_url"] = *update.ImageURL
+	}
+	if update.Category != nil {
+		set["category"] = *update.Category
+	}
+	if update.MaxPerOrder != nil {
+		set["max_per_order"] = *update.MaxPerOrder
+	}
+	if update.WeightGrams != nil {
+		set["weight_grams"] = *update.WeightGrams
+	}
+	if update.Stock != nil {
+		set["stock"] = *update.Stock
+	}
+
+	var product models.Product
+	err := s.coll.FindOneAndUpdate(
+		ctx,
+		bson.M{"_id": productID, "deleted_at": nil},
+		bson.M{"$set": set},
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(&product)
+
+	if err == mongo.ErrNoDocuments {
+		return nil, ErrProductNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &product, nil
+}
+
+func (s *MongoProductStore) SoftDelete(ctx context.Context, productID primitive.ObjectID, deletedBy string) error {
+	now := time.Now()
+	result, err := s.coll.UpdateOne(
+		ctx,
+		bson.M{"_id": productID, "deleted_at": nil},
+		bson.M{"$set": bson.M{
+			"deleted_at": now,
+			"updated_at": now,
+			"updated_by": deletedBy,
+		}},
+	)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return ErrProductNotFound
+	}
+	return nil
+}
+
+func (s *MongoProductStore) Restore(ctx context.Context, productID primitive.ObjectID, restoredBy string) error {
+	result, err := s.coll.UpdateOne(
+		ctx,
+		bson.M{"_id": productID, "deleted_at": bson.M{"$ne": nil}},
+		bson.M{
+			"$unset": bson.M{"deleted_at": ""},
+			"$set": bson.M{
+				"updated_at": time.Now(),
+				"updated_by": restoredBy,
+			},
+		},
+	)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return ErrProductNotFound
+	}
+	return nil
+}
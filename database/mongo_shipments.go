@@ -0,0 +1,127 @@
+package database
+
+import (
+	"context"
+	"strings"
+
+	"github.com/nerokome/econo/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// shipmentSequenceIndex names the index keeping shipment sequences unique per order
+const shipmentSequenceIndex = "order_sequence"
+
+// MongoShipmentStore is the ShipmentStore backed by the shipments collection
+type MongoShipmentStore struct {
+	coll *mongo.Collection
+}
+
+func NewMongoShipmentStore(coll *mongo.Collection) *MongoShipmentStore {
+	return &MongoShipmentStore{coll: coll}
+}
+
+/*
+EnsureIndexes keeps tracking numbers unique per carrier and sequences unique per
+order, and backs listing an order's shipments
+*/
+func (s *MongoShipmentStore) EnsureIndexes(ctx context.Context) error {
+	_, err := s.coll.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "carrier", Value: 1}, {Key: "tracking_number", Value: 1}},
+			Options: options.Index().SetUnique(true),
+		},
+		{
+			// Shipments from before sequences were kept have none and are left out
+			Keys: bson.D{{Key: "order_id", Value: 1}, {Key: "sequence", Value: 1}},
+			Options: options.Index().
+				SetUnique(true).
+				SetName(shipmentSequenceIndex).
+				SetPartialFilterExpression(bson.M{"sequence": bson.M{"$gt": 0}}),
+		},
+		{
+			Keys: bson.D{{Key: "order_id", Value: 1}, {Key: "created_at", Value: 1}},
+		},
+	})
+	return err
+}
+
+func (s *MongoShipmentStore) Create(ctx context.Context, shipment *models.Shipment) error {
+	_, err := s.coll.InsertOne(ctx, shipment)
+	if mongo.IsDuplicateKeyError(err) {
+		// The error names the unique index the shipment ran into
+		if strings.Contains(err.Error(), shipmentSequenceIndex) {
+			return ErrShipmentsChanged
+		}
+		return ErrTrackingNumberTaken
+	}
+	return err
+}
+
+func (s *MongoShipmentStore) findOne(ctx context.Context, filter bson.M) (*models.Shipment, error) {
+	var shipment models.Shipment
+	err := s.coll.FindOne(ctx, filter).Decode(&shipment)
+	if err == mongo.ErrNoDocuments {
+		return nil, ErrShipmentNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &shipment, nil
+}
+
+func (s *MongoShipmentStore) FindByID(ctx context.Context, shipmentID primitive.ObjectID) (*models.Shipment, error) {
+	return s.findOne(ctx, bson.M{"_id": shipmentID})
+}
+
+func (s *MongoShipmentStore) FindByTracking(ctx context.Context, carrier, trackingNumber string) (*models.Shipment, error) {
+	return s.findOne(ctx, bson.M{"carrier": carrier, "tracking_number": trackingNumber})
+}
+
+func (s *MongoShipmentStore) ListByOrder(ctx context.Context, orderID primitive.ObjectID) ([]models.Shipment, error) {
+	cursor, err := s.coll.Find(ctx, bson.M{"order_id": orderID}, options.Find().SetSort(bson.D{{Key: "created_at", Value: 1}}))
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	shipments := []models.Shipment{}
+	if err := cursor.All(ctx, &shipments); err != nil {
+		return nil, err
+	}
+	return shipments, nil
+}
+
+func (s *MongoShipmentStore) AddEvent(ctx context.Context, shipmentID primitive.ObjectID, known int, event models.TrackingEvent, status string) error {
+	result, err := s.coll.UpdateOne(
+		ctx,
+		bson.M{"_id": shipmentID, "events": bson.M{"$size": known}},
+		bson.M{
+			"$push": bson.M{"events": event},
+			"$set":  bson.M{"status": status},
+		},
+	)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		if _, err := s.FindByID(ctx, shipmentID); err != nil {
+			return err
+		}
+		return ErrShipmentChanged
+	}
+	return nil
+}
+
+func (s *MongoShipmentStore) Delete(ctx context.Context, shipmentID primitive.ObjectID) error {
+	result, err := s.coll.DeleteOne(ctx, bson.M{"_id": shipmentID})
+	if err != nil {
+		return err
+	}
+	if result.DeletedCount == 0 {
+		return ErrShipmentNotFound
+	}
+	return nil
+}
@@ -0,0 +1,107 @@
+package database
+
+import (
+	"context"
+	"time"
+
+	"github.com/nerokome/econo/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// MongoShippingRateStore is the ShippingRateStore backed by the shipping_rates collection
+type MongoShippingRateStore struct {
+	coll *mongo.Collection
+}
+
+func NewMongoShippingRateStore(coll *mongo.Collection) *MongoShippingRateStore {
+	return &MongoShippingRateStore{coll: coll}
+}
+
+func (s *MongoShippingRateStore) Create(ctx context.Context, rate *models.ShippingRate) error {
+	_, err := s.coll.InsertOne(ctx, rate)
+	return err
+}
+
+func (s *MongoShippingRateStore) List(ctx context.Context) ([]models.ShippingRate, error) {
+	cursor, err := s.coll.Find(ctx, bson.M{}, options.Find().SetSort(bson.D{{Key: "created_at", Value: 1}}))
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	rates := []models.ShippingRate{}
+	if err := cursor.All(ctx, &rates); err != nil {
+		return nil, err
+	}
+	return rates, nil
+}
+
+func (s *MongoShippingRateStore) Update(ctx context.Context, rateID primitive.ObjectID, update ShippingRateUpdate) (*models.ShippingRate, error) {
+	set := bson.M{
+		"updated_at": time.Now(),
+		"updated_by": update.UpdatedBy,
+	}
+	if update.Method != nil {
+		set["method"] = *update.Method
+	}
+	if update.Name != nil {
+		set["name"] = *update.Name
+	}
+	if update.Pincodes != nil {
+		set["pincodes"] = *update.Pincodes
+	}
+	if update.MinWeightGrams != nil {
+		set["min_weight_grams"] = *update.MinWeightGrams
+	}
+	if update.MaxWeightGrams != nil {
+		set["max_weight_grams"] = *update.MaxWeightGrams
+	}
+	if update.MinCartValue != nil {
+		set["min_cart_value"] = *update.MinCartValue
+	}
+	if update.Cost != nil {
+		set["cost"] = *update.Cost
+	}
+	if update.PerKg != nil {
+		set["per_kg"] = *update.PerKg
+	}
+	if update.FreeAbove != nil {
+		set["free_above"] = *update.FreeAbove
+	}
+	if update.EstimatedDays != nil {
+		set["estimated_days"] = *update.EstimatedDays
+	}
+	if update.Active != nil {
+		set["active"] = *update.Active
+	}
+
+	var rate models.ShippingRate
+	err := s.coll.FindOneAndUpdate(
+		ctx,
+		bson.M{"_id": rateID},
+		bson.M{"$set": set},
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(&rate)
+
+	if err == mongo.ErrNoDocuments {
+		return nil, ErrShippingRateNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &rate, nil
+}
+
+func (s *MongoShippingRateStore) Delete(ctx context.Context, rateID primitive.ObjectID) error {
+	result, err := s.coll.DeleteOne(ctx, bson.M{"_id": rateID})
+	if err != nil {
+		return err
+	}
+	if result.DeletedCount == 0 {
+		return ErrShippingRateNotFound
+	}
+	return nil
+}
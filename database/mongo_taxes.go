@@ -0,0 +1,95 @@
+package database
+
+import (
+	"context"
+	"time"
+
+	"github.com/nerokome/econo/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// MongoTaxRuleStore is the TaxRuleStore backed by the tax_rules collection
+type MongoTaxRuleStore struct {
+	coll *mongo.Collection
+}
+
+func NewMongoTaxRuleStore(coll *mongo.Collection) *MongoTaxRuleStore {
+	return &MongoTaxRuleStore{coll: coll}
+}
+
+func (s *MongoTaxRuleStore) Create(ctx context.Context, rule *models.TaxRule) error {
+	_, err := s.coll.InsertOne(ctx, rule)
+	return err
+}
+
+func (s *MongoTaxRuleStore) List(ctx context.Context) ([]models.TaxRule, error) {
+	cursor, err := s.coll.Find(ctx, bson.M{}, options.Find().SetSort(bson.D{{Key: "created_at", Value: 1}}))
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	rules := []models.TaxRule{}
+	if err := cursor.All(ctx, &rules); err != nil {
+		return nil, err
+	}
+	return rules, nil
+}
+
+func (s *MongoTaxRuleStore) Update(ctx context.Context, ruleID primitive.ObjectID, update TaxRuleUpdate) (*models.TaxRule, error) {
+	set := bson.M{
+		"updated_at": time.Now(),
+		"updated_by": update.UpdatedBy,
+	}
+	if update.Name != nil {
+		set["name"] = *update.Name
+	}
+	if update.City != nil {
+		set["city"] = *update.City
+	}
+	if update.Pincode != nil {
+		set["pincode"] = *update.Pincode
+	}
+	if update.Category != nil {
+		set["category"] = *update.Category
+	}
+	if update.Rate != nil {
+		set["rate"] = *update.Rate
+	}
+	if update.Inclusive != nil {
+		set["inclusive"] = *update.Inclusive
+	}
+	if update.Active != nil {
+		set["active"] = *update.Active
+	}
+
+	var rule models.TaxRule
+	err := s.coll.FindOneAndUpdate(
+		ctx,
+		bson.M{"_id": ruleID},
+		bson.M{"$set": set},
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(&rule)
+
+	if err == mongo.ErrNoDocuments {
+		return nil, ErrTaxRuleNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &rule, nil
+}
+
+func (s *MongoTaxRuleStore) Delete(ctx context.Context, ruleID primitive.ObjectID) error {
+	result, err := s.coll.DeleteOne(ctx, bson.M{"_id": ruleID})
+	if err != nil {
+		return err
+	}
+	if result.DeletedCount == 0 {
+		return ErrTaxRuleNotFound
+	}
+	return nil
+}
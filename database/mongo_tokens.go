@@ -0,0 +1,82 @@
+package database
+
+import (
+	"context"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// MongoTokenStore is the TokenStore backed by the revoked_tokens collection. A
+// user's cutoff is kept in the same collection under userCutoffID.
+type MongoTokenStore struct {
+	coll *mongo.Collection
+}
+
+func NewMongoTokenStore(coll *mongo.Collection) *MongoTokenStore {
+	return &MongoTokenStore{coll: coll}
+}
+
+/*
+EnsureIndexes lets Mongo drop revocation entries once the token would have expired anyway
+*/
+func (s *MongoTokenStore) EnsureIndexes(ctx context.Context) error {
+	_, err := s.coll.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "expires_at", Value: 1}},
+		Options: options.Index().SetExpireAfterSeconds(0),
+	})
+	return err
+}
+
+func (s *MongoTokenStore) Revoke(ctx context.Context, jti string, expiresAt time.Time) error {
+	_, err := s.coll.UpdateOne(
+		ctx,
+		bson.M{"_id": jti},
+		bson.M{"$set": bson.M{
+			"expires_at": expiresAt,
+			"revoked_at": time.Now(),
+		}},
+		options.Update().SetUpsert(true),
+	)
+	return err
+}
+
+// userCutoffID is the ID of a user's cutoff, which can't clash with a jti
+func userCutoffID(userID string) string {
+	return "user:" + userID
+}
+
+/*
+The cutoff is stored in microseconds, the precision tokens carry their iat in.
+A Mongo date only keeps milliseconds, which would let a token issued just before
+the cutoff through.
+*/
+
+func (s *MongoTokenStore) RevokeIssuedBefore(ctx context.Context, userID string, before, expiresAt time.Time) error {
+	_, err := s.coll.UpdateOne(
+		ctx,
+		bson.M{"_id": userCutoffID(userID)},
+		bson.M{
+			"$max": bson.M{
+				"revoked_before_us": before.UnixMicro(),
+				"expires_at":        expiresAt,
+			},
+			"$set": bson.M{"revoked_at": time.Now()},
+		},
+		options.Update().SetUpsert(true),
+	)
+	return err
+}
+
+func (s *MongoTokenStore) IsRevoked(ctx context.Context, jti, userID string, issuedAt time.Time) (bool, error) {
+	count, err := s.coll.CountDocuments(ctx, bson.M{"$or": bson.A{
+		bson.M{"_id": jti},
+		bson.M{"_id": userCutoffID(userID), "revoked_before_us": bson.M{"$gte": issuedAt.UnixMicro()}},
+	}})
+	if err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
@@ -0,0 +1,355 @@
+package database
+
+import (
+	"context"
+	"time"
+
+	"github.com/nerokome/econo/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// MongoUserStore is the UserStore backed by the users collection
+type MongoUserStore struct {
+	coll *mongo.Collection
+}
+
+func NewMongoUserStore(coll *mongo.Collection) *MongoUserStore {
+	return &MongoUserStore{coll: coll}
+}
+
+/*
+EnsureIndexes keeps emails unique
+*/
+func (s *MongoUserStore) EnsureIndexes(ctx context.Context) error {
+	_, err := s.coll.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "email", Value: 1}},
+		Options: options.Index().SetUnique(true),
+	})
+	return err
+}
+
+func (s *MongoUserStore) Create(ctx context.Context, user *models.User) error {
+	_, err := s.coll.InsertOne(ctx, user)
+	if mongo.IsDuplicateKeyError(err) {
+		return ErrEmailTaken
+	}
+	return err
+}
+
+func (s *MongoUserStore) find(ctx context.Context, filter bson.M) (*models.User, error) {
+	var user models.User
+	err := s.coll.FindOne(ctx, filter).Decode(&user)
+	if err == mongo.ErrNoDocuments {
+		return nil, ErrUserNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+func (s *MongoUserStore) FindByID(ctx context.Context, userID string) (*models.User, error) {
+	return s.find(ctx, bson.M{"user_id": userID})
+}
+
+func (s *MongoUserStore) FindByEmail(ctx context.Context, email string) (*models.User, error) {
+	return s.find(ctx, bson.M{"email": email})
+}
+
+// update applies an update to a single user, mapping a missed filter to notFound
+func (s *MongoUserStore) update(ctx context.Context, filter, update bson.M, notFound error) error {
+	result, err := s.coll.UpdateOne(ctx, filter, update)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return notFound
+	}
+	return nil
+}
+
+/*
+changeRoles runs fn in a transaction that also writes a guard document shared by
+every role change. Two changes that both check how many admins there are then
+conflict, and the one retried sees the other's result instead of a stale count.
+*/
+func (s *MongoUserStore) changeRoles(ctx context.Context, fn func(sc mongo.SessionContext) error) error {
+	session, err := s.coll.Database().Client().StartSession()
+	if err != nil {
+		return err
+	}
+	defer session.EndSession(ctx)
+
+	_, err = session.WithTransaction(ctx, func(sc mongo.SessionContext) (interface{}, error) {
+		_, err := s.coll.Database().Collection("role_changes").UpdateOne(
+			sc,
+			bson.M{"_id": "roles"},
+			bson.M{"$set": bson.M{"changed_at": time.Now()}},
+			options.Update().SetUpsert(true),
+		)
+		if err != nil {
+			return nil, err
+		}
+		return nil, fn(sc)
+	})
+	return err
+}
+
+// setRole sets the user's role within changeRoles
+func (s *MongoUserStore) setRole(sc mongo.SessionContext, userID, role string) error {
+	return s.update(
+		sc,
+		bson.M{"user_id": userID},
+		bson.M{"$set": bson.M{"role": role, "updated_at": time.Now()}},
+		ErrUserNotFound,
+	)
+}
+
+func (s *MongoUserStore) SetRole(ctx context.Context, userID, role string) error {
+	return s.changeRoles(ctx, func(sc mongo.SessionContext) error {
+		user, err := s.FindByID(sc, userID)
+		if err != nil {
+			return err
+		}
+		if user.EffectiveRole() == models.RoleAdmin && role != models.RoleAdmin {
+			count, err := s.coll.CountDocuments(sc, bson.M{"role": models.RoleAdmin})
+			if err != nil {
+				return err
+			}
+			if count <= 1 {
+				return ErrLastAdmin
+			}
+		}
+		return s.setRole(sc, userID, role)
+	})
+}
+
+func (s *MongoUserStore) PromoteFirstAdmin(ctx context.Context, userID string) error {
+	return s.changeRoles(ctx, func(sc mongo.SessionContext) error {
+		count, err := s.coll.CountDocuments(sc, bson.M{"role": models.RoleAdmin})
+		if err != nil {
+			return err
+		}
+		if count > 0 {
+			return ErrAdminExists
+		}
+		return s.setRole(sc, userID, models.RoleAdmin)
+	})
+}
+
+func (s *MongoUserStore) AddSession(ctx context.Context, userID, accessToken, refreshToken string, maxSessions int) error {
+	return s.update(
+		ctx,
+		bson.M{"user_id": userID},
+		bson.M{
+			"$push": bson.M{
+				"tokens":         bson.M{"$each": bson.A{accessToken}, "$slice": -maxSessions},
+				"refresh_tokens": bson.M{"$each": bson.A{refreshToken}, "$slice": -maxSessions},
+			},
+			"$set": bson.M{"updated_at": time.Now()},
+		},
+		ErrUserNotFound,
+	)
+}
+
+func (s *MongoUserStore) RotateRefreshToken(ctx context.Context, userID, oldRefresh, newRefresh, newAccess string, maxSessions int) error {
+	return s.update(
+		ctx,
+		bson.M{"user_id": userID, "refresh_tokens": oldRefresh},
+		bson.M{
+			"$set": bson.M{
+				"refresh_tokens.$": newRefresh,
+				"updated_at":       time.Now(),
+			},
+			"$push": bson.M{
+				"tokens": bson.M{"$each": bson.A{newAccess}, "$slice": -maxSessions},
+			},
+		},
+		ErrTokenNotFound,
+	)
+}
+
+func (s *MongoUserStore) SetSessions(ctx context.Context, userID string, tokens, refreshTokens []string) error {
+	return s.update(
+		ctx,
+		bson.M{"user_id": userID},
+		bson.M{"$set": bson.M{
+			"tokens":         tokens,
+			"refresh_tokens": refreshTokens,
+			"updated_at":     time.Now(),
+		}},
+		ErrUserNotFound,
+	)
+}
+
+func (s *MongoUserStore) AddAddress(ctx context.Context, userID string, address models.Address) error {
+	return s.update(
+		ctx,
+		bson.M{"user_id": userID},
+		bson.M{"$push": bson.M{"address_details": address}},
+		ErrUserNotFound,
+	)
+}
+
+func (s *MongoUserStore) UpdateAddress(ctx context.Context, userID string, address models.Address) error {
+	return s.update(
+		ctx,
+		bson.M{
+			"user_id":             userID,
+			"address_details._id": address.ID,
+		},
+		bson.M{
+			"$set": bson.M{
+				"address_details.$.street":  address.Street,
+				"address_details.$.city":    address.City,
+				"address_details.$.pincode": address.Pincode,
+				"address_details.$.house":   address.House,
+			},
+		},
+		ErrAddressNotFound,
+	)
+}
+
+func (s *MongoUserStore) DeleteAddress(ctx context.Context, userID string, addressID primitive.ObjectID) error {
+	return s.update(
+		ctx,
+		bson.M{
+			"user_id":             userID,
+			"address_details._id": addressID,
+		},
+		bson.M{"$pull": bson.M{
+			"address_details": bson.M{"_id": addressID},
+		}},
+		ErrAddressNotFound,
+	)
+}
+
+func (s *MongoUserStore) ChangeCartQuantity(ctx context.Context, userID string, item models.CartItem, delta, max int) (int, error) {
+	bound := bson.M{"$lte": max - delta}
+	if delta < 0 {
+		bound = bson.M{"$gt": -delta}
+	}
+
+	// Fast path: the line exists and stays within bounds after the change
+	result, err := s.coll.UpdateOne(
+		ctx,
+		bson.M{
+			"user_id":   userID,
+			"user_cart": bson.M{"$elemMatch": bson.M{"product_id": item.ProductID, "quantity": bound}},
+		},
+		bson.M{"$inc": bson.M{"user_cart.$.quantity": delta}},
+	)
+	if err != nil {
+		return 0, err
+	}
+	if result.MatchedCount > 0 {
+		return s.cartQuantity(ctx, userID, item.ProductID)
+	}
+
+	current, err := s.cartQuantity(ctx, userID, item.ProductID)
+	if err != nil {
+		return 0, err
+	}
+
+	switch {
+	case delta < 0 && current == 0:
+		return 0, ErrProductNotInCart
+	case delta < 0:
+		return 0, s.RemoveCartProduct(ctx, userID, item.ProductID)
+	case current+delta > max:
+		return current, ErrQuantityLimitExceeded
+	case current > 0:
+		// The line changed between the two reads
+		return current, ErrUnableToUpdateCart
+	}
+
+	item.Quantity = delta
+	result, err = s.coll.UpdateOne(
+		ctx,
+		bson.M{"user_id": userID, "user_cart.product_id": bson.M{"$ne": item.ProductID}},
+		bson.M{"$push": bson.M{"user_cart": item}},
+	)
+	if err != nil {
+		return 0, err
+	}
+	if result.MatchedCount == 0 {
+		return 0, ErrUnableToUpdateCart
+	}
+	return delta, nil
+}
+
+func (s *MongoUserStore) SetCartQuantity(ctx context.Context, userID string, item models.CartItem) error {
+	if item.Quantity <= 0 {
+		return s.RemoveCartProduct(ctx, userID, item.ProductID)
+	}
+
+	result, err := s.coll.UpdateOne(
+		ctx,
+		bson.M{"user_id": userID, "user_cart.product_id": item.ProductID},
+		bson.M{"$set": bson.M{"user_cart.$.quantity": item.Quantity}},
+	)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount > 0 {
+		return nil
+	}
+
+	return s.update(
+		ctx,
+		bson.M{"user_id": userID, "user_cart.product_id": bson.M{"$ne": item.ProductID}},
+		bson.M{"$push": bson.M{"user_cart": item}},
+		ErrUnableToUpdateCart,
+	)
+}
+
+func (s *MongoUserStore) RemoveCartProduct(ctx context.Context, userID string, productID primitive.ObjectID) error {
+	return s.update(
+		ctx,
+		bson.M{"user_id": userID},
+		bson.M{"$pull": bson.M{"user_cart": bson.M{"product_id": productID}}},
+		ErrUserNotFound,
+	)
+}
+
+func (s *MongoUserStore) ClearCart(ctx context.Context, userID string) error {
+	return s.update(
+		ctx,
+		bson.M{"user_id": userID},
+		bson.M{"$set": bson.M{"user_cart": []models.CartItem{}}},
+		ErrUserNotFound,
+	)
+}
+
+func (s *MongoUserStore) SetCartCoupon(ctx context.Context, userID, code string) error {
+	update := bson.M{"$set": bson.M{"cart_coupon": code}}
+	if code == "" {
+		update = bson.M{"$unset": bson.M{"cart_coupon": ""}}
+	}
+	return s.update(ctx, bson.M{"user_id": userID}, update, ErrUserNotFound)
+}
+
+func (s *MongoUserStore) Cart(ctx context.Context, userID string) ([]models.CartItem, error) {
+	user, err := s.FindByID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	return user.UserCart, nil
+}
+
+// cartQuantity returns the quantity of a cart line, or zero if there is none
+func (s *MongoUserStore) cartQuantity(ctx context.Context, userID string, productID primitive.ObjectID) (int, error) {
+	cart, err := s.Cart(ctx, userID)
+	if err != nil {
+		return 0, err
+	}
+	for _, line := range cart {
+		if line.ProductID == productID {
+			return line.Quantity, nil
+		}
+	}
+	return 0, nil
+}
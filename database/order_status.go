@@ -0,0 +1,168 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/nerokome/econo/models"
+	"github.com/nerokome/econo/payments"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+var ErrInvalidTransition = errors.New("order cannot move to that status")
+
+/*
+AdvanceOrderStatus moves an order to its next lifecycle state, recording who did it.
+Paying or delivering captures the payment, and paying also confirms the order's stock
+reservation. A capture whose status change loses to one closing the order is refunded.
+Cancelling or a failed payment gives the stock and any coupon uses back and voids a
+payment that was never captured.
+Cancelling or refunding a paid order refunds whatever hasn't been refunded yet.
+These side effects are saved with the status change, so any that fail are retried
+by the sweeper instead of being lost once the order has moved on.
+*/
+func AdvanceOrderStatus(
+	ctx context.Context,
+	orders OrderStore,
+	providers payments.Providers,
+	orderID primitive.ObjectID,
+	status string,
+	by string,
+	note string,
+) (*models.Order, error) {
+
+	order, err := orders.FindByID(ctx, orderID)
+	if err != nil {
+		return nil, err
+	}
+
+	if !order.CanTransition(status) {
+		return nil, ErrInvalidTransition
+	}
+
+	captured := false
+	if status == models.OrderPaid || status == models.OrderDelivered {
+		captured = order.Payment.Status == models.PaymentAuthorized
+		if err := collectPayment(ctx, orders, providers, order); err != nil {
+			return nil, err
+		}
+	}
+
+	change := models.OrderStatusChange{
+		Status: status,
+		At:     time.Now(),
+		By:     by,
+		Note:   note,
+	}
+	if err := orders.UpdateStatus(ctx, orderID, order.Status, change, statusEffects(order.Status, status)); err != nil {
+		if err == ErrStatusChanged && captured {
+			if refundErr := returnLostCapture(ctx, orders, providers, orderID, by); refundErr != nil {
+				return nil, refundErr
+			}
+		}
+		return nil, err
+	}
+
+	return applyEffects(ctx, orders, providers, orderID)
+}
+
+// statusEffects lists the side effects of moving an order from one status to another
+func statusEffects(from, to string) []string {
+	switch to {
+	case models.OrderPaid:
+		return []string{models.EffectConfirmReservation}
+	case models.OrderCancelled, models.OrderPaymentFailed, models.OrderRefunded:
+		// Goods that left the warehouse only go back into stock through a restocking
+		// refund once they are returned, and the coupon stays used
+		if models.Dispatched(from) {
+			return []string{models.EffectVoidPayment, models.EffectRefundRemaining}
+		}
+		return []string{models.EffectReleaseReservation, models.EffectReturnCoupons, models.EffectVoidPayment, models.EffectRefundRemaining}
+	}
+	return nil
+}
+
+// applyEffects carries out the order's pending side effects in order, clearing each
+// once done, and returns the updated order. The first to fail stops the rest, which
+// stay pending for RetryPendingEffects.
+func applyEffects(ctx context.Context, orders OrderStore, providers payments.Providers, orderID primitive.ObjectID) (*models.Order, error) {
+	for {
+		order, err := orders.FindByID(ctx, orderID)
+		if err != nil {
+			return nil, err
+		}
+		if len(order.Effects) == 0 {
+			return order, nil
+		}
+
+		effect := order.Effects[0]
+		if err := applyEffect(ctx, orders, providers, order, effect); err != nil {
+			return nil, err
+		}
+		if err := orders.ClearEffect(ctx, orderID, effect); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// applyEffect carries out one side effect. Each can safely run again after a failure
+// partway through.
+func applyEffect(ctx context.Context, orders OrderStore, providers payments.Providers, order *models.Order, effect string) error {
+	var err error
+	switch effect {
+	case models.EffectConfirmReservation:
+		err = orders.ConfirmReservation(ctx, order.ID)
+	case models.EffectReleaseReservation:
+		err = orders.ReleaseReservation(ctx, order.ID)
+	case models.EffectReturnCoupons:
+		err = orders.ReturnCoupons(ctx, order.ID)
+	case models.EffectVoidPayment:
+		err = voidPayment(ctx, orders, providers, order)
+	case models.EffectRefundRemaining:
+		// Credited to whoever made the status change that called for it
+		change := order.StatusHistory[len(order.StatusHistory)-1]
+		err = refundRemaining(ctx, orders, providers, order, change.By, change.Note)
+	}
+	if err == ErrNotReserved {
+		return nil
+	}
+	return err
+}
+
+/*
+RetryPendingEffects carries out side effects of status changes that failed the first
+time, e.g. a refund the provider turned down while it was unavailable
+*/
+func RetryPendingEffects(ctx context.Context, orders OrderStore, providers payments.Providers) (int, error) {
+	ids, err := orders.PendingEffects(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	retried := 0
+	for _, id := range ids {
+		if _, err := applyEffects(ctx, orders, providers, id); err != nil {
+			log.Println("Order side effect error:", err)
+			continue
+		}
+		retried++
+	}
+	return retried, nil
+}
+
+// returnLostCapture refunds a payment captured for a status change that lost to a
+// concurrent one closing the order, e.g. a cancellation that still saw the payment
+// as authorized. An order that moved on any other way keeps the payment.
+func returnLostCapture(ctx context.Context, orders OrderStore, providers payments.Providers, orderID primitive.ObjectID, by string) error {
+	order, err := orders.FindByID(ctx, orderID)
+	if err != nil {
+		return err
+	}
+	switch order.Status {
+	case models.OrderCancelled, models.OrderPaymentFailed, models.OrderRefunded:
+		return refundRemaining(ctx, orders, providers, order, by, "payment captured after the order was closed")
+	}
+	return nil
+}
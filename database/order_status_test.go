@@ -0,0 +1,281 @@
+package database
+
+import (
+	"context"
+	"testing"
+
+	"github.com/nerokome/econo/models"
+	"github.com/nerokome/econo/payments"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestAdvanceOrderStatus(t *testing.T) {
+	tests := []struct {
+		name        string
+		paymentMode string
+		path        []string
+		next        string
+		wantErr     error
+		wantStock   int
+		wantPayment string
+	}{
+		{
+			name:        "paid order is packed",
+			paymentMode: models.PaymentModeDigital,
+			next:        models.OrderPacked,
+			wantStock:   3,
+			wantPayment: models.PaymentCaptured,
+		},
+		{
+			name:        "cash order is packed before payment",
+			paymentMode: models.PaymentModeCOD,
+			next:        models.OrderPacked,
+			wantStock:   3,
+			wantPayment: models.PaymentAuthorized,
+		},
+		{
+			name:        "cash order is collected on delivery",
+			paymentMode: models.PaymentModeCOD,
+			path:        []string{models.OrderPacked, models.OrderShipped},
+			next:        models.OrderDelivered,
+			wantStock:   3,
+			wantPayment: models.PaymentCaptured,
+		},
+		{
+			name:        "cancelled before shipping restocks",
+			paymentMode: models.PaymentModeCOD,
+			next:        models.OrderCancelled,
+			wantStock:   5,
+			wantPayment: models.PaymentVoided,
+		},
+		{
+			name:        "cancelled after shipping keeps stock out",
+			paymentMode: models.PaymentModeDigital,
+			path:        []string{models.OrderPacked, models.OrderShipped},
+			next:        models.OrderCancelled,
+			wantStock:   3,
+			wantPayment: models.PaymentCaptured,
+		},
+		{
+			name:        "skipping ahead",
+			paymentMode: models.PaymentModeDigital,
+			next:        models.OrderDelivered,
+			wantErr:     ErrInvalidTransition,
+			wantStock:   3,
+			wantPayment: models.PaymentCaptured,
+		},
+		{
+			name:        "leaving a final state",
+			paymentMode: models.PaymentModeCOD,
+			path:        []string{models.OrderCancelled},
+			next:        models.OrderPaid,
+			wantErr:     ErrInvalidTransition,
+			wantStock:   5,
+			wantPayment: models.PaymentVoided,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			f := newFixture(t)
+			product := f.product(t, 500, 5, 3)
+			order := f.mustBuy(t, product.ID, 2, tt.paymentMode, payments.MockTokenApproved)
+
+			for _, status := range tt.path {
+				if _, err := AdvanceOrderStatus(ctx, f.stores.Orders, f.providers, order.ID, status, "admin", ""); err != nil {
+					t.Fatalf("advance to %s: %v", status, err)
+				}
+			}
+
+			_, err := AdvanceOrderStatus(ctx, f.stores.Orders, f.providers, order.ID, tt.next, "admin", "")
+			if err != tt.wantErr {
+				t.Fatalf("err = %v, want %v", err, tt.wantErr)
+			}
+
+			order = f.order(t, order.ID)
+			if tt.wantErr == nil && order.Status != tt.next {
+				t.Errorf("status = %s, want %s", order.Status, tt.next)
+			}
+			if len(order.Effects) != 0 {
+				t.Errorf("effects left pending: %v", order.Effects)
+			}
+			if order.Payment.Status != tt.wantPayment {
+				t.Errorf("payment = %s, want %s", order.Payment.Status, tt.wantPayment)
+			}
+			if got := f.stock(t, product.ID); got != tt.wantStock {
+				t.Errorf("stock = %d, want %d", got, tt.wantStock)
+			}
+		})
+	}
+}
+
+func TestRetryPendingEffects(t *testing.T) {
+	ctx := context.Background()
+	f := newFixture(t)
+	provider := f.flakyDigital()
+	product := f.product(t, 500, 5, 3)
+	order := f.mustBuy(t, product.ID, 2, models.PaymentModeDigital, payments.MockTokenApproved)
+
+	provider.down = true
+	if _, err := CancelOrder(ctx, f.stores.Orders, f.providers, order.ID, f.userID.Hex(), "changed my mind"); err != errProviderDown {
+		t.Fatalf("err = %v, want %v", err, errProviderDown)
+	}
+
+	order = f.order(t, order.ID)
+	if order.Status != models.OrderCancelled {
+		t.Errorf("status = %s, want %s", order.Status, models.OrderCancelled)
+	}
+	if len(order.Effects) != 1 || order.Effects[0] != models.EffectRefundRemaining {
+		t.Errorf("effects = %v, want the refund left", order.Effects)
+	}
+	if got := f.stock(t, product.ID); got != 5 {
+		t.Errorf("stock = %d, want it released before the refund failed", got)
+	}
+
+	// Still failing: the effect stays for the next pass
+	if _, err := RetryPendingEffects(ctx, f.stores.Orders, f.providers); err != nil {
+		t.Fatalf("retry: %v", err)
+	}
+	if order = f.order(t, order.ID); len(order.Effects) != 1 {
+		t.Fatalf("effects = %v, want the refund still pending", order.Effects)
+	}
+
+	provider.down = false
+	retried, err := RetryPendingEffects(ctx, f.stores.Orders, f.providers)
+	if err != nil || retried != 1 {
+		t.Fatalf("retry = %d, %v, want 1 order", retried, err)
+	}
+
+	order = f.order(t, order.ID)
+	if len(order.Effects) != 0 {
+		t.Errorf("effects = %v, want none", order.Effects)
+	}
+	if len(order.Refunds) != 1 {
+		t.Fatalf("refunds = %d, want 1", len(order.Refunds))
+	}
+	refund := order.Refunds[0]
+	if refund.Status != models.RefundCompleted {
+		t.Errorf("refund status = %s, want %s", refund.Status, models.RefundCompleted)
+	}
+	if refund.Amount != order.Payable() {
+		t.Errorf("refund amount = %v, want %v", refund.Amount, order.Payable())
+	}
+	if refund.By != f.userID.Hex() {
+		t.Errorf("refund by = %s, want the customer who cancelled", refund.By)
+	}
+}
+
+func TestCancelOrder(t *testing.T) {
+	tests := []struct {
+		name        string
+		path        []string
+		wantErr     error
+		wantStatus  string
+		wantStock   int
+		wantRefunds int
+	}{
+		{name: "paid", wantStatus: models.OrderCancelled, wantStock: 5, wantRefunds: 1},
+		{name: "packed", path: []string{models.OrderPacked}, wantStatus: models.OrderCancelled, wantStock: 5, wantRefunds: 1},
+		{
+			name:       "shipped",
+			path:       []string{models.OrderPacked, models.OrderShipped},
+			wantErr:    ErrOrderNotCancellable,
+			wantStatus: models.OrderShipped,
+			wantStock:  4,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			f := newFixture(t)
+			product := f.product(t, 500, 5, 3)
+			order := f.mustBuy(t, product.ID, 1, models.PaymentModeDigital, payments.MockTokenApproved)
+
+			for _, status := range tt.path {
+				if _, err := AdvanceOrderStatus(ctx, f.stores.Orders, f.providers, order.ID, status, "admin", ""); err != nil {
+					t.Fatalf("advance to %s: %v", status, err)
+				}
+			}
+
+			_, err := CancelOrder(ctx, f.stores.Orders, f.providers, order.ID, f.userID.Hex(), "changed my mind")
+			if err != tt.wantErr {
+				t.Fatalf("err = %v, want %v", err, tt.wantErr)
+			}
+
+			order = f.order(t, order.ID)
+			if order.Status != tt.wantStatus {
+				t.Errorf("status = %s, want %s", order.Status, tt.wantStatus)
+			}
+			if got := f.stock(t, product.ID); got != tt.wantStock {
+				t.Errorf("stock = %d, want %d", got, tt.wantStock)
+			}
+			if len(order.Refunds) != tt.wantRefunds {
+				t.Fatalf("refunds = %d, want %d", len(order.Refunds), tt.wantRefunds)
+			}
+			if tt.wantRefunds > 0 && order.Refunds[0].Amount != order.Payable() {
+				t.Errorf("refund amount = %v, want %v", order.Refunds[0].Amount, order.Payable())
+			}
+		})
+	}
+}
+
+func TestCancelReturnsCoupon(t *testing.T) {
+	tests := []struct {
+		name     string
+		path     []string
+		wantUsed int
+	}{
+		{name: "cancelled before shipping", wantUsed: 0},
+		{name: "cancelled after shipping", path: []string{models.OrderPacked, models.OrderShipped}, wantUsed: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			f := newFixture(t)
+			product := f.product(t, 500, 5, 3)
+			coupon := &models.Coupon{
+				ID:     primitive.NewObjectID(),
+				Code:   "SAVE10",
+				Type:   models.CouponPercentage,
+				Value:  10,
+				Active: true,
+			}
+			if err := f.stores.Coupons.Create(ctx, coupon); err != nil {
+				t.Fatalf("create coupon: %v", err)
+			}
+
+			order, err := InstantBuy(ctx, f.stores.Users, f.stores.Products, f.stores.Orders, f.stores.Coupons,
+				f.stores.TaxRules, f.stores.Shipping, f.providers, f.userID, product.ID, 1, f.addressID,
+				models.PaymentModeDigital, "", payments.MockTokenApproved, coupon.Code, nil)
+			if err != nil {
+				t.Fatalf("buy: %v", err)
+			}
+			for _, status := range tt.path {
+				if _, err := AdvanceOrderStatus(ctx, f.stores.Orders, f.providers, order.ID, status, "admin", ""); err != nil {
+					t.Fatalf("advance to %s: %v", status, err)
+				}
+			}
+
+			if _, err := AdvanceOrderStatus(ctx, f.stores.Orders, f.providers, order.ID, models.OrderCancelled, "admin", ""); err != nil {
+				t.Fatalf("cancel: %v", err)
+			}
+			if tt.wantUsed == 0 {
+				// A retried effect doesn't give the use back twice
+				if err := f.stores.Orders.ReturnCoupons(ctx, order.ID); err != nil {
+					t.Fatalf("return coupons again: %v", err)
+				}
+			}
+
+			coupon, err = f.stores.Coupons.FindByID(ctx, coupon.ID)
+			if err != nil {
+				t.Fatalf("find coupon: %v", err)
+			}
+			if coupon.UsedCount != tt.wantUsed {
+				t.Errorf("used = %d, want %d", coupon.UsedCount, tt.wantUsed)
+			}
+		})
+	}
+}
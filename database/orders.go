@@ -0,0 +1,291 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/nerokome/econo/models"
+	"github.com/nerokome/econo/payments"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+var (
+	ErrInvalidPaymentMode = errors.New("payment mode must be digital or cod")
+	ErrCartUnavailable    = errors.New("cart contains products that are no longer available")
+	ErrProductNotPriced   = errors.New("product is not priced in the store currency")
+)
+
+/*
+BuyFromCart turns the user's cart into an order, shipping to one of their saved
+addresses, and empties the cart in the same step. The cart's coupon, if any, is
+redeemed, tax and shippingMethod's cost for the address are added and card
+payments are charged with paymentToken straight away. With a non-nil rate the
+customer pays in its currency.
+*/
+func BuyFromCart(
+	ctx context.Context,
+	users UserStore,
+	products ProductStore,
+	orders OrderStore,
+	coupons CouponStore,
+	taxRules TaxRuleStore,
+	shippingRates ShippingRateStore,
+	providers payments.Providers,
+	userID primitive.ObjectID,
+	addressID primitive.ObjectID,
+	paymentMode string,
+	shippingMethod string,
+	paymentToken string,
+	rate *models.ExchangeRate,
+) (*models.Order, error) {
+
+	if !models.ValidPaymentMode(paymentMode) {
+		return nil, ErrInvalidPaymentMode
+	}
+
+	address, err := userAddress(ctx, users, userID, addressID)
+	if err != nil {
+		return nil, err
+	}
+
+	summary, err := cartSummary(ctx, users, products, userID)
+	if err != nil {
+		return nil, err
+	}
+	if len(summary.Items) == 0 {
+		return nil, ErrCartEmpty
+	}
+
+	orderCart := make([]models.ProductUser, 0, len(summary.Items))
+	for _, line := range summary.Items {
+		if line.Unavailable {
+			return nil, ErrCartUnavailable
+		}
+		if line.OutOfStock {
+			return nil, ErrInsufficientQuantity
+		}
+		item := line.Product
+		item.Quantity = line.Quantity
+		orderCart = append(orderCart, item)
+	}
+
+	coupon, err := cartCoupon(ctx, users, coupons, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	order := newOrder(userID, orderCart, summary.Total, paymentMode, *address)
+	order.ExchangeRate = rate
+
+	return checkout(ctx, orders, coupons, taxRules, shippingRates, providers, order, coupon, shippingMethod, paymentToken, true, ErrOrderCreationFailed)
+}
+
+/*
+checkout prices and redeems the coupon, adds tax and shipping, authorizes the
+payment, places the order and, for card payments, captures it. Nothing is saved
+and the coupon use is given back if the card is declined. An order whose capture
+fails is cancelled again so its stock and coupon use go back. A capture the
+gateway confirms later leaves the order pending payment until its webhook arrives.
+*/
+func checkout(
+	ctx context.Context,
+	orders OrderStore,
+	coupons CouponStore,
+	taxRules TaxRuleStore,
+	shippingRates ShippingRateStore,
+	providers payments.Providers,
+	order *models.Order,
+	coupon *models.Coupon,
+	shippingMethod string,
+	paymentToken string,
+	clearCart bool,
+	placeErr error,
+) (*models.Order, error) {
+
+	if err := couponDiscount(order, coupon); err != nil {
+		return nil, err
+	}
+	if err := orderTax(ctx, taxRules, order); err != nil {
+		return nil, err
+	}
+	if err := orderShipping(ctx, shippingRates, order, shippingMethod); err != nil {
+		return nil, err
+	}
+	// Checked once here, so converting the charge or a part of it later can't overflow
+	if order.ExchangeRate != nil {
+		if _, err := order.ExchangeRate.CheckedConvert(order.Payable()); err != nil {
+			return nil, ErrOrderTooLarge
+		}
+	}
+	if coupon != nil {
+		if err := coupons.Redeem(ctx, coupon, order.UserID); err != nil {
+			return nil, err
+		}
+	}
+	unredeem := func() {
+		if coupon == nil {
+			return
+		}
+		if err := coupons.Unredeem(ctx, coupon.ID, order.UserID); err != nil {
+			log.Println("Unredeem coupon error:", err)
+		}
+	}
+
+	if err := authorizePayment(ctx, providers, order, paymentToken); err != nil {
+		unredeem()
+		return nil, err
+	}
+
+	if err := orders.PlaceOrder(ctx, order, clearCart); err != nil {
+		unredeem()
+		if voidErr := voidPayment(ctx, orders, providers, order); voidErr != nil && voidErr != ErrOrderNotFound {
+			log.Println("Void payment error:", voidErr)
+		}
+		if err == ErrInsufficientQuantity {
+			return nil, err
+		}
+		return nil, placeErr
+	}
+
+	if order.PaymentMode != models.PaymentModeDigital {
+		return order, nil
+	}
+
+	paid, err := AdvanceOrderStatus(ctx, orders, providers, order.ID, models.OrderPaid, "system", "card payment captured")
+	if err == ErrPaymentPending {
+		return orders.FindByID(ctx, order.ID)
+	}
+	if err != nil {
+		if _, cancelErr := AdvanceOrderStatus(ctx, orders, providers, order.ID, models.OrderCancelled, "system", "card payment failed"); cancelErr != nil {
+			log.Println("Cancel unpaid order error:", cancelErr)
+		}
+		return nil, ErrPaymentFailed
+	}
+	return paid, nil
+}
+
+// newOrder starts an order awaiting payment
+func newOrder(
+	userID primitive.ObjectID,
+	orderCart []models.ProductUser,
+	price models.Money,
+	paymentMode string,
+	address models.Address,
+) *models.Order {
+
+	now := time.Now()
+	return &models.Order{
+		ID:          primitive.NewObjectID(),
+		UserID:      userID.Hex(),
+		OrderCart:   orderCart,
+		OrderedAt:   now,
+		Price:       price,
+		Discount:    models.NewMoney(0, price.Currency),
+		Tax:         models.NewMoney(0, price.Currency),
+		PaymentMode: paymentMode,
+		Address:     address,
+		Reservation: newReservation(paymentMode),
+		Status:      models.OrderPendingPayment,
+		StatusHistory: []models.OrderStatusChange{{
+			Status: models.OrderPendingPayment,
+			At:     now,
+			By:     userID.Hex(),
+		}},
+	}
+}
+
+// userAddress finds one of the user's saved addresses
+func userAddress(ctx context.Context, users UserStore, userID, addressID primitive.ObjectID) (*models.Address, error) {
+	user, err := users.FindByID(ctx, userID.Hex())
+	if err != nil {
+		return nil, ErrUserIdIsnotValid
+	}
+	for _, a := range user.AddressDetails {
+		if a.ID == addressID {
+			return &a, nil
+		}
+	}
+	return nil, ErrAddressNotFound
+}
+
+/*
+InstantBuy orders a single product at its catalog price without touching the cart.
+An optional coupon code is redeemed against just this order, and a non-nil rate
+has the customer pay in its currency.
+*/
+func InstantBuy(
+	ctx context.Context,
+	users UserStore,
+	products ProductStore,
+	orders OrderStore,
+	coupons CouponStore,
+	taxRules TaxRuleStore,
+	shippingRates ShippingRateStore,
+	providers payments.Providers,
+	userID primitive.ObjectID,
+	productID primitive.ObjectID,
+	quantity int,
+	addressID primitive.ObjectID,
+	paymentMode string,
+	shippingMethod string,
+	paymentToken string,
+	couponCode string,
+	rate *models.ExchangeRate,
+) (*models.Order, error) {
+
+	if !models.ValidPaymentMode(paymentMode) {
+		return nil, ErrInvalidPaymentMode
+	}
+
+	var coupon *models.Coupon
+	if couponCode != "" {
+		found, err := coupons.FindByCode(ctx, models.NormalizeCouponCode(couponCode))
+		if err != nil {
+			return nil, err
+		}
+		coupon = found
+	}
+
+	product, err := activeProduct(ctx, products, productID)
+	if err != nil {
+		return nil, err
+	}
+	if quantity < 1 {
+		return nil, ErrInvalidQuantity
+	}
+	if quantity > product.QuantityLimit() {
+		return nil, ErrQuantityLimitExceeded
+	}
+	if quantity > product.Stock {
+		return nil, ErrInsufficientQuantity
+	}
+	if product.Price.Currency != models.BaseCurrency() {
+		return nil, ErrProductNotPriced
+	}
+	price, err := product.Price.CheckedMul(int64(quantity))
+	if err != nil || price.Amount > models.MaxAmount {
+		return nil, ErrOrderTooLarge
+	}
+
+	address, err := userAddress(ctx, users, userID, addressID)
+	if err != nil {
+		return nil, err
+	}
+
+	orderCart := []models.ProductUser{{
+		ID:          product.ID,
+		Name:        product.Name,
+		Price:       product.Price,
+		Rating:      product.Rating,
+		ImageURL:    product.ImageURL,
+		Category:    product.Category,
+		WeightGrams: product.WeightGrams,
+		Quantity:    quantity,
+	}}
+	order := newOrder(userID, orderCart, price, paymentMode, *address)
+	order.ExchangeRate = rate
+
+	return checkout(ctx, orders, coupons, taxRules, shippingRates, providers, order, coupon, shippingMethod, paymentToken, false, ErrInstantBuyFailed)
+}
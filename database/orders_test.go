@@ -0,0 +1,163 @@
+package database
+
+import (
+	"context"
+	"testing"
+
+	"github.com/nerokome/econo/models"
+	"github.com/nerokome/econo/payments"
+)
+
+func TestBuyFromCart(t *testing.T) {
+	tests := []struct {
+		name            string
+		paymentMode     string
+		token           string
+		emptyCart       bool
+		wantErr         error
+		wantStatus      string
+		wantReservation string
+		wantStock       int
+		wantCartCleared bool
+	}{
+		{
+			name:            "cash on delivery",
+			paymentMode:     models.PaymentModeCOD,
+			wantStatus:      models.OrderPendingPayment,
+			wantReservation: models.ReservationConfirmed,
+			wantStock:       3,
+			wantCartCleared: true,
+		},
+		{
+			name:            "card captured",
+			paymentMode:     models.PaymentModeDigital,
+			token:           payments.MockTokenApproved,
+			wantStatus:      models.OrderPaid,
+			wantReservation: models.ReservationConfirmed,
+			wantStock:       3,
+			wantCartCleared: true,
+		},
+		{
+			name:        "card declined",
+			paymentMode: models.PaymentModeDigital,
+			token:       payments.MockTokenDeclined,
+			wantErr:     payments.ErrPaymentDeclined,
+			wantStock:   5,
+		},
+		{
+			name:        "capture fails",
+			paymentMode: models.PaymentModeDigital,
+			token:       payments.MockTokenCaptureFails,
+			wantErr:     ErrPaymentFailed,
+			wantStock:   5,
+			// The order was placed before the capture failed
+			wantCartCleared: true,
+		},
+		{
+			name:        "unknown payment mode",
+			paymentMode: "cheque",
+			wantErr:     ErrInvalidPaymentMode,
+			wantStock:   5,
+		},
+		{
+			name:        "empty cart",
+			paymentMode: models.PaymentModeCOD,
+			emptyCart:   true,
+			wantErr:     ErrCartEmpty,
+			wantStock:   5,
+			// Nothing was in it to begin with
+			wantCartCleared: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			f := newFixture(t)
+			product := f.product(t, 500, 5, 3)
+			if !tt.emptyCart {
+				if _, err := ChangeCartQuantity(ctx, f.stores.Users, f.stores.Products, f.userID, product.ID, 2); err != nil {
+					t.Fatalf("fill cart: %v", err)
+				}
+			}
+
+			order, err := BuyFromCart(ctx, f.stores.Users, f.stores.Products, f.stores.Orders, f.stores.Coupons,
+				f.stores.TaxRules, f.stores.Shipping, f.providers, f.userID, f.addressID, tt.paymentMode, "", tt.token, nil)
+			if err != tt.wantErr {
+				t.Fatalf("err = %v, want %v", err, tt.wantErr)
+			}
+			if err == nil {
+				if order.Status != tt.wantStatus {
+					t.Errorf("status = %s, want %s", order.Status, tt.wantStatus)
+				}
+				if order.Reservation.Status != tt.wantReservation {
+					t.Errorf("reservation = %s, want %s", order.Reservation.Status, tt.wantReservation)
+				}
+				if want := models.NewMoney(1000, models.BaseCurrency()); order.Price != want {
+					t.Errorf("price = %v, want %v", order.Price, want)
+				}
+			}
+
+			if got := f.stock(t, product.ID); got != tt.wantStock {
+				t.Errorf("stock = %d, want %d", got, tt.wantStock)
+			}
+			cart, err := f.stores.Users.Cart(ctx, f.userID.Hex())
+			if err != nil {
+				t.Fatalf("cart: %v", err)
+			}
+			if cleared := len(cart) == 0; cleared != tt.wantCartCleared {
+				t.Errorf("cart cleared = %v, want %v", cleared, tt.wantCartCleared)
+			}
+		})
+	}
+}
+
+func TestInstantBuyLimits(t *testing.T) {
+	tests := []struct {
+		name     string
+		quantity int
+		wantErr  error
+	}{
+		{name: "within limits", quantity: 2},
+		{name: "past the per-order limit", quantity: 4, wantErr: ErrQuantityLimitExceeded},
+		{name: "past the stock", quantity: 3, wantErr: ErrInsufficientQuantity},
+		{name: "no units", quantity: 0, wantErr: ErrInvalidQuantity},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := newFixture(t)
+			product := f.product(t, 500, 2, 3)
+
+			_, err := f.buy(product.ID, tt.quantity, models.PaymentModeCOD, "")
+			if err != tt.wantErr {
+				t.Fatalf("err = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestInstantBuyLeavesCart(t *testing.T) {
+	ctx := context.Background()
+	f := newFixture(t)
+	product := f.product(t, 500, 5, 3)
+	if _, err := ChangeCartQuantity(ctx, f.stores.Users, f.stores.Products, f.userID, product.ID, 1); err != nil {
+		t.Fatalf("fill cart: %v", err)
+	}
+
+	order := f.mustBuy(t, product.ID, 2, models.PaymentModeCOD, "")
+	if want := models.NewMoney(1000, models.BaseCurrency()); order.Price != want {
+		t.Errorf("price = %v, want %v", order.Price, want)
+	}
+	if got := f.stock(t, product.ID); got != 3 {
+		t.Errorf("stock = %d, want 3", got)
+	}
+
+	cart, err := f.stores.Users.Cart(ctx, f.userID.Hex())
+	if err != nil {
+		t.Fatalf("cart: %v", err)
+	}
+	if len(cart) != 1 || cart[0].Quantity != 1 {
+		t.Errorf("cart = %v, want the one unit left in it", cart)
+	}
+}
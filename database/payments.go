@@ -0,0 +1,96 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"log"
+
+	"github.com/nerokome/econo/models"
+	"github.com/nerokome/econo/payments"
+)
+
+var (
+	ErrPaymentFailed  = errors.New("payment could not be completed")
+	ErrPaymentPending = errors.New("payment is waiting for the gateway to confirm it")
+)
+
+// authorizePayment asks the order's payment provider to hold the order total, in the
+// currency the order is paid in, and records the result on the order. A declined
+// card fails with payments.ErrPaymentDeclined.
+func authorizePayment(ctx context.Context, providers payments.Providers, order *models.Order, token string) error {
+	provider, err := providers.For(order.PaymentMode)
+	if err != nil {
+		return err
+	}
+
+	payment, err := provider.Authorize(ctx, payments.AuthorizeRequest{
+		OrderID: order.ID,
+		Amount:  order.Charged(order.Payable()),
+		Token:   token,
+	})
+	if err != nil {
+		return err
+	}
+	order.Payment = payment
+	return nil
+}
+
+// collectPayment captures an authorized payment and saves the updated record. It fails
+// with ErrPaymentPending while the gateway has yet to confirm the capture by webhook.
+func collectPayment(ctx context.Context, orders OrderStore, providers payments.Providers, order *models.Order) error {
+	switch order.Payment.Status {
+	case models.PaymentPending:
+		return ErrPaymentPending
+	case models.PaymentAuthorized:
+	default:
+		return nil
+	}
+	provider, err := providers.For(order.PaymentMode)
+	if err != nil {
+		return err
+	}
+
+	payment, err := provider.Capture(ctx, order.Payment)
+	if err != nil {
+		log.Println("Payment capture error:", err)
+		return ErrPaymentFailed
+	}
+	if err := orders.SetPayment(ctx, order.ID, payment); err != nil {
+		return err
+	}
+	if payment.Status == models.PaymentPending {
+		return ErrPaymentPending
+	}
+	return nil
+}
+
+// voidPayment drops an authorization that will never be captured
+func voidPayment(ctx context.Context, orders OrderStore, providers payments.Providers, order *models.Order) error {
+	if order.Payment.Status != models.PaymentAuthorized {
+		return nil
+	}
+	provider, err := providers.For(order.PaymentMode)
+	if err != nil {
+		return err
+	}
+
+	payment, err := provider.Void(ctx, order.Payment)
+	if err != nil {
+		return err
+	}
+	return orders.SetPayment(ctx, order.ID, payment)
+}
+
+// refundPayment gives amount back through the order's provider and returns its
+// reference; key makes a retried call pay out only once. Orders placed before
+// payments were tracked have nothing to call.
+func refundPayment(ctx context.Context, providers payments.Providers, order *models.Order, amount models.Money, key string) (string, error) {
+	if order.Payment.Provider == "" {
+		return "", nil
+	}
+	provider, err := providers.For(order.PaymentMode)
+	if err != nil {
+		return "", err
+	}
+	return provider.Refund(ctx, order.Payment, amount, key)
+}
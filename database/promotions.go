@@ -0,0 +1,197 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/nerokome/econo/models"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+var (
+	ErrCouponNotFound      = errors.New("coupon not found")
+	ErrCouponCodeTaken     = errors.New("coupon code already exists")
+	ErrCouponInactive      = errors.New("coupon is not active")
+	ErrCouponExpired       = errors.New("coupon is not valid at this time")
+	ErrCouponExhausted     = errors.New("coupon has been fully redeemed")
+	ErrCouponUserLimit     = errors.New("coupon usage limit reached for this account")
+	ErrCouponMinCartValue  = errors.New("cart total is below the coupon's minimum")
+	ErrCouponNotApplicable = errors.New("coupon does not apply to any item in the cart")
+	ErrCouponCurrency      = errors.New("coupon amounts are not in the store currency")
+	ErrCouponWindow        = errors.New("starts_at must be before ends_at")
+)
+
+// ValidCouponWindow reports whether a coupon valid from startsAt until endsAt, either
+// of which may be left open, is valid at any time at all
+func ValidCouponWindow(startsAt, endsAt *time.Time) bool {
+	return startsAt == nil || endsAt == nil || startsAt.Before(*endsAt)
+}
+
+/*
+EvaluateCoupon works out what a coupon takes off an order's lines for a user at a
+given time, without redeeming it. The minimum cart value is checked against the
+whole order while the discount only comes off the lines the coupon covers, and is
+split across them in proportion to their subtotals.
+*/
+func EvaluateCoupon(
+	coupon *models.Coupon,
+	userID string,
+	lines []models.ProductUser,
+	now time.Time,
+) (*models.AppliedDiscount, error) {
+
+	if !coupon.Active {
+		return nil, ErrCouponInactive
+	}
+	if !coupon.InWindow(now) {
+		return nil, ErrCouponExpired
+	}
+	if coupon.UsageLimit > 0 && coupon.UsedCount >= coupon.UsageLimit {
+		return nil, ErrCouponExhausted
+	}
+	if coupon.PerUserLimit > 0 && coupon.Redemptions[userID] >= coupon.PerUserLimit {
+		return nil, ErrCouponUserLimit
+	}
+	// Set before the store currency changed
+	base := models.NewMoney(0, models.BaseCurrency())
+	for _, m := range []models.Money{coupon.MinCartValue, coupon.MaxDiscount, coupon.Amount} {
+		if _, err := base.CheckedAdd(m); err != nil {
+			return nil, ErrCouponCurrency
+		}
+	}
+
+	var total, eligible models.Money
+	var covered []models.ProductUser
+	var weights []int64
+	for _, line := range lines {
+		subtotal := line.Price.Mul(int64(line.Quantity))
+		total = total.Add(subtotal)
+		if coupon.Covers(line) {
+			eligible = eligible.Add(subtotal)
+			covered = append(covered, line)
+			weights = append(weights, subtotal.Amount)
+		}
+	}
+	if total.Cmp(coupon.MinCartValue) < 0 {
+		return nil, ErrCouponMinCartValue
+	}
+	if !eligible.IsPositive() {
+		return nil, ErrCouponNotApplicable
+	}
+
+	var amount models.Money
+	switch coupon.Type {
+	case models.CouponPercentage:
+		amount = eligible.Percent(coupon.Value)
+		if coupon.MaxDiscount.IsPositive() {
+			amount = amount.Min(coupon.MaxDiscount)
+		}
+	case models.CouponFixed:
+		amount = coupon.Amount.Min(eligible)
+	}
+
+	applied := &models.AppliedDiscount{
+		CouponID: coupon.ID,
+		Code:     coupon.Code,
+		Type:     coupon.Type,
+		Value:    coupon.Value,
+		Amount:   amount,
+	}
+	for i, share := range amount.Allocate(weights) {
+		applied.Lines = append(applied.Lines, models.DiscountLine{ProductID: covered[i].ID, Amount: share})
+	}
+	return applied, nil
+}
+
+/*
+ApplyCartCoupon checks a coupon against the user's cart and, if it applies, keeps it
+on the cart for checkout. It returns the repriced cart.
+*/
+func ApplyCartCoupon(
+	ctx context.Context,
+	users UserStore,
+	products ProductStore,
+	coupons CouponStore,
+	taxRules TaxRuleStore,
+	userID primitive.ObjectID,
+	code string,
+) (*models.CartSummary, error) {
+
+	coupon, err := coupons.FindByCode(ctx, models.NormalizeCouponCode(code))
+	if err != nil {
+		return nil, err
+	}
+
+	summary, err := cartSummary(ctx, users, products, userID)
+	if err != nil {
+		return nil, err
+	}
+	if len(summary.Items) == 0 {
+		return nil, ErrCartEmpty
+	}
+	if _, err := EvaluateCoupon(coupon, userID.Hex(), purchasableLines(summary), time.Now()); err != nil {
+		return nil, err
+	}
+
+	if err := users.SetCartCoupon(ctx, userID.Hex(), coupon.Code); err != nil {
+		return nil, ErrUnableToUpdateCart
+	}
+	return GetCartSummary(ctx, users, products, coupons, taxRules, userID, primitive.NilObjectID, nil)
+}
+
+/*
+RemoveCartCoupon takes the coupon off the user's cart
+*/
+func RemoveCartCoupon(
+	ctx context.Context,
+	users UserStore,
+	userID primitive.ObjectID,
+) error {
+
+	if err := users.SetCartCoupon(ctx, userID.Hex(), ""); err != nil {
+		return ErrUnableToUpdateCart
+	}
+	return nil
+}
+
+// cartCoupon loads the coupon applied to the user's cart, or nil if there is none
+func cartCoupon(ctx context.Context, users UserStore, coupons CouponStore, userID primitive.ObjectID) (*models.Coupon, error) {
+	user, err := users.FindByID(ctx, userID.Hex())
+	if err != nil {
+		return nil, ErrUserIdIsnotValid
+	}
+	if user.CartCoupon == "" {
+		return nil, nil
+	}
+	return coupons.FindByCode(ctx, user.CartCoupon)
+}
+
+// purchasableLines returns the cart lines that can still be bought, with their quantities
+func purchasableLines(summary *models.CartSummary) []models.ProductUser {
+	var lines []models.ProductUser
+	for _, line := range summary.Items {
+		if line.Unavailable {
+			continue
+		}
+		item := line.Product
+		item.Quantity = line.Quantity
+		lines = append(lines, item)
+	}
+	return lines
+}
+
+// couponDiscount prices a coupon for an order about to be placed and records the
+// result on it. A nil coupon leaves the order alone.
+func couponDiscount(order *models.Order, coupon *models.Coupon) error {
+	if coupon == nil {
+		return nil
+	}
+	applied, err := EvaluateCoupon(coupon, order.UserID, order.OrderCart, order.OrderedAt)
+	if err != nil {
+		return err
+	}
+	order.Discount = applied.Amount
+	order.Discounts = []models.AppliedDiscount{*applied}
+	return nil
+}
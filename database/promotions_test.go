@@ -0,0 +1,177 @@
+package database
+
+import (
+	"testing"
+	"time"
+
+	"github.com/nerokome/econo/models"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestEvaluateCoupon(t *testing.T) {
+	now := time.Now()
+	earlier, later := now.Add(-time.Hour), now.Add(time.Hour)
+	base := models.BaseCurrency()
+	money := func(amount int64) models.Money { return models.NewMoney(amount, base) }
+
+	book, pen := primitive.NewObjectID(), primitive.NewObjectID()
+	// 2000 of books and 500 of stationery
+	lines := []models.ProductUser{
+		{ID: book, Price: money(1000), Category: "books", Quantity: 2},
+		{ID: pen, Price: money(500), Category: "stationery", Quantity: 1},
+	}
+
+	tests := []struct {
+		name string
+		// change adjusts an active, unscoped 10% coupon
+		change    func(c *models.Coupon)
+		wantErr   error
+		want      int64
+		wantLines map[primitive.ObjectID]int64
+	}{
+		{
+			name:      "percentage",
+			change:    func(c *models.Coupon) {},
+			want:      250,
+			wantLines: map[primitive.ObjectID]int64{book: 200, pen: 50},
+		},
+		{
+			name:      "percentage capped",
+			change:    func(c *models.Coupon) { c.MaxDiscount = money(100) },
+			want:      100,
+			wantLines: map[primitive.ObjectID]int64{book: 80, pen: 20},
+		},
+		{
+			name: "fixed",
+			change: func(c *models.Coupon) {
+				c.Type, c.Value, c.Amount = models.CouponFixed, 0, money(300)
+			},
+			want:      300,
+			wantLines: map[primitive.ObjectID]int64{book: 240, pen: 60},
+		},
+		{
+			name: "fixed above what it covers",
+			change: func(c *models.Coupon) {
+				c.Type, c.Value, c.Amount = models.CouponFixed, 0, money(800)
+				c.ProductIDs = []primitive.ObjectID{pen}
+			},
+			want:      500,
+			wantLines: map[primitive.ObjectID]int64{pen: 500},
+		},
+		{
+			name:      "scoped to a product",
+			change:    func(c *models.Coupon) { c.ProductIDs = []primitive.ObjectID{pen} },
+			want:      50,
+			wantLines: map[primitive.ObjectID]int64{pen: 50},
+		},
+		{
+			name:      "scoped to a category",
+			change:    func(c *models.Coupon) { c.Categories = []string{"books"} },
+			want:      200,
+			wantLines: map[primitive.ObjectID]int64{book: 200},
+		},
+		{
+			name:    "scoped to nothing in the order",
+			change:  func(c *models.Coupon) { c.Categories = []string{"toys"} },
+			wantErr: ErrCouponNotApplicable,
+		},
+		{
+			name:   "minimum met exactly",
+			change: func(c *models.Coupon) { c.MinCartValue = money(2500) },
+			want:   250,
+		},
+		{
+			name: "minimum counts lines outside the scope",
+			change: func(c *models.Coupon) {
+				c.MinCartValue = money(2000)
+				c.ProductIDs = []primitive.ObjectID{pen}
+			},
+			want: 50,
+		},
+		{
+			name:    "below the minimum",
+			change:  func(c *models.Coupon) { c.MinCartValue = money(2501) },
+			wantErr: ErrCouponMinCartValue,
+		},
+		{
+			name:   "last use left",
+			change: func(c *models.Coupon) { c.UsageLimit, c.UsedCount = 5, 4 },
+			want:   250,
+		},
+		{
+			name:    "used up",
+			change:  func(c *models.Coupon) { c.UsageLimit, c.UsedCount = 5, 5 },
+			wantErr: ErrCouponExhausted,
+		},
+		{
+			name: "used by other accounts",
+			change: func(c *models.Coupon) {
+				c.PerUserLimit, c.Redemptions = 1, map[string]int{"other": 1}
+			},
+			want: 250,
+		},
+		{
+			name: "used up by this account",
+			change: func(c *models.Coupon) {
+				c.PerUserLimit, c.Redemptions = 1, map[string]int{"user": 1}
+			},
+			wantErr: ErrCouponUserLimit,
+		},
+		{
+			name:    "inactive",
+			change:  func(c *models.Coupon) { c.Active = false },
+			wantErr: ErrCouponInactive,
+		},
+		{
+			name:    "not started",
+			change:  func(c *models.Coupon) { c.StartsAt = &later },
+			wantErr: ErrCouponExpired,
+		},
+		{
+			name:    "ended",
+			change:  func(c *models.Coupon) { c.EndsAt = &earlier },
+			wantErr: ErrCouponExpired,
+		},
+		{
+			name:   "within its window",
+			change: func(c *models.Coupon) { c.StartsAt, c.EndsAt = &earlier, &later },
+			want:   250,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			coupon := &models.Coupon{
+				ID:     primitive.NewObjectID(),
+				Code:   "SAVE10",
+				Type:   models.CouponPercentage,
+				Value:  10,
+				Active: true,
+			}
+			tt.change(coupon)
+
+			applied, err := EvaluateCoupon(coupon, "user", lines, now)
+			if err != tt.wantErr {
+				t.Fatalf("err = %v, want %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+
+			if applied.Amount != money(tt.want) {
+				t.Errorf("amount = %v, want %v", applied.Amount, money(tt.want))
+			}
+			if tt.wantLines == nil {
+				return
+			}
+			if len(applied.Lines) != len(tt.wantLines) {
+				t.Fatalf("lines = %v, want %v", applied.Lines, tt.wantLines)
+			}
+			for _, line := range applied.Lines {
+				if want := money(tt.wantLines[line.ProductID]); line.Amount != want {
+					t.Errorf("line %v = %v, want %v", line.ProductID, line.Amount, want)
+				}
+			}
+		})
+	}
+}
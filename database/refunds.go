@@ -0,0 +1,293 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/nerokome/econo/models"
+	"github.com/nerokome/econo/payments"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+var (
+	ErrOrderNotCancellable = errors.New("order can no longer be cancelled")
+	ErrPaymentNotCollected = errors.New("order has not been paid for")
+	ErrNothingToRefund     = errors.New("nothing left to refund on this order")
+	ErrProductNotInOrder   = errors.New("product is not part of this order")
+	ErrRefundExceedsOrder  = errors.New("refund quantity exceeds what is left on the order")
+)
+
+// RefundItem asks for some units of one order line to be refunded
+type RefundItem struct {
+	ProductID primitive.ObjectID
+	Quantity  int
+}
+
+/*
+CancelOrder cancels an order that hasn't shipped yet. Its stock goes back to the
+catalog and, if it was already paid for, whatever is left of the charge is refunded.
+*/
+func CancelOrder(
+	ctx context.Context,
+	orders OrderStore,
+	providers payments.Providers,
+	orderID primitive.ObjectID,
+	by string,
+	reason string,
+) (*models.Order, error) {
+
+	order, err := orders.FindByID(ctx, orderID)
+	if err != nil {
+		return nil, err
+	}
+	if !order.CanTransition(models.OrderCancelled) || models.Dispatched(order.Status) {
+		return nil, ErrOrderNotCancellable
+	}
+
+	return AdvanceOrderStatus(ctx, orders, providers, orderID, models.OrderCancelled, by, reason)
+}
+
+/*
+RefundOrderLines refunds part of a paid order line by line. With restock set the
+refunded units go back into stock, e.g. for returned goods. Once every unit has been
+refunded the order moves to refunded where its status allows it. Otherwise units
+refunded before they shipped no longer have to ship, so the order moves to the status
+its shipments add up to.
+*/
+func RefundOrderLines(
+	ctx context.Context,
+	orders OrderStore,
+	shipments ShipmentStore,
+	providers payments.Providers,
+	orderID primitive.ObjectID,
+	items []RefundItem,
+	restock bool,
+	by string,
+	reason string,
+) (*models.Order, *models.Refund, error) {
+
+	order, err := orders.FindByID(ctx, orderID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if !order.PaymentCollected() {
+		return nil, nil, ErrPaymentNotCollected
+	}
+	// Earlier payouts that failed go first, so a retry finishes them
+	if err := settleRefunds(ctx, orders, providers, order); err != nil {
+		return nil, nil, err
+	}
+	if order.Status == models.OrderCancelled || order.Status == models.OrderRefunded {
+		return nil, nil, ErrNothingToRefund
+	}
+
+	requested := map[primitive.ObjectID]int{}
+	for _, item := range items {
+		if item.Quantity < 1 {
+			return nil, nil, ErrInvalidQuantity
+		}
+		requested[item.ProductID] += item.Quantity
+	}
+
+	var lines []models.RefundLine
+	for _, item := range items {
+		quantity, pending := requested[item.ProductID]
+		if !pending {
+			continue
+		}
+		delete(requested, item.ProductID)
+
+		line, ok := order.Line(item.ProductID)
+		if !ok {
+			return nil, nil, ErrProductNotInOrder
+		}
+		if quantity > line.Quantity-order.RefundedQuantity(line.ID) {
+			return nil, nil, ErrRefundExceedsOrder
+		}
+		lines = append(lines, models.RefundLine{
+			ProductID: line.ID,
+			Quantity:  quantity,
+			Amount:    order.LineRefund(line, quantity),
+			Restocked: restock,
+		})
+	}
+	if len(lines) == 0 {
+		return nil, nil, ErrNothingToRefund
+	}
+
+	refund, err := issueRefund(ctx, orders, providers, order, lines, models.Money{}, by, reason)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	order, err = orders.FindByID(ctx, orderID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if order.FullyRefunded() && order.CanTransition(models.OrderRefunded) {
+		order, err = AdvanceOrderStatus(ctx, orders, providers, orderID, models.OrderRefunded, by, reason)
+		if err != nil {
+			return nil, nil, err
+		}
+		return order, refund, nil
+	}
+
+	if err := syncOrderStatus(ctx, orders, shipments, providers, orderID, by, reason); err != nil {
+		return nil, nil, err
+	}
+	order, err = orders.FindByID(ctx, orderID)
+	if err != nil {
+		return nil, nil, err
+	}
+	return order, refund, nil
+}
+
+// refundRemaining refunds every unit of the order not refunded yet, and the shipping
+// charge, if it was paid for. Refunds still pending are paid out first.
+func refundRemaining(
+	ctx context.Context,
+	orders OrderStore,
+	providers payments.Providers,
+	order *models.Order,
+	by string,
+	reason string,
+) error {
+
+	if !order.PaymentCollected() {
+		return nil
+	}
+	if err := settleRefunds(ctx, orders, providers, order); err != nil {
+		return err
+	}
+
+	var lines []models.RefundLine
+	for _, line := range order.OrderCart {
+		quantity := line.Quantity - order.RefundedQuantity(line.ID)
+		if quantity <= 0 {
+			continue
+		}
+		lines = append(lines, models.RefundLine{
+			ProductID: line.ID,
+			Quantity:  quantity,
+			Amount:    order.LineRefund(line, quantity),
+		})
+	}
+	shipping := order.ShippingCost().Sub(order.RefundedShipping()).Max(models.Money{})
+	if len(lines) == 0 && !shipping.IsPositive() {
+		return nil
+	}
+
+	_, err := issueRefund(ctx, orders, providers, order, lines, shipping, by, reason)
+	return err
+}
+
+/*
+issueRefund records a refund of lines and shipping as pending, then pays it back
+through the order's payment provider and marks it completed. Recording it first means
+a concurrent refund fails instead of paying out twice, and a refund whose payout
+failed is left pending to be retried. The total never goes past what is left of the
+amount charged, so discounts aren't paid out twice.
+*/
+func issueRefund(
+	ctx context.Context,
+	orders OrderStore,
+	providers payments.Providers,
+	order *models.Order,
+	lines []models.RefundLine,
+	shipping models.Money,
+	by string,
+	reason string,
+) (*models.Refund, error) {
+
+	amount := shipping
+	for _, line := range lines {
+		amount = amount.Add(line.Amount)
+	}
+
+	amount = amount.Min(order.Refundable())
+
+	// Converted cumulatively so partial refunds add up to exactly what was charged
+	refunded := order.RefundedAmount()
+	charged := order.Charged(refunded.Add(amount)).Sub(order.Charged(refunded))
+
+	refund := models.Refund{
+		ID:       primitive.NewObjectID(),
+		Status:   models.RefundPending,
+		Amount:   amount,
+		Charged:  charged,
+		Lines:    lines,
+		Shipping: shipping,
+		Reason:   reason,
+		By:       by,
+		At:       time.Now(),
+	}
+	if err := orders.AddRefund(ctx, order.ID, len(order.Refunds), refund); err != nil {
+		return nil, err
+	}
+	if err := payRefund(ctx, orders, providers, order, &refund); err != nil {
+		return nil, err
+	}
+	return &refund, nil
+}
+
+// payRefund pays a pending refund out through the order's provider, keyed by the
+// refund's ID so a retry can't pay it twice, and marks it completed
+func payRefund(ctx context.Context, orders OrderStore, providers payments.Providers, order *models.Order, refund *models.Refund) error {
+	reference, err := refundPayment(ctx, providers, order, refund.Charged, refund.ID.Hex())
+	if err != nil {
+		return err
+	}
+	if err := orders.CompleteRefund(ctx, order.ID, refund.ID, reference); err != nil {
+		return err
+	}
+	refund.Status = models.RefundCompleted
+	refund.Reference = reference
+	return nil
+}
+
+// settleRefunds retries paying out the order's pending refunds
+func settleRefunds(ctx context.Context, orders OrderStore, providers payments.Providers, order *models.Order) error {
+	for _, refund := range order.PendingRefunds() {
+		if err := payRefund(ctx, orders, providers, order, &refund); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+/*
+SettlePendingRefunds retries the payout of refunds left pending by a provider error
+*/
+func SettlePendingRefunds(ctx context.Context, orders OrderStore, providers payments.Providers) (int, error) {
+	ids, err := orders.PendingRefunds(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	settled := 0
+	for _, id := range ids {
+		order, err := orders.FindByID(ctx, id)
+		if err != nil {
+			return settled, err
+		}
+		if err := settleRefunds(ctx, orders, providers, order); err != nil {
+			log.Println("Refund payout error:", err)
+			continue
+		}
+		settled++
+	}
+	return settled, nil
+}
+
+// restockedLines turns the refund lines marked as restocked into stock adjustments
+func restockedLines(refund models.Refund) []models.ProductUser {
+	var lines []models.ProductUser
+	for _, line := range refund.Lines {
+		if line.Restocked {
+			lines = append(lines, models.ProductUser{ID: line.ProductID, Quantity: line.Quantity})
+		}
+	}
+	return lines
+}
@@ -0,0 +1,162 @@
+package database
+
+import (
+	"context"
+	"testing"
+
+	"github.com/nerokome/econo/models"
+	"github.com/nerokome/econo/payments"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestRefundOrderLines(t *testing.T) {
+	tests := []struct {
+		name        string
+		paymentMode string
+		earlier     int
+		quantity    int
+		otherLine   bool
+		restock     bool
+		wantErr     error
+		wantAmount  int64
+		wantStatus  string
+		wantStock   int
+	}{
+		{
+			name:        "some units",
+			paymentMode: models.PaymentModeDigital,
+			quantity:    1,
+			wantAmount:  500,
+			wantStatus:  models.OrderPaid,
+			wantStock:   7,
+		},
+		{
+			name:        "returned units go back into stock",
+			paymentMode: models.PaymentModeDigital,
+			quantity:    1,
+			restock:     true,
+			wantAmount:  500,
+			wantStatus:  models.OrderPaid,
+			wantStock:   8,
+		},
+		{
+			name:        "every unit before shipping releases the stock",
+			paymentMode: models.PaymentModeDigital,
+			earlier:     1,
+			quantity:    2,
+			wantAmount:  1000,
+			wantStatus:  models.OrderRefunded,
+			wantStock:   10,
+		},
+		{
+			name:        "more than is left",
+			paymentMode: models.PaymentModeDigital,
+			earlier:     2,
+			quantity:    2,
+			wantErr:     ErrRefundExceedsOrder,
+			wantStatus:  models.OrderPaid,
+			wantStock:   7,
+		},
+		{
+			name:        "product not in the order",
+			paymentMode: models.PaymentModeDigital,
+			quantity:    1,
+			otherLine:   true,
+			wantErr:     ErrProductNotInOrder,
+			wantStatus:  models.OrderPaid,
+			wantStock:   7,
+		},
+		{
+			name:        "not paid for",
+			paymentMode: models.PaymentModeCOD,
+			quantity:    1,
+			wantErr:     ErrPaymentNotCollected,
+			wantStatus:  models.OrderPendingPayment,
+			wantStock:   7,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			f := newFixture(t)
+			product := f.product(t, 500, 10, 5)
+			order := f.mustBuy(t, product.ID, 3, tt.paymentMode, payments.MockTokenApproved)
+
+			refundOf := func(quantity int) ([]RefundItem, bool) {
+				productID := product.ID
+				if tt.otherLine {
+					productID = primitive.NewObjectID()
+				}
+				return []RefundItem{{ProductID: productID, Quantity: quantity}}, tt.restock
+			}
+			if tt.earlier > 0 {
+				items, _ := refundOf(tt.earlier)
+				if _, _, err := RefundOrderLines(ctx, f.stores.Orders, f.stores.Shipments, f.providers, order.ID, items, false, "admin", ""); err != nil {
+					t.Fatalf("earlier refund: %v", err)
+				}
+			}
+
+			items, restock := refundOf(tt.quantity)
+			_, refund, err := RefundOrderLines(ctx, f.stores.Orders, f.stores.Shipments, f.providers, order.ID, items, restock, "admin", "damaged")
+			if err != tt.wantErr {
+				t.Fatalf("err = %v, want %v", err, tt.wantErr)
+			}
+			if err == nil {
+				if want := models.NewMoney(tt.wantAmount, models.BaseCurrency()); refund.Amount != want {
+					t.Errorf("amount = %v, want %v", refund.Amount, want)
+				}
+				if refund.Status != models.RefundCompleted {
+					t.Errorf("refund status = %s, want %s", refund.Status, models.RefundCompleted)
+				}
+			}
+			if order = f.order(t, order.ID); order.Status != tt.wantStatus {
+				t.Errorf("status = %s, want %s", order.Status, tt.wantStatus)
+			}
+			if got := f.stock(t, product.ID); got != tt.wantStock {
+				t.Errorf("stock = %d, want %d", got, tt.wantStock)
+			}
+		})
+	}
+}
+
+func TestSettlePendingRefunds(t *testing.T) {
+	ctx := context.Background()
+	f := newFixture(t)
+	provider := f.flakyDigital()
+	product := f.product(t, 500, 10, 5)
+	order := f.mustBuy(t, product.ID, 3, models.PaymentModeDigital, payments.MockTokenApproved)
+	items := []RefundItem{{ProductID: product.ID, Quantity: 1}}
+
+	provider.down = true
+	if _, _, err := RefundOrderLines(ctx, f.stores.Orders, f.stores.Shipments, f.providers, order.ID, items, false, "admin", ""); err != errProviderDown {
+		t.Fatalf("err = %v, want %v", err, errProviderDown)
+	}
+
+	order = f.order(t, order.ID)
+	if len(order.PendingRefunds()) != 1 {
+		t.Fatalf("pending refunds = %d, want 1", len(order.PendingRefunds()))
+	}
+	// The pending refund already counts, so the same units can't be refunded twice
+	if left := 3 - order.RefundedQuantity(product.ID); left != 2 {
+		t.Errorf("units left to refund = %d, want 2", left)
+	}
+
+	provider.down = false
+	settled, err := SettlePendingRefunds(ctx, f.stores.Orders, f.providers)
+	if err != nil || settled != 1 {
+		t.Fatalf("settle = %d, %v, want 1 order", settled, err)
+	}
+
+	order = f.order(t, order.ID)
+	if len(order.Refunds) != 1 {
+		t.Fatalf("refunds = %d, want 1", len(order.Refunds))
+	}
+	refund := order.Refunds[0]
+	if refund.Status != models.RefundCompleted {
+		t.Errorf("refund status = %s, want %s", refund.Status, models.RefundCompleted)
+	}
+	if want := "mock_refund_" + refund.ID.Hex(); refund.Reference != want {
+		t.Errorf("reference = %s, want %s", refund.Reference, want)
+	}
+}
@@ -0,0 +1,87 @@
+package database
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/nerokome/econo/models"
+	"github.com/nerokome/econo/payments"
+)
+
+// newReservation holds stock until payment is confirmed. Cash on delivery has
+// nothing to wait for, so its stock is committed straight away.
+func newReservation(paymentMode string) models.StockReservation {
+	if paymentMode == models.PaymentModeCOD {
+		return models.StockReservation{Status: models.ReservationConfirmed}
+	}
+	return models.StockReservation{
+		Status:    models.ReservationHeld,
+		ExpiresAt: time.Now().Add(models.ReservationTTL),
+	}
+}
+
+/*
+ReleaseExpiredReservations cancels unpaid orders whose reservation ran out and returns their stock
+*/
+func ReleaseExpiredReservations(ctx context.Context, orders OrderStore, providers payments.Providers) (int, error) {
+	ids, err := orders.ExpiredReservations(ctx, time.Now())
+	if err != nil {
+		return 0, err
+	}
+
+	released := 0
+	for _, id := range ids {
+		_, err := AdvanceOrderStatus(ctx, orders, providers, id, models.OrderCancelled, "system", "payment not received in time")
+		if err == ErrInvalidTransition || err == ErrStatusChanged {
+			// Paid or otherwise moved on since we listed it
+			continue
+		}
+		if err != nil {
+			return released, err
+		}
+		released++
+	}
+	return released, nil
+}
+
+/*
+StartReservationSweeper releases expired reservations every interval until ctx is done.
+It also retries side effects of status changes and refunds whose payout failed.
+*/
+func StartReservationSweeper(ctx context.Context, orders OrderStore, providers payments.Providers, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	go func() {
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				sweep(ctx, "Released %d expired stock reservations", func(ctx context.Context) (int, error) {
+					return ReleaseExpiredReservations(ctx, orders, providers)
+				})
+				sweep(ctx, "Carried out pending side effects of %d orders", func(ctx context.Context) (int, error) {
+					return RetryPendingEffects(ctx, orders, providers)
+				})
+				sweep(ctx, "Paid out pending refunds of %d orders", func(ctx context.Context) (int, error) {
+					return SettlePendingRefunds(ctx, orders, providers)
+				})
+			}
+		}
+	}()
+}
+
+// sweep runs one pass of the sweeper, logging how many orders it dealt with
+func sweep(ctx context.Context, done string, pass func(ctx context.Context) (int, error)) {
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+
+	n, err := pass(ctx)
+	if err != nil {
+		log.Println("Order sweep error:", err)
+	}
+	if n > 0 {
+		log.Printf(done, n)
+	}
+}
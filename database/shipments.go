@@ -0,0 +1,250 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/nerokome/econo/carriers"
+	"github.com/nerokome/econo/models"
+	"github.com/nerokome/econo/payments"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+var (
+	ErrShipmentNotFound      = errors.New("shipment not found")
+	ErrTrackingNumberTaken   = errors.New("carrier already has a shipment with this tracking number")
+	ErrShipmentChanged       = errors.New("shipment was updated at the same time, try again")
+	ErrShipmentsChanged      = errors.New("order was shipped at the same time, try again")
+	ErrOrderNotShippable     = errors.New("order must be packed before it can ship")
+	ErrInvalidShipmentStatus = errors.New("unknown shipment status")
+	ErrNothingToShip         = errors.New("every unit of the order has already shipped")
+	ErrShipmentExceedsOrder  = errors.New("shipment quantity exceeds what is left to ship")
+)
+
+// carrierActor is recorded as the author of changes made by carrier webhooks
+const carrierActor = "carrier"
+
+/*
+CreateShipment records part of a packed order being handed to carrier under
+trackingNumber: the units in lines, or with no lines every unit not shipped yet. The
+order moves to shipped, or partially_shipped while units are left to send. The
+shipment is removed again if the order can't be moved, and it fails with
+ErrShipmentsChanged if another shipment of the order was created meanwhile.
+*/
+func CreateShipment(
+	ctx context.Context,
+	orders OrderStore,
+	shipments ShipmentStore,
+	providers payments.Providers,
+	orderID primitive.ObjectID,
+	lines []models.ShipmentLine,
+	carrier string,
+	trackingNumber string,
+	by string,
+) (*models.Shipment, error) {
+
+	order, err := orders.FindByID(ctx, orderID)
+	if err != nil {
+		return nil, err
+	}
+	switch order.Status {
+	case models.OrderPacked, models.OrderPartiallyShipped, models.OrderPartiallyDelivered:
+	case models.OrderShipped, models.OrderDelivered:
+		return nil, ErrNothingToShip
+	default:
+		return nil, ErrOrderNotShippable
+	}
+
+	existing, err := shipments.ListByOrder(ctx, order.ID)
+	if err != nil {
+		return nil, err
+	}
+	lines, err = shipmentLines(order, existing, lines)
+	if err != nil {
+		return nil, err
+	}
+	// The store refuses a sequence already taken, so lines checked against a stale
+	// list of shipments never ship
+	sequence := 1
+	for _, s := range existing {
+		if s.Sequence >= sequence {
+			sequence = s.Sequence + 1
+		}
+	}
+
+	now := time.Now()
+	shipment := &models.Shipment{
+		ID:             primitive.NewObjectID(),
+		OrderID:        order.ID,
+		Carrier:        models.NormalizeCarrier(carrier),
+		TrackingNumber: strings.TrimSpace(trackingNumber),
+		Sequence:       sequence,
+		Lines:          lines,
+		Status:         models.ShipmentShipped,
+		Events: []models.TrackingEvent{{
+			Status: models.ShipmentShipped,
+			At:     now,
+			By:     by,
+		}},
+		CreatedAt: now,
+		CreatedBy: by,
+	}
+	if err := shipments.Create(ctx, shipment); err != nil {
+		return nil, err
+	}
+
+	note := "shipped with " + shipment.Carrier + ", tracking number " + shipment.TrackingNumber
+	if err := syncOrderStatus(ctx, orders, shipments, providers, order.ID, by, note); err != nil {
+		if deleteErr := shipments.Delete(ctx, shipment.ID); deleteErr != nil {
+			log.Println("Delete shipment error:", deleteErr)
+		}
+		return nil, err
+	}
+	return shipment, nil
+}
+
+// shipmentLines checks the units asked for in a new shipment are still waiting to
+// ship, merging repeated products. No lines at all asks for every unit left.
+func shipmentLines(order *models.Order, existing []models.Shipment, items []models.ShipmentLine) ([]models.ShipmentLine, error) {
+	if len(items) == 0 {
+		lines := order.UnshippedLines(existing)
+		if len(lines) == 0 {
+			return nil, ErrNothingToShip
+		}
+		return lines, nil
+	}
+
+	requested := map[primitive.ObjectID]int{}
+	for _, item := range items {
+		if item.Quantity < 1 {
+			return nil, ErrInvalidQuantity
+		}
+		requested[item.ProductID] += item.Quantity
+	}
+
+	var lines []models.ShipmentLine
+	for _, item := range items {
+		quantity, pending := requested[item.ProductID]
+		if !pending {
+			continue
+		}
+		delete(requested, item.ProductID)
+
+		line, ok := order.Line(item.ProductID)
+		if !ok {
+			return nil, ErrProductNotInOrder
+		}
+		if quantity > order.UnshippedQuantity(line, existing) {
+			return nil, ErrShipmentExceedsOrder
+		}
+		lines = append(lines, models.ShipmentLine{ProductID: line.ID, Quantity: quantity})
+	}
+	return lines, nil
+}
+
+/*
+AddTrackingEvent records a tracking event on a shipment and updates its status from
+it, then moves the order to the status its shipments add up to. Once every unit has
+been delivered the order is delivered, which collects cash on delivery payments. A
+carrier event already recorded is not added again, but still brings the order up to
+date if that failed the first time.
+*/
+func AddTrackingEvent(
+	ctx context.Context,
+	orders OrderStore,
+	shipments ShipmentStore,
+	providers payments.Providers,
+	shipmentID primitive.ObjectID,
+	event models.TrackingEvent,
+) (*models.Shipment, error) {
+
+	if !models.ValidShipmentStatus(event.Status) {
+		return nil, ErrInvalidShipmentStatus
+	}
+
+	shipment, err := shipments.FindByID(ctx, shipmentID)
+	if err != nil {
+		return nil, err
+	}
+
+	if !shipment.HasEvent(event.ExternalID) {
+		known := len(shipment.Events)
+		shipment.Events = append(shipment.Events, event)
+		shipment.Status = shipment.CurrentStatus()
+		if err := shipments.AddEvent(ctx, shipment.ID, known, event, shipment.Status); err != nil {
+			return nil, err
+		}
+	}
+
+	note := "shipment " + shipment.TrackingNumber + " " + strings.ReplaceAll(shipment.Status, "_", " ")
+	if err := syncOrderStatus(ctx, orders, shipments, providers, shipment.OrderID, event.By, note); err != nil {
+		return nil, err
+	}
+	return shipment, nil
+}
+
+// ApplyCarrierEvent records a tracking update posted by a carrier on the shipment
+// with its tracking number
+func ApplyCarrierEvent(
+	ctx context.Context,
+	orders OrderStore,
+	shipments ShipmentStore,
+	providers payments.Providers,
+	update carriers.TrackingUpdate,
+) (*models.Shipment, error) {
+
+	shipment, err := shipments.FindByTracking(ctx, models.NormalizeCarrier(update.Carrier), strings.TrimSpace(update.TrackingNumber))
+	if err != nil {
+		return nil, err
+	}
+
+	at := update.OccurredAt
+	if at.IsZero() {
+		at = time.Now()
+	}
+	return AddTrackingEvent(ctx, orders, shipments, providers, shipment.ID, models.TrackingEvent{
+		ExternalID:  update.ID,
+		Status:      update.Status,
+		Description: update.Description,
+		Location:    update.Location,
+		At:          at,
+		By:          carrierActor,
+	})
+}
+
+// syncOrderStatus moves an order to the status its shipments add up to, if its
+// lifecycle allows it
+func syncOrderStatus(
+	ctx context.Context,
+	orders OrderStore,
+	shipments ShipmentStore,
+	providers payments.Providers,
+	orderID primitive.ObjectID,
+	by string,
+	note string,
+) error {
+
+	order, err := orders.FindByID(ctx, orderID)
+	if err != nil {
+		return err
+	}
+	all, err := shipments.ListByOrder(ctx, orderID)
+	if err != nil {
+		return err
+	}
+
+	status := order.FulfillmentStatus(all)
+	if status == order.Status || !order.CanTransition(status) {
+		return nil
+	}
+
+	_, err = AdvanceOrderStatus(ctx, orders, providers, orderID, status, by, note)
+	if err == ErrInvalidTransition || err == ErrStatusChanged {
+		// Moved on by a concurrent event
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,284 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/nerokome/econo/carriers"
+	"github.com/nerokome/econo/models"
+	"github.com/nerokome/econo/payments"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// packedOrder places an order for three units of a product and packs it
+func (f *fixture) packedOrder(t *testing.T, paymentMode string) (*models.Order, *models.Product) {
+	t.Helper()
+
+	product := f.product(t, 500, 5, 3)
+	order := f.mustBuy(t, product.ID, 3, paymentMode, payments.MockTokenApproved)
+	if _, err := AdvanceOrderStatus(context.Background(), f.stores.Orders, f.providers, order.ID, models.OrderPacked, "admin", ""); err != nil {
+		t.Fatalf("pack: %v", err)
+	}
+	return order, product
+}
+
+// ship hands units of the order to the carrier, all that are left without lines
+func (f *fixture) ship(orderID primitive.ObjectID, trackingNumber string, lines ...models.ShipmentLine) (*models.Shipment, error) {
+	return CreateShipment(context.Background(), f.stores.Orders, f.stores.Shipments, f.providers,
+		orderID, lines, " BlueDart ", trackingNumber, "admin")
+}
+
+func TestCreateShipment(t *testing.T) {
+	other := primitive.NewObjectID()
+
+	tests := []struct {
+		name     string
+		unpacked bool
+		before   []int
+		tracking string
+		// quantity 0 asks for every unit left, and below 0 for a line without units
+		quantity     int
+		product      *primitive.ObjectID
+		wantErr      error
+		wantQuantity int
+		wantSequence int
+		wantStatus   string
+	}{
+		{name: "every unit", wantQuantity: 3, wantSequence: 1, wantStatus: models.OrderShipped},
+		{name: "some units", quantity: 2, wantQuantity: 2, wantSequence: 1, wantStatus: models.OrderPartiallyShipped},
+		{name: "the rest", before: []int{2}, wantQuantity: 1, wantSequence: 2, wantStatus: models.OrderShipped},
+		{name: "more than is left", before: []int{2}, quantity: 2, wantErr: ErrShipmentExceedsOrder},
+		{name: "nothing left", before: []int{3}, wantErr: ErrNothingToShip},
+		{name: "not packed", unpacked: true, wantErr: ErrOrderNotShippable},
+		{name: "product not in order", quantity: 1, product: &other, wantErr: ErrProductNotInOrder},
+		{name: "no units", quantity: -1, wantErr: ErrInvalidQuantity},
+		{name: "tracking number taken", before: []int{1}, tracking: "T0", wantErr: ErrTrackingNumberTaken},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			f := newFixture(t)
+			order, product := f.packedOrder(t, models.PaymentModeDigital)
+			if tt.unpacked {
+				order = f.mustBuy(t, product.ID, 1, models.PaymentModeDigital, payments.MockTokenApproved)
+			}
+
+			for i, quantity := range tt.before {
+				if _, err := f.ship(order.ID, fmt.Sprintf("T%d", i), models.ShipmentLine{ProductID: product.ID, Quantity: quantity}); err != nil {
+					t.Fatalf("earlier shipment: %v", err)
+				}
+			}
+			var lines []models.ShipmentLine
+			if tt.quantity != 0 {
+				line := models.ShipmentLine{ProductID: product.ID, Quantity: max(tt.quantity, 0)}
+				if tt.product != nil {
+					line.ProductID = *tt.product
+				}
+				lines = append(lines, line)
+			}
+			tracking := tt.tracking
+			if tracking == "" {
+				tracking = "NEW1"
+			}
+			status := f.order(t, order.ID).Status
+
+			shipment, err := f.ship(order.ID, " "+tracking+" ", lines...)
+			if err != tt.wantErr {
+				t.Fatalf("err = %v, want %v", err, tt.wantErr)
+			}
+
+			all, err := f.stores.Shipments.ListByOrder(ctx, order.ID)
+			if err != nil {
+				t.Fatalf("list shipments: %v", err)
+			}
+			if tt.wantErr != nil {
+				if len(all) != len(tt.before) {
+					t.Errorf("%d shipments, want %d", len(all), len(tt.before))
+				}
+				if got := f.order(t, order.ID).Status; got != status {
+					t.Errorf("order status = %s, want %s", got, status)
+				}
+				return
+			}
+
+			want := []models.ShipmentLine{{ProductID: product.ID, Quantity: tt.wantQuantity}}
+			if !reflect.DeepEqual(shipment.Lines, want) {
+				t.Errorf("lines = %v, want %v", shipment.Lines, want)
+			}
+			if shipment.Carrier != "bluedart" || shipment.TrackingNumber != tracking {
+				t.Errorf("shipped with %q as %q, want bluedart as %q", shipment.Carrier, shipment.TrackingNumber, tracking)
+			}
+			if shipment.Sequence != tt.wantSequence {
+				t.Errorf("sequence = %d, want %d", shipment.Sequence, tt.wantSequence)
+			}
+			if shipment.Status != models.ShipmentShipped || len(shipment.Events) != 1 {
+				t.Errorf("status = %s with %d events, want shipped with 1", shipment.Status, len(shipment.Events))
+			}
+			if got := f.order(t, order.ID).Status; got != tt.wantStatus {
+				t.Errorf("order status = %s, want %s", got, tt.wantStatus)
+			}
+		})
+	}
+}
+
+// staleShipments lists an order's shipments as they were before the last one
+type staleShipments struct {
+	ShipmentStore
+	listed []models.Shipment
+}
+
+func (s *staleShipments) ListByOrder(ctx context.Context, orderID primitive.ObjectID) ([]models.Shipment, error) {
+	return s.listed, nil
+}
+
+func TestCreateShipmentConcurrently(t *testing.T) {
+	ctx := context.Background()
+	f := newFixture(t)
+	order, product := f.packedOrder(t, models.PaymentModeDigital)
+
+	first, err := f.ship(order.ID, "T1", models.ShipmentLine{ProductID: product.ID, Quantity: 2})
+	if err != nil {
+		t.Fatalf("first shipment: %v", err)
+	}
+
+	// Checked against the shipments from before the first one, two more units look free
+	stale := &staleShipments{ShipmentStore: f.stores.Shipments, listed: []models.Shipment{}}
+	_, err = CreateShipment(ctx, f.stores.Orders, stale, f.providers, order.ID,
+		[]models.ShipmentLine{{ProductID: product.ID, Quantity: 2}}, "bluedart", "T2", "admin")
+	if err != ErrShipmentsChanged {
+		t.Fatalf("err = %v, want %v", err, ErrShipmentsChanged)
+	}
+
+	all, err := f.stores.Shipments.ListByOrder(ctx, order.ID)
+	if err != nil {
+		t.Fatalf("list shipments: %v", err)
+	}
+	if len(all) != 1 || all[0].ID != first.ID {
+		t.Errorf("shipments = %v, want only the first", all)
+	}
+	if got := f.order(t, order.ID).Status; got != models.OrderPartiallyShipped {
+		t.Errorf("order status = %s, want %s", got, models.OrderPartiallyShipped)
+	}
+}
+
+func TestAddTrackingEvent(t *testing.T) {
+	ctx := context.Background()
+	f := newFixture(t)
+	order, product := f.packedOrder(t, models.PaymentModeCOD)
+
+	first, err := f.ship(order.ID, "T1", models.ShipmentLine{ProductID: product.ID, Quantity: 2})
+	if err != nil {
+		t.Fatalf("first shipment: %v", err)
+	}
+	second, err := f.ship(order.ID, "T2")
+	if err != nil {
+		t.Fatalf("second shipment: %v", err)
+	}
+
+	now := time.Now()
+	steps := []struct {
+		name        string
+		shipment    *models.Shipment
+		status      string
+		at          time.Time
+		wantErr     error
+		wantStatus  string
+		wantOrder   string
+		wantPayment string
+	}{
+		{
+			name: "in transit", shipment: first, status: models.ShipmentInTransit, at: now,
+			wantStatus: models.ShipmentInTransit, wantOrder: models.OrderShipped, wantPayment: models.PaymentAuthorized,
+		},
+		{
+			name: "unknown status", shipment: first, status: "lost", at: now,
+			wantErr: ErrInvalidShipmentStatus, wantStatus: models.ShipmentInTransit, wantOrder: models.OrderShipped,
+			wantPayment: models.PaymentAuthorized,
+		},
+		{
+			name: "one parcel delivered", shipment: first, status: models.ShipmentDelivered, at: now.Add(time.Hour),
+			wantStatus: models.ShipmentDelivered, wantOrder: models.OrderPartiallyDelivered, wantPayment: models.PaymentAuthorized,
+		},
+		{
+			name: "reported late", shipment: first, status: models.ShipmentOutForDelivery, at: now.Add(time.Minute),
+			wantStatus: models.ShipmentDelivered, wantOrder: models.OrderPartiallyDelivered, wantPayment: models.PaymentAuthorized,
+		},
+		{
+			name: "every parcel delivered", shipment: second, status: models.ShipmentDelivered, at: now.Add(time.Hour),
+			wantStatus: models.ShipmentDelivered, wantOrder: models.OrderDelivered, wantPayment: models.PaymentCaptured,
+		},
+	}
+
+	for _, step := range steps {
+		_, err := AddTrackingEvent(ctx, f.stores.Orders, f.stores.Shipments, f.providers, step.shipment.ID,
+			models.TrackingEvent{Status: step.status, At: step.at, By: "admin"})
+		if err != step.wantErr {
+			t.Fatalf("%s: err = %v, want %v", step.name, err, step.wantErr)
+		}
+
+		shipment, err := f.stores.Shipments.FindByID(ctx, step.shipment.ID)
+		if err != nil {
+			t.Fatalf("%s: find shipment: %v", step.name, err)
+		}
+		if shipment.Status != step.wantStatus {
+			t.Errorf("%s: shipment status = %s, want %s", step.name, shipment.Status, step.wantStatus)
+		}
+		order := f.order(t, order.ID)
+		if order.Status != step.wantOrder {
+			t.Errorf("%s: order status = %s, want %s", step.name, order.Status, step.wantOrder)
+		}
+		if order.Payment.Status != step.wantPayment {
+			t.Errorf("%s: payment = %s, want %s", step.name, order.Payment.Status, step.wantPayment)
+		}
+	}
+}
+
+func TestApplyCarrierEvent(t *testing.T) {
+	ctx := context.Background()
+	f := newFixture(t)
+	order, _ := f.packedOrder(t, models.PaymentModeDigital)
+	shipment, err := f.ship(order.ID, "T1")
+	if err != nil {
+		t.Fatalf("ship: %v", err)
+	}
+
+	update := carriers.TrackingUpdate{
+		ID:             "evt_1",
+		Carrier:        "BlueDart",
+		TrackingNumber: " T1",
+		Status:         models.ShipmentDelivered,
+		Location:       "Pune",
+	}
+	for i := 0; i < 2; i++ {
+		if _, err := ApplyCarrierEvent(ctx, f.stores.Orders, f.stores.Shipments, f.providers, update); err != nil {
+			t.Fatalf("delivery %d: %v", i+1, err)
+		}
+	}
+
+	shipment, err = f.stores.Shipments.FindByID(ctx, shipment.ID)
+	if err != nil {
+		t.Fatalf("find shipment: %v", err)
+	}
+	if len(shipment.Events) != 2 {
+		t.Fatalf("%d events, want the carrier's recorded once after shipping", len(shipment.Events))
+	}
+	event := shipment.Events[1]
+	if event.ExternalID != "evt_1" || event.By != carrierActor || event.Location != "Pune" || event.At.IsZero() {
+		t.Errorf("event = %+v", event)
+	}
+	if shipment.Status != models.ShipmentDelivered {
+		t.Errorf("shipment status = %s, want %s", shipment.Status, models.ShipmentDelivered)
+	}
+	if got := f.order(t, order.ID).Status; got != models.OrderDelivered {
+		t.Errorf("order status = %s, want %s", got, models.OrderDelivered)
+	}
+
+	update.ID, update.TrackingNumber = "evt_2", "T9"
+	if _, err := ApplyCarrierEvent(ctx, f.stores.Orders, f.stores.Shipments, f.providers, update); err != ErrShipmentNotFound {
+		t.Errorf("unknown tracking number: err = %v, want %v", err, ErrShipmentNotFound)
+	}
+}
@@ -0,0 +1,147 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/nerokome/econo/models"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+var (
+	ErrShippingRateNotFound   = errors.New("shipping rate not found")
+	ErrInvalidShippingMethod  = errors.New("shipping method must be standard, express or pickup")
+	ErrShippingMethodRequired = errors.New("shipping_method is required")
+	ErrShippingUnavailable    = errors.New("shipping method is not available for this address and cart")
+)
+
+/*
+QuoteShipping prices every method that can ship lines worth value to address. Each
+method is priced by its active rate with the most specific zone for the address's
+pincode, the cheapest of those on a tie. Methods no rate covers are left out.
+*/
+func QuoteShipping(
+	rates []models.ShippingRate,
+	address models.Address,
+	lines []models.ProductUser,
+	value models.Money,
+) []models.ShippingOption {
+
+	weight := models.CartWeight(lines)
+	options := []models.ShippingOption{}
+	for _, method := range models.ShippingMethods {
+		var best *models.ShippingOption
+		bestZone := -1
+		for i := range rates {
+			rate := &rates[i]
+			if !rate.Active || rate.Method != method {
+				continue
+			}
+			zone := rate.ZoneMatch(address.Pincode)
+			if zone < 0 || zone < bestZone {
+				continue
+			}
+			cost, ok := rate.Quote(weight, value)
+			if !ok {
+				continue
+			}
+			// Ties go to the older rate
+			if zone == bestZone && cost.Cmp(best.Cost) >= 0 {
+				continue
+			}
+			best = &models.ShippingOption{
+				Method:        method,
+				Name:          rate.Name,
+				RateID:        rate.ID,
+				Cost:          cost,
+				EstimatedDays: rate.EstimatedDays,
+				WeightGrams:   weight,
+			}
+			bestZone = zone
+		}
+		if best != nil {
+			options = append(options, *best)
+		}
+	}
+	return options
+}
+
+/*
+CartShippingOptions quotes the shipping methods available for the user's cart sent
+to their saved address addressID. Lines that can't be bought are left out and the
+cart's coupon, if it still applies, counts against the cart value.
+*/
+func CartShippingOptions(
+	ctx context.Context,
+	users UserStore,
+	products ProductStore,
+	coupons CouponStore,
+	shippingRates ShippingRateStore,
+	userID primitive.ObjectID,
+	addressID primitive.ObjectID,
+) ([]models.ShippingOption, error) {
+
+	address, err := userAddress(ctx, users, userID, addressID)
+	if err != nil {
+		return nil, err
+	}
+
+	summary, err := cartSummary(ctx, users, products, userID)
+	if err != nil {
+		return nil, err
+	}
+	lines := purchasableLines(summary)
+	if len(lines) == 0 {
+		return nil, ErrCartEmpty
+	}
+
+	value := summary.Total
+	coupon, err := cartCoupon(ctx, users, coupons, userID)
+	if err != nil && err != ErrCouponNotFound {
+		return nil, err
+	}
+	if coupon != nil {
+		if applied, err := EvaluateCoupon(coupon, userID.Hex(), lines, time.Now()); err == nil {
+			value = value.Sub(applied.Amount)
+		}
+	}
+
+	rates, err := shippingRates.List(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return QuoteShipping(rates, *address, lines, value), nil
+}
+
+// orderShipping prices the chosen shipping method for an order about to be placed
+// and records it on the order. Discounts have to be settled first since rates look
+// at the discounted cart value. A store with no active shipping rates doesn't
+// charge for shipping, so the method may then be left out.
+func orderShipping(ctx context.Context, shippingRates ShippingRateStore, order *models.Order, method string) error {
+	if method != "" && !models.ValidShippingMethod(method) {
+		return ErrInvalidShippingMethod
+	}
+
+	rates, err := shippingRates.List(ctx)
+	if err != nil {
+		return err
+	}
+	if method == "" {
+		for _, rate := range rates {
+			if rate.Active {
+				return ErrShippingMethodRequired
+			}
+		}
+		return nil
+	}
+
+	options := QuoteShipping(rates, order.Address, order.OrderCart, order.Price.Sub(order.Discount))
+	for _, option := range options {
+		if option.Method == method {
+			order.Shipping = &option
+			return nil
+		}
+	}
+	return ErrShippingUnavailable
+}
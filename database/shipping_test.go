@@ -0,0 +1,167 @@
+package database
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/nerokome/econo/models"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// shippingTable is a store shipping to the west and south, with cheaper standard
+// shipping for light parcels around Pune, express there too and pickup in one area
+func shippingTable() []models.ShippingRate {
+	inr := func(amount int64) models.Money { return models.NewMoney(amount, models.BaseCurrency()) }
+	return []models.ShippingRate{
+		{
+			ID: primitive.NewObjectID(), Method: models.ShippingStandard, Name: "Standard",
+			Pincodes: []string{"4", "5"}, Cost: inr(5000), PerKg: inr(1000), FreeAbove: inr(100000), Active: true,
+		},
+		{
+			ID: primitive.NewObjectID(), Method: models.ShippingStandard, Name: "Pune standard",
+			Pincodes: []string{"411"}, MaxWeightGrams: 5000, Cost: inr(3000), PerKg: inr(500), Active: true,
+		},
+		{
+			ID: primitive.NewObjectID(), Method: models.ShippingStandard, Name: "Retired",
+			Pincodes: []string{"411001"}, Cost: inr(100), Active: false,
+		},
+		{
+			ID: primitive.NewObjectID(), Method: models.ShippingExpress, Name: "Pune express",
+			Pincodes: []string{"411"}, MaxWeightGrams: 5000, MinCartValue: inr(20000), Cost: inr(10000), Active: true,
+		},
+		{
+			ID: primitive.NewObjectID(), Method: models.ShippingPickup, Name: "Pickup",
+			Pincodes: []string{"411001"}, Active: true,
+		},
+	}
+}
+
+// parcel is a single unit weighing grams
+func parcel(grams int) []models.ProductUser {
+	return []models.ProductUser{{ID: primitive.NewObjectID(), WeightGrams: grams, Quantity: 1}}
+}
+
+func TestQuoteShipping(t *testing.T) {
+	rates := shippingTable()
+
+	type quote struct {
+		name string
+		cost int64
+	}
+	tests := []struct {
+		name    string
+		pincode string
+		grams   int
+		value   int64
+		want    []quote
+	}{
+		{
+			name: "most specific zone", pincode: "411001", grams: 1500, value: 50000,
+			want: []quote{{"Pune standard", 4000}, {"Pune express", 10000}, {"Pickup", 0}},
+		},
+		{
+			name: "wider zone", pincode: "560001", grams: 1500, value: 50000,
+			want: []quote{{"Standard", 7000}},
+		},
+		{
+			name: "over the zone's weight band", pincode: "411002", grams: 6000, value: 50000,
+			want: []quote{{"Standard", 11000}},
+		},
+		{
+			name: "every started kilogram", pincode: "560001", grams: 2001, value: 50000,
+			want: []quote{{"Standard", 8000}},
+		},
+		{
+			name: "under the minimum cart value", pincode: "411002", grams: 1500, value: 19999,
+			want: []quote{{"Pune standard", 4000}},
+		},
+		{
+			name: "just under free shipping", pincode: "560001", grams: 1500, value: 99999,
+			want: []quote{{"Standard", 7000}},
+		},
+		{
+			name: "free shipping", pincode: "560001", grams: 1500, value: 100000,
+			want: []quote{{"Standard", 0}},
+		},
+		{
+			name: "unserviceable pincode", pincode: "110001", grams: 1500, value: 50000,
+			want: []quote{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			address := models.Address{Pincode: tt.pincode}
+			value := models.NewMoney(tt.value, models.BaseCurrency())
+			options := QuoteShipping(rates, address, parcel(tt.grams), value)
+
+			got := []quote{}
+			for _, option := range options {
+				got = append(got, quote{option.Name, option.Cost.Amount})
+				if option.WeightGrams != tt.grams {
+					t.Errorf("%s weighs %d, want %d", option.Name, option.WeightGrams, tt.grams)
+				}
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("options = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestOrderShipping(t *testing.T) {
+	ctx := context.Background()
+
+	tests := []struct {
+		name     string
+		noRates  bool
+		pincode  string
+		method   string
+		wantErr  error
+		wantCost int64
+	}{
+		{name: "chosen method", pincode: "411001", method: models.ShippingExpress, wantCost: 10000},
+		{name: "priced after the discount", pincode: "560001", method: models.ShippingStandard, wantCost: 7000},
+		{name: "method not offered there", pincode: "560001", method: models.ShippingPickup, wantErr: ErrShippingUnavailable},
+		{name: "unserviceable pincode", pincode: "110001", method: models.ShippingStandard, wantErr: ErrShippingUnavailable},
+		{name: "no method", pincode: "411001", wantErr: ErrShippingMethodRequired},
+		{name: "unknown method", pincode: "411001", method: "drone", wantErr: ErrInvalidShippingMethod},
+		{name: "store without shipping rates", noRates: true, pincode: "110001"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := NewMemoryShippingRateStore()
+			if !tt.noRates {
+				for _, rate := range shippingTable() {
+					if err := store.Create(ctx, &rate); err != nil {
+						t.Fatalf("create rate: %v", err)
+					}
+				}
+			}
+			// Free shipping starts at 1000.00, which the discount takes the order under
+			order := &models.Order{
+				Address:   models.Address{Pincode: tt.pincode},
+				OrderCart: parcel(1500),
+				Price:     models.NewMoney(120000, models.BaseCurrency()),
+				Discount:  models.NewMoney(30000, models.BaseCurrency()),
+			}
+
+			err := orderShipping(ctx, store, order, tt.method)
+			if err != tt.wantErr {
+				t.Fatalf("err = %v, want %v", err, tt.wantErr)
+			}
+			if err != nil || tt.method == "" {
+				if order.Shipping != nil {
+					t.Errorf("shipping = %+v, want none", order.Shipping)
+				}
+				return
+			}
+			if order.Shipping.Method != tt.method || order.Shipping.Cost.Amount != tt.wantCost {
+				t.Errorf("shipping = %s at %d, want %s at %d",
+					order.Shipping.Method, order.Shipping.Cost.Amount, tt.method, tt.wantCost)
+			}
+		})
+	}
+}
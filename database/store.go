@@ -0,0 +1,314 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/nerokome/econo/models"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+var (
+	ErrUserNotFound    = errors.New("user not found")
+	ErrEmailTaken      = errors.New("email already exists")
+	ErrAddressNotFound = errors.New("address not found")
+	ErrOrderNotFound   = errors.New("order not found")
+	ErrTokenNotFound   = errors.New("token not found")
+	ErrNotReserved     = errors.New("order has no held stock reservation")
+	ErrStatusChanged   = errors.New("order status changed concurrently")
+	ErrRefundsChanged  = errors.New("order refunds changed concurrently")
+	ErrRefundNotFound  = errors.New("refund not found")
+	ErrKeyChanged      = errors.New("idempotency key changed concurrently")
+	ErrLastAdmin       = errors.New("cannot remove the last admin")
+	ErrAdminExists     = errors.New("an admin already exists")
+)
+
+// UserStore persists users along with their sessions, addresses and cart
+type UserStore interface {
+	// Create saves a new user. It fails with ErrEmailTaken if another user has the email.
+	Create(ctx context.Context, user *models.User) error
+	FindByID(ctx context.Context, userID string) (*models.User, error)
+	FindByEmail(ctx context.Context, email string) (*models.User, error)
+	// SetRole changes the user's role. It fails with ErrLastAdmin rather than demote
+	// the only admin, checking and changing in one step.
+	SetRole(ctx context.Context, userID, role string) error
+	// PromoteFirstAdmin makes the user an admin. It fails with ErrAdminExists if there
+	// already is one, checking and changing in one step.
+	PromoteFirstAdmin(ctx context.Context, userID string) error
+
+	// AddSession appends a token pair, keeping only the newest maxSessions pairs
+	AddSession(ctx context.Context, userID, accessToken, refreshToken string, maxSessions int) error
+	// RotateRefreshToken swaps oldRefresh for newRefresh and records newAccess.
+	// It returns ErrTokenNotFound if oldRefresh is no longer held by the user.
+	RotateRefreshToken(ctx context.Context, userID, oldRefresh, newRefresh, newAccess string, maxSessions int) error
+	SetSessions(ctx context.Context, userID string, tokens, refreshTokens []string) error
+
+	AddAddress(ctx context.Context, userID string, address models.Address) error
+	UpdateAddress(ctx context.Context, userID string, address models.Address) error
+	// DeleteAddress fails with ErrAddressNotFound unless the user has the address
+	DeleteAddress(ctx context.Context, userID string, addressID primitive.ObjectID) error
+
+	// ChangeCartQuantity atomically adds delta, which may be negative, to a cart line and
+	// returns the new quantity. A missing line is created from item and a line that drops
+	// to zero is removed. It fails with ErrQuantityLimitExceeded rather than go above max.
+	ChangeCartQuantity(ctx context.Context, userID string, item models.CartItem, delta, max int) (int, error)
+	// SetCartQuantity sets a line to item.Quantity, creating it if missing; zero removes it
+	SetCartQuantity(ctx context.Context, userID string, item models.CartItem) error
+	RemoveCartProduct(ctx context.Context, userID string, productID primitive.ObjectID) error
+	ClearCart(ctx context.Context, userID string) error
+	// SetCartCoupon remembers the coupon code applied to the cart; an empty code removes it
+	SetCartCoupon(ctx context.Context, userID, code string) error
+	Cart(ctx context.Context, userID string) ([]models.CartItem, error)
+}
+
+// ProductFilter narrows a product listing
+type ProductFilter struct {
+	// Query matches product names case-insensitively
+	Query          string
+	IncludeDeleted bool
+}
+
+// ProductUpdate holds the fields of a partial product update; nil fields are left alone
+type ProductUpdate struct {
+	Name        *string
+	Price       *models.Money
+	Rating      *uint8
+	ImageURL    *string
+	Category    *string
+	MaxPerOrder *int
+	Stock       *int
+	WeightGrams *int
+	UpdatedBy   string
+}
+
+// ProductStore persists the catalog. Deleted products are kept and flagged.
+type ProductStore interface {
+	Create(ctx context.Context, product *models.Product) error
+	// FindByID returns the product even if it has been soft-deleted
+	FindByID(ctx context.Context, productID primitive.ObjectID) (*models.Product, error)
+	// FindByIDs returns whichever of the products exist, deleted or not, in no particular order
+	FindByIDs(ctx context.Context, productIDs []primitive.ObjectID) ([]models.Product, error)
+	List(ctx context.Context, filter ProductFilter) ([]models.Product, error)
+	Update(ctx context.Context, productID primitive.ObjectID, update ProductUpdate) (*models.Product, error)
+	SoftDelete(ctx context.Context, productID primitive.ObjectID, deletedBy string) error
+	Restore(ctx context.Context, productID primitive.ObjectID, restoredBy string) error
+}
+
+// OrderFilter narrows and pages a user's order history; zero fields don't filter
+type OrderFilter struct {
+	Status string
+	From   time.Time
+	To     time.Time
+	Skip   int64
+	Limit  int64
+}
+
+// OrderStore persists orders
+type OrderStore interface {
+	// PlaceOrder saves a new order, takes its quantities out of stock and adds it to the
+	// user's order_status list. With clearCart set it also empties the user's cart and
+	// drops its coupon. Either all of it happens or none; a line short on stock fails
+	// with ErrInsufficientQuantity.
+	PlaceOrder(ctx context.Context, order *models.Order, clearCart bool) error
+	// ConfirmReservation keeps the stock held by an order whose payment went through
+	ConfirmReservation(ctx context.Context, orderID primitive.ObjectID) error
+	// ReleaseReservation puts the stock held by an order, less anything a refund
+	// already restocked, back into the catalog
+	ReleaseReservation(ctx context.Context, orderID primitive.ObjectID) error
+	// ReturnCoupons gives back the coupon uses the order redeemed. It does nothing if
+	// they were already given back.
+	ReturnCoupons(ctx context.Context, orderID primitive.ObjectID) error
+	// ExpiredReservations lists orders whose held reservation expired before now
+	ExpiredReservations(ctx context.Context, now time.Time) ([]primitive.ObjectID, error)
+	FindByID(ctx context.Context, orderID primitive.ObjectID) (*models.Order, error)
+	// UpdateStatus moves an order from status from to change.Status, appends change to
+	// its history and adds effects to its pending side effects, all in one step. It
+	// fails with ErrStatusChanged if the order is no longer in from.
+	UpdateStatus(ctx context.Context, orderID primitive.ObjectID, from string, change models.OrderStatusChange, effects []string) error
+	// ClearEffect drops a side effect from the order's pending ones once carried out
+	ClearEffect(ctx context.Context, orderID primitive.ObjectID, effect string) error
+	// PendingEffects lists orders with side effects still to carry out
+	PendingEffects(ctx context.Context) ([]primitive.ObjectID, error)
+	// SetPayment replaces the order's payment record with the provider's latest view of it
+	SetPayment(ctx context.Context, orderID primitive.ObjectID, payment models.Payment) error
+	// AddRefund appends refund to the order and puts its restocked lines back into stock.
+	// It fails with ErrRefundsChanged unless the order still has exactly known refunds.
+	AddRefund(ctx context.Context, orderID primitive.ObjectID, known int, refund models.Refund) error
+	// CompleteRefund marks a pending refund as paid out under the provider's reference
+	CompleteRefund(ctx context.Context, orderID, refundID primitive.ObjectID, reference string) error
+	// PendingRefunds lists orders with refunds that were recorded but not paid out
+	PendingRefunds(ctx context.Context) ([]primitive.ObjectID, error)
+	// ListByUser returns one page of the user's orders, newest first, along with the
+	// number of orders matching the filter across all pages
+	ListByUser(ctx context.Context, userID string, filter OrderFilter) ([]models.Order, int64, error)
+}
+
+// CouponUpdate holds the fields of a partial coupon update; nil fields are left alone
+type CouponUpdate struct {
+	Description  *string
+	Active       *bool
+	StartsAt     *time.Time
+	EndsAt       *time.Time
+	UsageLimit   *int
+	PerUserLimit *int
+}
+
+// CouponStore persists coupons and counts their redemptions
+type CouponStore interface {
+	// Create fails with ErrCouponCodeTaken if another coupon has the same code
+	Create(ctx context.Context, coupon *models.Coupon) error
+	FindByID(ctx context.Context, couponID primitive.ObjectID) (*models.Coupon, error)
+	FindByCode(ctx context.Context, code string) (*models.Coupon, error)
+	List(ctx context.Context) ([]models.Coupon, error)
+	// Update fails with ErrCouponWindow rather than leave the coupon starting at or
+	// after it ends, checking against the stored dates in the same step
+	Update(ctx context.Context, couponID primitive.ObjectID, update CouponUpdate) (*models.Coupon, error)
+	// Redeem counts one use of the coupon by userID. It fails with ErrCouponExhausted or
+	// ErrCouponUserLimit rather than go over the coupon's usage limits.
+	Redeem(ctx context.Context, coupon *models.Coupon, userID string) error
+	// Unredeem gives back a use counted by Redeem
+	Unredeem(ctx context.Context, couponID primitive.ObjectID, userID string) error
+}
+
+// TaxRuleUpdate holds the fields of a partial tax rule update; nil fields are left alone
+type TaxRuleUpdate struct {
+	Name      *string
+	City      *string
+	Pincode   *string
+	Category  *string
+	Rate      *float64
+	Inclusive *bool
+	Active    *bool
+	UpdatedBy string
+}
+
+// TaxRuleStore persists the tax table
+type TaxRuleStore interface {
+	Create(ctx context.Context, rule *models.TaxRule) error
+	// List returns every rule, active or not, oldest first
+	List(ctx context.Context) ([]models.TaxRule, error)
+	Update(ctx context.Context, ruleID primitive.ObjectID, update TaxRuleUpdate) (*models.TaxRule, error)
+	Delete(ctx context.Context, ruleID primitive.ObjectID) error
+}
+
+// ShippingRateUpdate holds the fields of a partial shipping rate update; nil fields are left alone
+type ShippingRateUpdate struct {
+	Method         *string
+	Name           *string
+	Pincodes       *[]string
+	MinWeightGrams *int
+	MaxWeightGrams *int
+	MinCartValue   *models.Money
+	Cost           *models.Money
+	PerKg          *models.Money
+	FreeAbove      *models.Money
+	EstimatedDays  *int
+	Active         *bool
+	UpdatedBy      string
+}
+
+// ShippingRateStore persists the shipping table
+type ShippingRateStore interface {
+	Create(ctx context.Context, rate *models.ShippingRate) error
+	// List returns every rate, active or not, oldest first
+	List(ctx context.Context) ([]models.ShippingRate, error)
+	Update(ctx context.Context, rateID primitive.ObjectID, update ShippingRateUpdate) (*models.ShippingRate, error)
+	Delete(ctx context.Context, rateID primitive.ObjectID) error
+}
+
+// ShipmentStore persists the parcels orders are shipped in
+type ShipmentStore interface {
+	// Create fails with ErrTrackingNumberTaken if the carrier already has a shipment
+	// with the same tracking number, and with ErrShipmentsChanged if the order
+	// already has a shipment with the same sequence
+	Create(ctx context.Context, shipment *models.Shipment) error
+	FindByID(ctx context.Context, shipmentID primitive.ObjectID) (*models.Shipment, error)
+	FindByTracking(ctx context.Context, carrier, trackingNumber string) (*models.Shipment, error)
+	// ListByOrder returns the order's shipments, oldest first
+	ListByOrder(ctx context.Context, orderID primitive.ObjectID) ([]models.Shipment, error)
+	// AddEvent appends event to the shipment and sets its status. It fails with
+	// ErrShipmentChanged unless the shipment still has exactly known events.
+	AddEvent(ctx context.Context, shipmentID primitive.ObjectID, known int, event models.TrackingEvent, status string) error
+	Delete(ctx context.Context, shipmentID primitive.ObjectID) error
+}
+
+// ExchangeRateStore persists the effective-dated exchange-rate table
+type ExchangeRateStore interface {
+	Create(ctx context.Context, rate *models.ExchangeRate) error
+	// List returns every rate, grouped by currency with the latest effective first
+	List(ctx context.Context) ([]models.ExchangeRate, error)
+	// Effective returns the rate from base to currency in effect at t. It fails with
+	// ErrExchangeRateNotFound if none had taken effect yet.
+	Effective(ctx context.Context, base, currency string, at time.Time) (*models.ExchangeRate, error)
+	// Delete removes a rate that has not taken effect yet; rates in use are kept for
+	// the orders charged at them and fail with ErrExchangeRateInUse
+	Delete(ctx context.Context, rateID primitive.ObjectID, now time.Time) error
+}
+
+// TokenStore keeps the list of revoked token IDs (jti), along with a cutoff for
+// users whose every session was ended at once
+type TokenStore interface {
+	Revoke(ctx context.Context, jti string, expiresAt time.Time) error
+	// RevokeIssuedBefore revokes every token of userID issued at or before before.
+	// The cutoff is kept until expiresAt, when those tokens have expired anyway.
+	RevokeIssuedBefore(ctx context.Context, userID string, before, expiresAt time.Time) error
+	// IsRevoked reports whether token jti of userID, issued at issuedAt, was revoked
+	IsRevoked(ctx context.Context, jti, userID string, issuedAt time.Time) (bool, error)
+}
+
+// EventRetention is how long a processed webhook event ID is remembered
+const EventRetention = 30 * 24 * time.Hour
+
+// EventStore remembers which webhook events have been processed
+type EventStore interface {
+	// Claim records eventID and reports false if it was already recorded
+	Claim(ctx context.Context, eventID string) (bool, error)
+	// Release forgets eventID so a retry of a failed event is processed again
+	Release(ctx context.Context, eventID string) error
+}
+
+// IdempotencyTTL is how long a stored response is replayed for its Idempotency-Key
+const IdempotencyTTL = 24 * time.Hour
+
+// IdempotencyLease is how long a request may hold its Idempotency-Key before a retry
+// can take it over, in case the server died before the request finished
+const IdempotencyLease = time.Minute
+
+// IdempotencyRecord is the first response given to a request carrying an
+// Idempotency-Key. Status stays zero while that request is still running.
+type IdempotencyRecord struct {
+	Key         string    `bson:"_id"`
+	RequestHash string    `bson:"request_hash"`
+	Status      int       `bson:"status"`
+	ContentType string    `bson:"content_type,omitempty"`
+	Body        []byte    `bson:"body,omitempty"`
+	LockedUntil time.Time `bson:"locked_until"`
+	ExpiresAt   time.Time `bson:"expires_at"`
+}
+
+// IdempotencyStore keeps responses so retried requests can be answered from them
+type IdempotencyStore interface {
+	// Reserve claims key for a request. If the key is already taken it returns the
+	// existing record and false instead, unless the request holding it is still
+	// running past its lease, in which case the key is taken over.
+	Reserve(ctx context.Context, key, requestHash string) (*IdempotencyRecord, bool, error)
+	Complete(ctx context.Context, key string, status int, contentType string, body []byte) error
+	// Release frees key so the request can be tried again
+	Release(ctx context.Context, key string) error
+}
+
+// Stores bundles one implementation of every store
+type Stores struct {
+	Users       UserStore
+	Products    ProductStore
+	Orders      OrderStore
+	Coupons     CouponStore
+	TaxRules    TaxRuleStore
+	Shipping    ShippingRateStore
+	Shipments   ShipmentStore
+	Rates       ExchangeRateStore
+	Tokens      TokenStore
+	Events      EventStore
+	Idempotency IdempotencyStore
+}
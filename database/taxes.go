@@ -0,0 +1,90 @@
+package database
+
+import (
+	"context"
+	"errors"
+
+	"github.com/nerokome/econo/models"
+)
+
+var (
+	ErrTaxRuleNotFound = errors.New("tax rule not found")
+)
+
+/*
+CalculateTax itemizes the tax on each line shipped to address. Each line is taxed by
+the most specific active rule matching the address and the product's category, on
+its price after the discounts. Lines no rule matches are not taxed.
+*/
+func CalculateTax(
+	rules []models.TaxRule,
+	address models.Address,
+	lines []models.ProductUser,
+	discounts []models.AppliedDiscount,
+) []models.TaxLine {
+
+	var taxes []models.TaxLine
+	for _, line := range lines {
+		var rule *models.TaxRule
+		best := -1
+		for i := range rules {
+			if !rules[i].Active {
+				continue
+			}
+			// Ties go to the older rule
+			if score := rules[i].Specificity(address, line.Category); score > best {
+				rule, best = &rules[i], score
+			}
+		}
+		if rule == nil || rule.Rate <= 0 {
+			continue
+		}
+
+		taxable := line.Price.Mul(int64(line.Quantity))
+		for _, d := range discounts {
+			for _, dl := range d.Lines {
+				if dl.ProductID == line.ID {
+					taxable = taxable.Sub(dl.Amount)
+				}
+			}
+		}
+		taxable = taxable.Max(models.Money{})
+
+		amount := taxable.Percent(rule.Rate)
+		if rule.Inclusive {
+			amount = taxable.Scale(rule.Rate / (100 + rule.Rate))
+		}
+
+		taxes = append(taxes, models.TaxLine{
+			ProductID: line.ID,
+			RuleID:    rule.ID,
+			Name:      rule.Name,
+			Rate:      rule.Rate,
+			Inclusive: rule.Inclusive,
+			Taxable:   taxable,
+			Amount:    amount,
+		})
+	}
+	return taxes
+}
+
+// totalTax sums every tax line, inclusive or not
+func totalTax(lines []models.TaxLine) models.Money {
+	total := models.NewMoney(0, models.BaseCurrency())
+	for _, line := range lines {
+		total = total.Add(line.Amount)
+	}
+	return total
+}
+
+// orderTax works out the tax on an order about to be placed and records it on the
+// order. Discounts have to be settled first since tax is charged after them.
+func orderTax(ctx context.Context, taxRules TaxRuleStore, order *models.Order) error {
+	rules, err := taxRules.List(ctx)
+	if err != nil {
+		return err
+	}
+	order.Taxes = CalculateTax(rules, order.Address, order.OrderCart, order.Discounts)
+	order.Tax = totalTax(order.Taxes)
+	return nil
+}
@@ -0,0 +1,114 @@
+package database
+
+import (
+	"testing"
+
+	"github.com/nerokome/econo/models"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestCalculateTax(t *testing.T) {
+	base := models.BaseCurrency()
+	rule := func(name, city, pincode, category string, rate float64) models.TaxRule {
+		return models.TaxRule{
+			ID:       primitive.NewObjectID(),
+			Name:     name,
+			City:     city,
+			Pincode:  pincode,
+			Category: category,
+			Rate:     rate,
+			Active:   true,
+		}
+	}
+	everywhere := rule("everywhere", "", "", "", 5)
+	city := rule("city", "Pune", "", "", 10)
+	cityBooks := rule("city books", "Pune", "", "books", 8)
+	pincode := rule("pincode", "", "411001", "", 12)
+	inactive := pincode
+	inactive.Active = false
+	inclusive := rule("inclusive", "", "", "", 18)
+	inclusive.Inclusive = true
+
+	tests := []struct {
+		name     string
+		rules    []models.TaxRule
+		city     string
+		pincode  string
+		price    int64
+		quantity int
+		discount int64
+		// wantRule is the name of the rule applied, or empty for no tax
+		wantRule    string
+		wantTaxable int64
+		wantAmount  int64
+	}{
+		{name: "catch-all", rules: []models.TaxRule{everywhere}, price: 1000, wantRule: "everywhere", wantTaxable: 1000, wantAmount: 50},
+		{name: "city over everywhere", rules: []models.TaxRule{everywhere, city}, price: 1000, wantRule: "city", wantTaxable: 1000, wantAmount: 100},
+		{name: "pincode over city", rules: []models.TaxRule{everywhere, city, pincode}, price: 1000, wantRule: "pincode", wantTaxable: 1000, wantAmount: 120},
+		{name: "another pincode in the city", rules: []models.TaxRule{city, pincode}, pincode: "411002", price: 1000, wantRule: "city", wantTaxable: 1000, wantAmount: 100},
+		{name: "city matched loosely", rules: []models.TaxRule{everywhere, city}, city: " pune", price: 1000, wantRule: "city", wantTaxable: 1000, wantAmount: 100},
+		{name: "category over catch-all in one city", rules: []models.TaxRule{city, cityBooks}, price: 1000, wantRule: "city books", wantTaxable: 1000, wantAmount: 80},
+		{name: "pincode over city category", rules: []models.TaxRule{cityBooks, pincode}, price: 1000, wantRule: "pincode", wantTaxable: 1000, wantAmount: 120},
+		{name: "inactive rule skipped", rules: []models.TaxRule{city, inactive}, price: 1000, wantRule: "city", wantTaxable: 1000, wantAmount: 100},
+		{name: "tie goes to the older rule", rules: []models.TaxRule{city, rule("newer city", "Pune", "", "", 9)}, price: 1000, wantRule: "city", wantTaxable: 1000, wantAmount: 100},
+		{name: "no rule for the address", rules: []models.TaxRule{rule("elsewhere", "Mumbai", "", "", 10)}, price: 1000},
+		{name: "every unit taxed", rules: []models.TaxRule{city}, price: 1000, quantity: 3, wantRule: "city", wantTaxable: 3000, wantAmount: 300},
+		{name: "inclusive rate", rules: []models.TaxRule{inclusive}, price: 1180, wantRule: "inclusive", wantTaxable: 1180, wantAmount: 180},
+		{name: "after the discount", rules: []models.TaxRule{city}, price: 1000, discount: 200, wantRule: "city", wantTaxable: 800, wantAmount: 80},
+		{name: "inclusive after the discount", rules: []models.TaxRule{inclusive}, price: 1180, discount: 590, wantRule: "inclusive", wantTaxable: 590, wantAmount: 90},
+		{name: "discounted to nothing", rules: []models.TaxRule{city}, price: 1000, discount: 1000, wantRule: "city"},
+		{name: "rounded to the minor unit", rules: []models.TaxRule{city}, price: 1005, wantRule: "city", wantTaxable: 1005, wantAmount: 101},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			address := models.Address{City: "Pune", Pincode: "411001"}
+			if tt.city != "" {
+				address.City = tt.city
+			}
+			if tt.pincode != "" {
+				address.Pincode = tt.pincode
+			}
+			quantity := tt.quantity
+			if quantity == 0 {
+				quantity = 1
+			}
+			line := models.ProductUser{
+				ID:       primitive.NewObjectID(),
+				Price:    models.NewMoney(tt.price, base),
+				Category: "books",
+				Quantity: quantity,
+			}
+			var discounts []models.AppliedDiscount
+			if tt.discount > 0 {
+				// A discount on another product leaves this line alone
+				discounts = []models.AppliedDiscount{{Lines: []models.DiscountLine{
+					{ProductID: line.ID, Amount: models.NewMoney(tt.discount, base)},
+					{ProductID: primitive.NewObjectID(), Amount: models.NewMoney(100, base)},
+				}}}
+			}
+
+			taxes := CalculateTax(tt.rules, address, []models.ProductUser{line}, discounts)
+			if tt.wantRule == "" {
+				if len(taxes) != 0 {
+					t.Errorf("taxes = %v, want none", taxes)
+				}
+				return
+			}
+			if len(taxes) != 1 {
+				t.Fatalf("taxes = %d lines, want 1", len(taxes))
+			}
+
+			tax := taxes[0]
+			if tax.Name != tt.wantRule {
+				t.Errorf("rule = %s, want %s", tax.Name, tt.wantRule)
+			}
+			if want := models.NewMoney(tt.wantTaxable, base); tax.Taxable != want {
+				t.Errorf("taxable = %v, want %v", tax.Taxable, want)
+			}
+			if want := models.NewMoney(tt.wantAmount, base); tax.Amount != want {
+				t.Errorf("amount = %v, want %v", tax.Amount, want)
+			}
+		})
+	}
+}
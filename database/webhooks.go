@@ -0,0 +1,102 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"log"
+
+	"github.com/nerokome/econo/models"
+	"github.com/nerokome/econo/payments"
+)
+
+var (
+	ErrDuplicateEvent   = errors.New("event already processed")
+	ErrPaymentMismatch  = errors.New("event does not match the order's payment")
+	ErrUnknownEventType = errors.New("unknown event type")
+)
+
+// gatewayActor is recorded as the author of changes made by payment webhooks
+const gatewayActor = "payment_gateway"
+
+/*
+ApplyPaymentEvent settles an order's payment from a gateway webhook. A captured
+payment moves a pending order to paid and a failed one to payment_failed. The event
+must name the order's payment reference and amount. Each event is applied at most
+once; if applying it fails the event is forgotten so the gateway's retry gets
+another go.
+*/
+func ApplyPaymentEvent(
+	ctx context.Context,
+	orders OrderStore,
+	events EventStore,
+	providers payments.Providers,
+	event payments.WebhookEvent,
+) error {
+
+	claimed, err := events.Claim(ctx, event.ID)
+	if err != nil {
+		return err
+	}
+	if !claimed {
+		return ErrDuplicateEvent
+	}
+
+	if err := applyPaymentEvent(ctx, orders, providers, event); err != nil {
+		if releaseErr := events.Release(ctx, event.ID); releaseErr != nil {
+			log.Println("Release payment event error:", releaseErr)
+		}
+		return err
+	}
+	return nil
+}
+
+func applyPaymentEvent(ctx context.Context, orders OrderStore, providers payments.Providers, event payments.WebhookEvent) error {
+	order, err := orders.FindByID(ctx, event.OrderID)
+	if err != nil {
+		return err
+	}
+	if order.Payment.Reference == "" || event.Reference != order.Payment.Reference {
+		return ErrPaymentMismatch
+	}
+	// Don't take an event for some other sum as settling this payment
+	if event.Amount != order.Payment.Amount {
+		return ErrPaymentMismatch
+	}
+
+	payment := order.Payment
+	switch event.Type {
+	case payments.EventPaymentCaptured:
+		if payment.Status != models.PaymentCaptured {
+			capturedAt := event.CreatedAt
+			payment.Status = models.PaymentCaptured
+			payment.CapturedAt = &capturedAt
+			if err := orders.SetPayment(ctx, order.ID, payment); err != nil {
+				return err
+			}
+			order.Payment = payment
+		}
+
+		switch order.Status {
+		case models.OrderPendingPayment:
+			_, err = AdvanceOrderStatus(ctx, orders, providers, order.ID, models.OrderPaid, gatewayActor, "payment confirmed by gateway")
+		case models.OrderCancelled, models.OrderPaymentFailed:
+			// The money arrived after the order was given up on
+			err = refundRemaining(ctx, orders, providers, order, gatewayActor, "payment captured after the order was closed")
+		}
+		return err
+
+	case payments.EventPaymentFailed:
+		if order.Status != models.OrderPendingPayment {
+			return nil
+		}
+		payment.Status = models.PaymentFailed
+		payment.FailureReason = event.FailureReason
+		if err := orders.SetPayment(ctx, order.ID, payment); err != nil {
+			return err
+		}
+		_, err = AdvanceOrderStatus(ctx, orders, providers, order.ID, models.OrderPaymentFailed, gatewayActor, event.FailureReason)
+		return err
+	}
+
+	return ErrUnknownEventType
+}
@@ -0,0 +1,146 @@
+package database
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/nerokome/econo/models"
+	"github.com/nerokome/econo/payments"
+)
+
+// pendingCardOrder places a card order whose capture waits for a webhook
+func pendingCardOrder(t *testing.T, f *fixture) *models.Order {
+	t.Helper()
+
+	gateway := f.providers[models.PaymentModeDigital].(*payments.MockGateway)
+	// The test posts the outcome itself, so the gateway's own webhook goes nowhere
+	gateway.EmitWebhooks([]byte("secret"), func(context.Context, []byte, string) error { return nil }, time.Hour)
+
+	product := f.product(t, 500, 5, 3)
+	order := f.mustBuy(t, product.ID, 2, models.PaymentModeDigital, payments.MockTokenApproved)
+	if order.Status != models.OrderPendingPayment {
+		t.Fatalf("status = %s, want %s", order.Status, models.OrderPendingPayment)
+	}
+	return order
+}
+
+func TestApplyPaymentEvent(t *testing.T) {
+	tests := []struct {
+		name        string
+		eventType   string
+		reference   string
+		amount      int64
+		wantErr     error
+		wantStatus  string
+		wantPayment string
+	}{
+		{
+			name:        "captured",
+			eventType:   payments.EventPaymentCaptured,
+			wantStatus:  models.OrderPaid,
+			wantPayment: models.PaymentCaptured,
+		},
+		{
+			name:        "failed",
+			eventType:   payments.EventPaymentFailed,
+			wantStatus:  models.OrderPaymentFailed,
+			wantPayment: models.PaymentFailed,
+		},
+		{
+			name:        "captured for another amount",
+			eventType:   payments.EventPaymentCaptured,
+			amount:      1,
+			wantErr:     ErrPaymentMismatch,
+			wantStatus:  models.OrderPendingPayment,
+			wantPayment: models.PaymentPending,
+		},
+		{
+			name:        "captured for another payment",
+			eventType:   payments.EventPaymentCaptured,
+			reference:   "mock_other",
+			wantErr:     ErrPaymentMismatch,
+			wantStatus:  models.OrderPendingPayment,
+			wantPayment: models.PaymentPending,
+		},
+		{
+			name:        "unknown type",
+			eventType:   "payment.disputed",
+			wantErr:     ErrUnknownEventType,
+			wantStatus:  models.OrderPendingPayment,
+			wantPayment: models.PaymentPending,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			f := newFixture(t)
+			order := pendingCardOrder(t, f)
+
+			event := payments.WebhookEvent{
+				ID:        "evt_1",
+				Type:      tt.eventType,
+				OrderID:   order.ID,
+				Reference: order.Payment.Reference,
+				Amount:    order.Payment.Amount,
+				CreatedAt: time.Now(),
+			}
+			if tt.reference != "" {
+				event.Reference = tt.reference
+			}
+			if tt.amount != 0 {
+				event.Amount = models.NewMoney(tt.amount, event.Amount.Currency)
+			}
+
+			err := ApplyPaymentEvent(ctx, f.stores.Orders, f.stores.Events, f.providers, event)
+			if err != tt.wantErr {
+				t.Fatalf("err = %v, want %v", err, tt.wantErr)
+			}
+
+			order = f.order(t, order.ID)
+			if order.Status != tt.wantStatus {
+				t.Errorf("status = %s, want %s", order.Status, tt.wantStatus)
+			}
+			if order.Payment.Status != tt.wantPayment {
+				t.Errorf("payment = %s, want %s", order.Payment.Status, tt.wantPayment)
+			}
+
+			// A rejected event is forgotten, so the gateway's corrected retry still applies
+			if err != nil {
+				if claimed, err := f.stores.Events.Claim(ctx, event.ID); err != nil || !claimed {
+					t.Errorf("claim after rejection = %v, %v, want the event released", claimed, err)
+				}
+			}
+		})
+	}
+}
+
+func TestApplyPaymentEventOnce(t *testing.T) {
+	ctx := context.Background()
+	f := newFixture(t)
+	order := pendingCardOrder(t, f)
+
+	event := payments.WebhookEvent{
+		ID:        "evt_1",
+		Type:      payments.EventPaymentCaptured,
+		OrderID:   order.ID,
+		Reference: order.Payment.Reference,
+		Amount:    order.Payment.Amount,
+		CreatedAt: time.Now(),
+	}
+	if err := ApplyPaymentEvent(ctx, f.stores.Orders, f.stores.Events, f.providers, event); err != nil {
+		t.Fatalf("first delivery: %v", err)
+	}
+	paid := f.order(t, order.ID)
+	if paid.Status != models.OrderPaid {
+		t.Fatalf("status = %s, want %s", paid.Status, models.OrderPaid)
+	}
+
+	if err := ApplyPaymentEvent(ctx, f.stores.Orders, f.stores.Events, f.providers, event); err != ErrDuplicateEvent {
+		t.Fatalf("redelivery err = %v, want %v", err, ErrDuplicateEvent)
+	}
+	if order = f.order(t, order.ID); len(order.StatusHistory) != len(paid.StatusHistory) {
+		t.Errorf("status history = %d entries, want %d as after the first delivery", len(order.StatusHistory), len(paid.StatusHistory))
+	}
+}
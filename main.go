@@ -1,13 +1,18 @@
 package main
 
 import (
+	"context"
 	"log"
 	"os"
+	"strconv"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/joho/godotenv"
 	"github.com/nerokome/econo/controllers"
 	"github.com/nerokome/econo/database"
+	"github.com/nerokome/econo/models"
+	"github.com/nerokome/econo/payments"
 	"github.com/nerokome/econo/routes"
 )
 
@@ -23,13 +28,55 @@ func main() {
 	}
 
 	
-	client := database.DBSet()
+	var stores database.Stores
+	if os.Getenv("STORE_BACKEND") == "memory" {
+		log.Println("Using in-memory stores, data will be lost on restart")
+		stores = database.NewMemoryStores()
+	} else {
+		client := database.DBSet()
 
-	
-	app := controllers.NewApplication(
-		database.Collection(client, "products"),
-		database.Collection(client, "users"),
-	)
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		// Unique emails, coupon codes and tracking numbers rely on these indexes
+		if err := database.EnsureMongoIndexes(ctx, client); err != nil {
+			log.Fatal("Could not create indexes:", err)
+		}
+		cancel()
+
+		ctx, cancel = context.WithTimeout(context.Background(), 5*time.Minute)
+		if err := database.MigrateCarts(ctx, client); err != nil {
+			log.Fatal("Cart migration failed:", err)
+		}
+		cancel()
+
+		ctx, cancel = context.WithTimeout(context.Background(), 5*time.Minute)
+		if err := database.MigrateMoney(ctx, client, models.BaseCurrency()); err != nil {
+			log.Fatal("Money migration failed:", err)
+		}
+		cancel()
+
+		ctx, cancel = context.WithTimeout(context.Background(), time.Minute)
+		if err := database.MigrateStock(ctx, client, initialStock()); err != nil {
+			log.Fatal("Stock migration failed:", err)
+		}
+		cancel()
+
+		stores = database.NewMongoStores(client)
+	}
+
+	// Only the offline providers exist so far; a real card gateway plugs in here
+	providers := payments.NewLocalProviders()
+
+	app := controllers.NewApplication(stores, providers)
+
+	// With a webhook secret the mock gateway confirms card captures asynchronously,
+	// calling back into the webhook handler in process
+	if secret, err := payments.WebhookSecret(); err == nil {
+		if mock, ok := providers[models.PaymentModeDigital].(*payments.MockGateway); ok {
+			mock.EmitWebhooks(secret, app.DeliverPaymentWebhook, 2*time.Second)
+		}
+	}
+
+	database.StartReservationSweeper(context.Background(), stores.Orders, providers, time.Minute)
 
 	router := gin.New()
 	router.Use(gin.Logger(), gin.Recovery())
@@ -39,3 +86,17 @@ func main() {
 
 	log.Fatal(router.Run(":" + port))
 }
+
+// initialStock is the stock INITIAL_STOCK gives products saved before stock was
+// tracked; without it they start sold out
+func initialStock() int {
+	value := os.Getenv("INITIAL_STOCK")
+	if value == "" {
+		return 0
+	}
+	stock, err := strconv.Atoi(value)
+	if err != nil || stock < 0 {
+		log.Fatal("INITIAL_STOCK must be a whole number of units, got ", value)
+	}
+	return stock
+}
@@ -0,0 +1,152 @@
+package middleware
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/nerokome/econo/database"
+)
+
+const (
+	IdempotencyKeyHeader = "Idempotency-Key"
+	// IdempotentReplayedHeader marks a response answered from an earlier request
+	IdempotentReplayedHeader = "Idempotent-Replayed"
+	// CurrencyHeader picks the currency amounts are shown and charged in
+	CurrencyHeader = "X-Currency"
+
+	maxIdempotencyKeyLength = 255
+)
+
+// recordingWriter keeps a copy of everything the handler writes
+type recordingWriter struct {
+	gin.ResponseWriter
+	body bytes.Buffer
+}
+
+func (w *recordingWriter) Write(b []byte) (int, error) {
+	w.body.Write(b)
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *recordingWriter) WriteString(s string) (int, error) {
+	w.body.WriteString(s)
+	return w.ResponseWriter.WriteString(s)
+}
+
+// Idempotency makes a request carrying an Idempotency-Key safe to retry. The first
+// response is stored and replayed for retries with the same key, query, currency and
+// body; reusing a key for a different request is rejected. Keys are scoped to the
+// authenticated user, so it must run after Authenticate. Requests without the header
+// pass straight through.
+func Idempotency(store database.IdempotencyStore) gin.HandlerFunc {
+	return func(c *gin.Context) {
+
+		key := c.GetHeader(IdempotencyKeyHeader)
+		if key == "" {
+			c.Next()
+			return
+		}
+		if len(key) > maxIdempotencyKeyLength {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "Idempotency-Key is too long",
+			})
+			c.Abort()
+			return
+		}
+
+		body, err := io.ReadAll(c.Request.Body)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "unable to read body",
+			})
+			c.Abort()
+			return
+		}
+		c.Request.Body = io.NopCloser(bytes.NewReader(body))
+
+		hash := sha256.New()
+		hash.Write([]byte(c.Request.Method + " " + c.Request.URL.RequestURI() + "\n"))
+		hash.Write([]byte(c.GetHeader(CurrencyHeader) + "\n"))
+		hash.Write(body)
+		requestHash := hex.EncodeToString(hash.Sum(nil))
+
+		storeKey := c.GetString("user_id") + ":" + key
+
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		record, reserved, err := store.Reserve(ctx, storeKey, requestHash)
+		if err == database.ErrKeyChanged {
+			c.JSON(http.StatusConflict, gin.H{
+				"error": "a request with this Idempotency-Key is in progress",
+			})
+			c.Abort()
+			return
+		}
+		if err != nil {
+			log.Println("Idempotency error:", err)
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error": "database error",
+			})
+			c.Abort()
+			return
+		}
+
+		if !reserved {
+			switch {
+			case record.RequestHash != requestHash:
+				c.JSON(http.StatusUnprocessableEntity, gin.H{
+					"error": "Idempotency-Key was already used for a different request",
+				})
+			case record.Status == 0:
+				c.JSON(http.StatusConflict, gin.H{
+					"error": "a request with this Idempotency-Key is in progress",
+				})
+			default:
+				c.Header(IdempotentReplayedHeader, "true")
+				c.Data(record.Status, record.ContentType, record.Body)
+			}
+			c.Abort()
+			return
+		}
+
+		writer := &recordingWriter{ResponseWriter: c.Writer}
+		c.Writer = writer
+
+		// A panicking handler must not leave the key stuck in progress
+		defer func() {
+			if r := recover(); r != nil {
+				releaseCtx, releaseCancel := context.WithTimeout(context.Background(), 5*time.Second)
+				defer releaseCancel()
+				if err := store.Release(releaseCtx, storeKey); err != nil {
+					log.Println("Idempotency error:", err)
+				}
+				panic(r)
+			}
+		}()
+
+		c.Next()
+
+		// ctx may have run out while the handler worked
+		saveCtx, saveCancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer saveCancel()
+
+		status := writer.Status()
+		if status >= http.StatusInternalServerError {
+			// Server errors may be transient; let a retry run the request again
+			err = store.Release(saveCtx, storeKey)
+		} else {
+			err = store.Complete(saveCtx, storeKey, status, writer.Header().Get("Content-Type"), writer.body.Bytes())
+		}
+		if err != nil {
+			log.Println("Idempotency error:", err)
+		}
+	}
+}
@@ -0,0 +1,121 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/nerokome/econo/database"
+)
+
+func TestIdempotency(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	type request struct {
+		key  string
+		body string
+	}
+	tests := []struct {
+		name         string
+		handler      string
+		requests     []request
+		wantStatus   []int
+		wantCalls    int
+		wantReplayed bool
+	}{
+		{
+			name:         "retry is replayed",
+			handler:      "ok",
+			requests:     []request{{"k1", `{"a":1}`}, {"k1", `{"a":1}`}},
+			wantStatus:   []int{http.StatusCreated, http.StatusCreated},
+			wantCalls:    1,
+			wantReplayed: true,
+		},
+		{
+			name:       "key reused for another body",
+			handler:    "ok",
+			requests:   []request{{"k1", `{"a":1}`}, {"k1", `{"a":2}`}},
+			wantStatus: []int{http.StatusCreated, http.StatusUnprocessableEntity},
+			wantCalls:  1,
+		},
+		{
+			name:       "different keys",
+			handler:    "ok",
+			requests:   []request{{"k1", `{"a":1}`}, {"k2", `{"a":1}`}},
+			wantStatus: []int{http.StatusCreated, http.StatusCreated},
+			wantCalls:  2,
+		},
+		{
+			name:       "no key",
+			handler:    "ok",
+			requests:   []request{{"", `{"a":1}`}, {"", `{"a":1}`}},
+			wantStatus: []int{http.StatusCreated, http.StatusCreated},
+			wantCalls:  2,
+		},
+		{
+			name:       "server error runs again",
+			handler:    "fail",
+			requests:   []request{{"k1", `{"a":1}`}, {"k1", `{"a":1}`}},
+			wantStatus: []int{http.StatusInternalServerError, http.StatusInternalServerError},
+			wantCalls:  2,
+		},
+		{
+			name:       "panic releases the key",
+			handler:    "panic",
+			requests:   []request{{"k1", `{"a":1}`}, {"k1", `{"a":1}`}},
+			wantStatus: []int{http.StatusInternalServerError, http.StatusInternalServerError},
+			wantCalls:  2,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			calls := 0
+			router := gin.New()
+			router.Use(gin.CustomRecovery(func(c *gin.Context, err any) {
+				c.AbortWithStatus(http.StatusInternalServerError)
+			}))
+			router.Use(func(c *gin.Context) {
+				c.Set("user_id", "user")
+			})
+			router.Use(Idempotency(database.NewMemoryIdempotencyStore()))
+			router.POST("/orders", func(c *gin.Context) {
+				calls++
+				switch tt.handler {
+				case "fail":
+					c.JSON(http.StatusInternalServerError, gin.H{"error": "database error"})
+				case "panic":
+					panic("handler failed")
+				default:
+					c.JSON(http.StatusCreated, gin.H{"order": calls})
+				}
+			})
+
+			var last *httptest.ResponseRecorder
+			for i, r := range tt.requests {
+				req := httptest.NewRequest(http.MethodPost, "/orders", strings.NewReader(r.body))
+				if r.key != "" {
+					req.Header.Set(IdempotencyKeyHeader, r.key)
+				}
+				last = httptest.NewRecorder()
+				router.ServeHTTP(last, req)
+
+				if last.Code != tt.wantStatus[i] {
+					t.Errorf("request %d: status = %d, want %d", i, last.Code, tt.wantStatus[i])
+				}
+			}
+
+			if calls != tt.wantCalls {
+				t.Errorf("handler calls = %d, want %d", calls, tt.wantCalls)
+			}
+			if replayed := last.Header().Get(IdempotentReplayedHeader) == "true"; replayed != tt.wantReplayed {
+				t.Errorf("replayed = %v, want %v", replayed, tt.wantReplayed)
+			}
+			if tt.wantReplayed && last.Body.String() != `{"order":1}` {
+				t.Errorf("body = %s, want the first response", last.Body.String())
+			}
+		})
+	}
+}
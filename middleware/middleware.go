@@ -1,14 +1,21 @@
 package middleware
 
 import (
+	"context"
 	"net/http"
+	"slices"
 	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/nerokome/econo/database"
+	"github.com/nerokome/econo/models"
 	"github.com/nerokome/econo/utils"
 )
 
-func Authenticate() gin.HandlerFunc {
+// Authenticate accepts a bearer access token that is correctly signed, unexpired
+// and not on the revocation list
+func Authenticate(revokedTokens database.TokenStore) gin.HandlerFunc {
 	return func(c *gin.Context) {
 
 		authHeader := c.GetHeader("Authorization")
@@ -38,6 +45,14 @@ func Authenticate() gin.HandlerFunc {
 			return
 		}
 
+		if tokenType, _ := claims["token_type"].(string); tokenType != utils.TokenTypeAccess {
+			c.JSON(http.StatusUnauthorized, gin.H{
+				"error": "access token required",
+			})
+			c.Abort()
+			return
+		}
+
 		userID, ok := claims["user_id"].(string)
 		if !ok || userID == "" {
 			c.JSON(http.StatusUnauthorized, gin.H{
@@ -47,8 +62,66 @@ func Authenticate() gin.HandlerFunc {
 			return
 		}
 
+		jti, ok := claims["jti"].(string)
+		if !ok || jti == "" {
+			c.JSON(http.StatusUnauthorized, gin.H{
+				"error": "jti missing in token",
+			})
+			c.Abort()
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		revoked, err := revokedTokens.IsRevoked(ctx, jti, userID, utils.TokenIssuedAt(claims))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error": "failed to verify token",
+			})
+			c.Abort()
+			return
+		}
+		if revoked {
+			c.JSON(http.StatusUnauthorized, gin.H{
+				"error": "token has been revoked",
+			})
+			c.Abort()
+			return
+		}
+
 		// Inject into context
 		c.Set("user_id", userID)
+		c.Set("jti", jti)
+		c.Set("token_exp", utils.TokenExpiry(claims))
+		if family, ok := claims["family"].(string); ok {
+			c.Set("token_family", family)
+		}
+		role, _ := claims["role"].(string)
+		if !models.ValidRole(role) {
+			role = models.RoleCustomer
+		}
+		c.Set("role", role)
+		if email, ok := claims["email"].(string); ok {
+			c.Set("email", email)
+		}
+		c.Next()
+	}
+}
+
+// RequireRole only lets through requests whose token carries one of the given roles.
+// It must run after Authenticate.
+func RequireRole(roles ...string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+
+		if !slices.Contains(roles, c.GetString("role")) {
+			c.JSON(http.StatusForbidden, gin.H{
+				"error": "insufficient permissions",
+			})
+			c.Abort()
+			return
+		}
+
 		c.Next()
 	}
 }
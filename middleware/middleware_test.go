@@ -0,0 +1,53 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/nerokome/econo/models"
+)
+
+func TestRequireRole(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	tests := []struct {
+		name       string
+		role       string
+		allowed    []string
+		wantStatus int
+	}{
+		{name: "admin", role: models.RoleAdmin, allowed: []string{models.RoleAdmin}, wantStatus: http.StatusOK},
+		{name: "customer", role: models.RoleCustomer, allowed: []string{models.RoleAdmin}, wantStatus: http.StatusForbidden},
+		{name: "staff", role: models.RoleStaff, allowed: []string{models.RoleAdmin}, wantStatus: http.StatusForbidden},
+		{name: "staff where staff is allowed", role: models.RoleStaff, allowed: []string{models.RoleAdmin, models.RoleStaff}, wantStatus: http.StatusOK},
+		{name: "no role", allowed: []string{models.RoleAdmin}, wantStatus: http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			called := false
+			router := gin.New()
+			router.Use(func(c *gin.Context) {
+				if tt.role != "" {
+					c.Set("role", tt.role)
+				}
+			})
+			router.GET("/admin", RequireRole(tt.allowed...), func(c *gin.Context) {
+				called = true
+				c.Status(http.StatusOK)
+			})
+
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/admin", nil))
+
+			if w.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d", w.Code, tt.wantStatus)
+			}
+			if want := tt.wantStatus == http.StatusOK; called != want {
+				t.Errorf("handler called = %v, want %v", called, want)
+			}
+		})
+	}
+}
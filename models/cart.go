@@ -0,0 +1,49 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// CartItem is one line of a user's cart. UnitPrice is the product price
+// when the line was first added.
+type CartItem struct {
+	ProductID primitive.ObjectID `json:"product_id" bson:"product_id"`
+	Quantity  int                `json:"quantity" bson:"quantity"`
+	UnitPrice Money              `json:"unit_price" bson:"unit_price"`
+	AddedAt   time.Time          `json:"added_at" bson:"added_at"`
+}
+
+// CartLine is one cart entry resolved against the current catalog.
+// Unavailable lines were deleted from the catalog and don't count towards the total.
+// OutOfStock lines ask for more units than are in stock and would fail at checkout.
+type CartLine struct {
+	Product      ProductUser `json:"product"`
+	AddedPrice   Money       `json:"added_price"`
+	Quantity     int         `json:"quantity"`
+	MaxQuantity  int         `json:"max_quantity"`
+	Subtotal     Money       `json:"subtotal"`
+	AddedAt      time.Time   `json:"added_at"`
+	Unavailable  bool        `json:"unavailable"`
+	PriceChanged bool        `json:"price_changed"`
+	OutOfStock   bool        `json:"out_of_stock"`
+}
+
+// CartSummary is a hydrated cart with its totals. Coupon shows what the applied
+// coupon takes off, or CouponError why it no longer applies to this cart. Taxes are
+// worked out for the address the cart would ship to, if the user has one. Display
+// repeats the totals in the currency the customer asked to see.
+type CartSummary struct {
+	Items       []CartLine       `json:"items"`
+	ItemCount   int              `json:"item_count"`
+	Total       Money            `json:"total"`
+	Coupon      *AppliedDiscount `json:"coupon,omitempty"`
+	CouponError string           `json:"coupon_error,omitempty"`
+	Discount    Money            `json:"discount"`
+	TaxAddress  *Address         `json:"tax_address,omitempty"`
+	Taxes       []TaxLine        `json:"taxes,omitempty"`
+	Tax         Money            `json:"tax"`
+	Payable     Money            `json:"payable"`
+	Display     *CurrencyTotals  `json:"display,omitempty"`
+}
@@ -0,0 +1,90 @@
+package models
+
+import (
+	"slices"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Coupon discount types
+const (
+	CouponPercentage = "percentage"
+	CouponFixed      = "fixed"
+)
+
+/*
+Coupon is a promotion customers redeem by code. Percentage coupons take Value percent
+off, capped at MaxDiscount when that is set; fixed ones take off Amount. Zero limits,
+an empty window and no product or category scope all mean unrestricted. Redemptions
+counts uses per user ID.
+*/
+type Coupon struct {
+	ID           primitive.ObjectID   `json:"_id" bson:"_id"`
+	Code         string               `json:"code" bson:"code"`
+	Description  string               `json:"description,omitempty" bson:"description,omitempty"`
+	Type         string               `json:"type" bson:"type"`
+	Value        float64              `json:"value,omitempty" bson:"value,omitempty"`
+	Amount       Money                `json:"amount" bson:"amount,omitempty"`
+	MaxDiscount  Money                `json:"max_discount" bson:"max_discount,omitempty"`
+	MinCartValue Money                `json:"min_cart_value" bson:"min_cart_value,omitempty"`
+	UsageLimit   int                  `json:"usage_limit,omitempty" bson:"usage_limit,omitempty"`
+	PerUserLimit int                  `json:"per_user_limit,omitempty" bson:"per_user_limit,omitempty"`
+	UsedCount    int                  `json:"used_count" bson:"used_count"`
+	Redemptions  map[string]int       `json:"-" bson:"redemptions,omitempty"`
+	StartsAt     *time.Time           `json:"starts_at,omitempty" bson:"starts_at,omitempty"`
+	EndsAt       *time.Time           `json:"ends_at,omitempty" bson:"ends_at,omitempty"`
+	ProductIDs   []primitive.ObjectID `json:"product_ids,omitempty" bson:"product_ids,omitempty"`
+	Categories   []string             `json:"categories,omitempty" bson:"categories,omitempty"`
+	Active       bool                 `json:"active" bson:"active"`
+	CreatedAt    time.Time            `json:"created_at" bson:"created_at"`
+	CreatedBy    string               `json:"created_by" bson:"created_by"`
+}
+
+// NormalizeCouponCode makes coupon codes case-insensitive
+func NormalizeCouponCode(code string) string {
+	return strings.ToUpper(strings.TrimSpace(code))
+}
+
+// ValidCouponType reports whether t is a known discount type
+func ValidCouponType(t string) bool {
+	return t == CouponPercentage || t == CouponFixed
+}
+
+// InWindow reports whether the coupon may be used at t
+func (c *Coupon) InWindow(t time.Time) bool {
+	if c.StartsAt != nil && t.Before(*c.StartsAt) {
+		return false
+	}
+	if c.EndsAt != nil && !t.Before(*c.EndsAt) {
+		return false
+	}
+	return true
+}
+
+// Covers reports whether the coupon's scope includes a product line
+func (c *Coupon) Covers(line ProductUser) bool {
+	if len(c.ProductIDs) == 0 && len(c.Categories) == 0 {
+		return true
+	}
+	return slices.Contains(c.ProductIDs, line.ID) ||
+		(line.Category != "" && slices.Contains(c.Categories, line.Category))
+}
+
+// AppliedDiscount is the breakdown of what a coupon took off an order. Value is the
+// percentage of percentage coupons.
+type AppliedDiscount struct {
+	CouponID primitive.ObjectID `json:"coupon_id" bson:"coupon_id"`
+	Code     string             `json:"code" bson:"code"`
+	Type     string             `json:"type" bson:"type"`
+	Value    float64            `json:"value,omitempty" bson:"value,omitempty"`
+	Amount   Money              `json:"amount" bson:"amount"`
+	Lines    []DiscountLine     `json:"lines" bson:"lines"`
+}
+
+// DiscountLine is the share of a discount taken off one product line
+type DiscountLine struct {
+	ProductID primitive.ObjectID `json:"product_id" bson:"product_id"`
+	Amount    Money              `json:"amount" bson:"amount"`
+}
@@ -0,0 +1,51 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+/*
+ExchangeRate is one row of the exchange-rate table: from EffectiveFrom on, one unit
+of Base is worth Rate units of Currency, until a row for the same pair with a later
+EffectiveFrom takes over. Rows are never edited, so orders can keep the one they
+were charged at.
+*/
+type ExchangeRate struct {
+	ID            primitive.ObjectID `json:"_id" bson:"_id"`
+	Base          string             `json:"base" bson:"base"`
+	Currency      string             `json:"currency" bson:"currency"`
+	Rate          float64            `json:"rate" bson:"rate"`
+	EffectiveFrom time.Time          `json:"effective_from" bson:"effective_from"`
+	CreatedAt     time.Time          `json:"created_at" bson:"created_at"`
+	CreatedBy     string             `json:"created_by" bson:"created_by"`
+}
+
+// Convert changes an amount in the base currency into the rate's currency
+func (r *ExchangeRate) Convert(m Money) Money {
+	return m.Convert(r.Currency, r.Rate)
+}
+
+// CheckedConvert is Convert failing with ErrMoneyOverflow rather than panicking
+func (r *ExchangeRate) CheckedConvert(m Money) (Money, error) {
+	return m.CheckedConvert(r.Currency, r.Rate)
+}
+
+// CurrencyTotals are a cart's totals converted to another currency for display
+type CurrencyTotals struct {
+	ExchangeRate ExchangeRate `json:"exchange_rate"`
+	Total        Money        `json:"total"`
+	Discount     Money        `json:"discount"`
+	Tax          Money        `json:"tax"`
+	Payable      Money        `json:"payable"`
+}
+
+// Charged converts an amount in the store currency into the currency the order was
+// paid in, at the rate recorded when it was placed
+func (o *Order) Charged(amount Money) Money {
+	if o.ExchangeRate == nil {
+		return amount
+	}
+	return o.ExchangeRate.Convert(amount)
+}
@@ -6,36 +6,92 @@ import (
 	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
+// Roles a user can hold; anything else is treated as a customer
+const (
+	RoleCustomer = "customer"
+	RoleStaff    = "staff"
+	RoleAdmin    = "admin"
+)
+
+// ValidRole reports whether role is one of the known roles
+func ValidRole(role string) bool {
+	switch role {
+	case RoleCustomer, RoleStaff, RoleAdmin:
+		return true
+	}
+	return false
+}
+
 type User struct {
-	ID             primitive.ObjectID `json:"_id,omitempty" bson:"_id,omitempty"`
-	FirstName      string             `json:"first_name" bson:"first_name"`
-	LastName       string             `json:"last_name" bson:"last_name"`
-	Email          string             `json:"email" bson:"email"`
-	Password       string             `json:"password" bson:"password"`
-	Tokens         []string           `json:"tokens" bson:"tokens"`
-	RefreshTokens  []string           `json:"refresh_tokens" bson:"refresh_tokens"`
-	CreatedAt      time.Time          `json:"created_at" bson:"created_at"`
-	UpdatedAt      time.Time          `json:"updated_at" bson:"updated_at"`
-	UserID         string             `json:"user_id" bson:"user_id"`
-	UserCart       []ProductUser      `json:"user_cart" bson:"user_cart"`
-	AddressDetails []Address          `json:"address_details" bson:"address_details"`
-	OrderStatus    []Order            `json:"order_status" bson:"order_status"`
+	ID             primitive.ObjectID   `json:"_id,omitempty" bson:"_id,omitempty"`
+	FirstName      string               `json:"first_name" bson:"first_name"`
+	LastName       string               `json:"last_name" bson:"last_name"`
+	Email          string               `json:"email" bson:"email"`
+	Password       string               `json:"password,omitempty" bson:"password"`
+	Role           string               `json:"role" bson:"role"`
+	Tokens         []string             `json:"tokens" bson:"tokens"`
+	RefreshTokens  []string             `json:"refresh_tokens" bson:"refresh_tokens"`
+	CreatedAt      time.Time            `json:"created_at" bson:"created_at"`
+	UpdatedAt      time.Time            `json:"updated_at" bson:"updated_at"`
+	UserID         string               `json:"user_id" bson:"user_id"`
+	UserCart       []CartItem           `json:"user_cart" bson:"user_cart"`
+	CartCoupon     string               `json:"cart_coupon,omitempty" bson:"cart_coupon,omitempty"`
+	AddressDetails []Address            `json:"address_details" bson:"address_details"`
+	OrderStatus    []primitive.ObjectID `json:"order_status" bson:"order_status"`
+}
+
+// EffectiveRole returns the user's role, defaulting accounts created before roles existed to customer
+func (u *User) EffectiveRole() string {
+	if ValidRole(u.Role) {
+		return u.Role
+	}
+	return RoleCustomer
 }
 
 type Product struct {
-	ID       primitive.ObjectID `json:"_id,omitempty" bson:"_id,omitempty"`
-	Name     string             `json:"product_name" bson:"product_name"`
-	Price    uint64             `json:"price" bson:"price"`
-	Rating   uint8              `json:"rating" bson:"rating"`
-	ImageURL string             `json:"image_url" bson:"image_url"`
+	ID          primitive.ObjectID `json:"_id,omitempty" bson:"_id,omitempty"`
+	Name        string             `json:"product_name" bson:"product_name"`
+	Price       Money              `json:"price" bson:"price"`
+	Rating      uint8              `json:"rating" bson:"rating"`
+	ImageURL    string             `json:"image_url" bson:"image_url"`
+	Category    string             `json:"category,omitempty" bson:"category,omitempty"`
+	MaxPerOrder int                `json:"max_per_order" bson:"max_per_order"`
+	Stock       int                `json:"stock" bson:"stock"`
+	WeightGrams int                `json:"weight_grams" bson:"weight_grams"`
+	CreatedAt   time.Time          `json:"created_at" bson:"created_at"`
+	UpdatedAt   time.Time          `json:"updated_at" bson:"updated_at"`
+	CreatedBy   string             `json:"created_by" bson:"created_by"`
+	UpdatedBy   string             `json:"updated_by,omitempty" bson:"updated_by,omitempty"`
+	DeletedAt   *time.Time         `json:"deleted_at,omitempty" bson:"deleted_at,omitempty"`
+}
+
+// DefaultMaxPerOrder applies to products without their own MaxPerOrder
+const DefaultMaxPerOrder = 10
+
+// QuantityLimit returns the most units of the product a single cart may hold.
+// A zero MaxPerOrder falls back to DefaultMaxPerOrder.
+func (p *Product) QuantityLimit() int {
+	if p.MaxPerOrder > 0 {
+		return p.MaxPerOrder
+	}
+	return DefaultMaxPerOrder
+}
+
+// Available returns how many units can go in a cart right now, bounded by stock
+func (p *Product) Available() int {
+	return max(0, min(p.QuantityLimit(), p.Stock))
 }
 
 type ProductUser struct {
 	ID       primitive.ObjectID `json:"_id,omitempty" bson:"_id,omitempty"`
 	Name     string             `json:"product_name" bson:"product_name"`
-	Price    uint64             `json:"price" bson:"price"`
+	Price    Money              `json:"price" bson:"price"`
 	Rating   uint8              `json:"rating" bson:"rating"`
 	ImageURL string             `json:"image_url" bson:"image_url"`
+	Category string             `json:"category,omitempty" bson:"category,omitempty"`
+	// Weight is per unit, in grams, and prices shipping
+	WeightGrams int `json:"weight_grams,omitempty" bson:"weight_grams,omitempty"`
+	Quantity    int `json:"quantity,omitempty" bson:"quantity,omitempty"`
 }
 
 type Address struct {
@@ -47,15 +103,73 @@ type Address struct {
 }
 
 type Order struct {
-	ID          primitive.ObjectID `json:"_id,omitempty" bson:"_id,omitempty"`
-	OrderCart   []ProductUser      `json:"order_cart" bson:"order_cart"`
-	OrderedAt   time.Time          `json:"ordered_at" bson:"ordered_at"`
-	Price       float64            `json:"price" bson:"price"`
-	Discount    float64            `json:"discount" bson:"discount"`
-	PaymentMode string             `json:"payment_mode" bson:"payment_mode"`
+	ID            primitive.ObjectID  `json:"_id,omitempty" bson:"_id,omitempty"`
+	UserID        string              `json:"user_id" bson:"user_id"`
+	OrderCart     []ProductUser       `json:"order_cart" bson:"order_cart"`
+	OrderedAt     time.Time           `json:"ordered_at" bson:"ordered_at"`
+	Price         Money               `json:"price" bson:"price"`
+	Discount      Money               `json:"discount" bson:"discount"`
+	Discounts     []AppliedDiscount   `json:"discounts,omitempty" bson:"discounts,omitempty"`
+	Unredeemed    bool                `json:"unredeemed,omitempty" bson:"unredeemed,omitempty"`
+	Tax           Money               `json:"tax" bson:"tax"`
+	Taxes         []TaxLine           `json:"taxes,omitempty" bson:"taxes,omitempty"`
+	Shipping      *ShippingOption     `json:"shipping,omitempty" bson:"shipping,omitempty"`
+	ExchangeRate  *ExchangeRate       `json:"exchange_rate,omitempty" bson:"exchange_rate,omitempty"`
+	PaymentMode   string              `json:"payment_mode" bson:"payment_mode"`
+	Address       Address             `json:"address" bson:"address"`
+	Reservation   StockReservation    `json:"reservation" bson:"reservation"`
+	Payment       Payment             `json:"payment" bson:"payment"`
+	Status        string              `json:"status" bson:"status"`
+	StatusHistory []OrderStatusChange `json:"status_history" bson:"status_history"`
+	Refunds       []Refund            `json:"refunds,omitempty" bson:"refunds,omitempty"`
+	Effects       []string            `json:"pending_effects,omitempty" bson:"pending_effects,omitempty"`
+}
+
+// Reservation states. Stock is taken when an order is placed and stays held until
+// payment is confirmed; a held reservation that expires puts the stock back.
+const (
+	ReservationHeld      = "held"
+	ReservationConfirmed = "confirmed"
+	ReservationReleased  = "released"
+)
+
+// ReservationTTL is how long digital payments have to be confirmed
+const ReservationTTL = 15 * time.Minute
+
+type StockReservation struct {
+	Status    string    `json:"status" bson:"status"`
+	ExpiresAt time.Time `json:"expires_at" bson:"expires_at"`
 }
 
+// Payment modes accepted at checkout
+const (
+	PaymentModeDigital = "digital"
+	PaymentModeCOD     = "cod"
+)
+
+// ValidPaymentMode reports whether mode is one of the accepted payment modes
+func ValidPaymentMode(mode string) bool {
+	return mode == PaymentModeDigital || mode == PaymentModeCOD
+}
+
+// Payment states as reported by the provider. A pending payment has been sent for
+// capture and is waiting for the gateway to confirm it.
+const (
+	PaymentAuthorized = "authorized"
+	PaymentPending    = "pending"
+	PaymentCaptured   = "captured"
+	PaymentVoided     = "voided"
+	PaymentFailed     = "failed"
+)
+
+// Payment is an order's payment as tracked by its provider. Refunds are recorded
+// on the order itself.
 type Payment struct {
-	Digital bool `json:"digital" bson:"digital"`
-	COD     bool `json:"cod" bson:"cod"`
+	Provider      string     `json:"provider" bson:"provider"`
+	Reference     string     `json:"reference" bson:"reference"`
+	Status        string     `json:"status" bson:"status"`
+	Amount        Money      `json:"amount" bson:"amount"`
+	AuthorizedAt  *time.Time `json:"authorized_at,omitempty" bson:"authorized_at,omitempty"`
+	CapturedAt    *time.Time `json:"captured_at,omitempty" bson:"captured_at,omitempty"`
+	FailureReason string     `json:"failure_reason,omitempty" bson:"failure_reason,omitempty"`
 }
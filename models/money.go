@@ -0,0 +1,357 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"os"
+	"strings"
+)
+
+var (
+	ErrCurrencyMismatch = errors.New("money amounts are in different currencies")
+	ErrMoneyOverflow    = errors.New("money amount overflows")
+)
+
+// DefaultCurrency is the store currency when STORE_CURRENCY is not set
+const DefaultCurrency = "INR"
+
+// MaxAmount bounds the amounts admins set and the subtotal of an order, in minor
+// units. It is far above any real price yet leaves room for totals, tax and shipping
+// to be added up without overflowing.
+const MaxAmount int64 = 10_000_000_000_000
+
+// BaseCurrency is the ISO 4217 code the catalog is priced and orders are charged in
+func BaseCurrency() string {
+	if c := NormalizeCurrency(os.Getenv("STORE_CURRENCY")); ValidCurrency(c) {
+		return c
+	}
+	return DefaultCurrency
+}
+
+// NormalizeCurrency upper-cases and trims a currency code
+func NormalizeCurrency(code string) string {
+	return strings.ToUpper(strings.TrimSpace(code))
+}
+
+// ValidCurrency reports whether code looks like an ISO 4217 code
+func ValidCurrency(code string) bool {
+	if len(code) != 3 {
+		return false
+	}
+	for _, r := range code {
+		if r < 'A' || r > 'Z' {
+			return false
+		}
+	}
+	return true
+}
+
+// currencyExponents lists the currencies whose minor unit isn't a hundredth
+var currencyExponents = map[string]int{
+	"BHD": 3, "CLP": 0, "IQD": 3, "ISK": 0, "JOD": 3, "JPY": 0, "KRW": 0,
+	"KWD": 3, "LYD": 3, "OMR": 3, "TND": 3, "UGX": 0, "VND": 0, "XAF": 0, "XOF": 0,
+}
+
+// CurrencyExponent is how many decimal places the currency's minor unit has
+func CurrencyExponent(code string) int {
+	if exp, ok := currencyExponents[code]; ok {
+		return exp
+	}
+	return 2
+}
+
+/*
+Money is an amount in a currency's minor units, e.g. paise for INR, so sums are
+exact. Arithmetic between different currencies panics with ErrCurrencyMismatch, as
+does overflowing int64. Amounts that come from requests or stored data go through
+the Checked methods first, which return those errors instead, so the panics are
+left to programming errors. The zero Money has no currency and takes on the currency
+of whatever it is combined with, so it can start a running total.
+*/
+type Money struct {
+	Amount   int64  `json:"amount" bson:"amount"`
+	Currency string `json:"currency" bson:"currency"`
+}
+
+// NewMoney returns amount minor units of currency
+func NewMoney(amount int64, currency string) Money {
+	return Money{Amount: amount, Currency: NormalizeCurrency(currency)}
+}
+
+// MoneyFromMajor converts an amount in whole currency units, like 12.34, rounding
+// to the nearest minor unit. It fails with ErrMoneyOverflow if that doesn't fit.
+func MoneyFromMajor(major float64, currency string) (Money, error) {
+	currency = NormalizeCurrency(currency)
+	scaled, err := scaleFloat(major, math.Pow10(CurrencyExponent(currency)))
+	if err != nil {
+		return Money{}, err
+	}
+	return Money{Amount: scaled, Currency: currency}, nil
+}
+
+// scaleFloat multiplies x by factor and rounds half away from zero, failing with
+// ErrMoneyOverflow if the result doesn't fit an int64
+func scaleFloat(x, factor float64) (int64, error) {
+	scaled := math.Round(x * factor)
+	// float64(math.MaxInt64) rounds up to 2^63, which no longer fits
+	if math.IsNaN(scaled) || scaled >= math.MaxInt64 || scaled < math.MinInt64 {
+		return 0, ErrMoneyOverflow
+	}
+	return int64(scaled), nil
+}
+
+// IsZero reports whether the amount is zero, whatever the currency
+func (m Money) IsZero() bool {
+	return m.Amount == 0
+}
+
+func (m Money) IsPositive() bool {
+	return m.Amount > 0
+}
+
+func (m Money) IsNegative() bool {
+	return m.Amount < 0
+}
+
+// sharedCurrency returns the currency m and o share, failing if they differ
+func (m Money) sharedCurrency(o Money) (string, error) {
+	switch {
+	case m.Currency == o.Currency:
+		return m.Currency, nil
+	case m.Currency == "" && m.Amount == 0:
+		return o.Currency, nil
+	case o.Currency == "" && o.Amount == 0:
+		return m.Currency, nil
+	}
+	return "", fmt.Errorf("%w: %s and %s", ErrCurrencyMismatch, m.Currency, o.Currency)
+}
+
+// currencyWith returns the currency m and o share, panicking if they differ
+func (m Money) currencyWith(o Money) string {
+	currency, err := m.sharedCurrency(o)
+	if err != nil {
+		panic(err)
+	}
+	return currency
+}
+
+// must unwraps the result of a Checked method, panicking on its error
+func must(m Money, err error) Money {
+	if err != nil {
+		panic(err)
+	}
+	return m
+}
+
+func (m Money) Add(o Money) Money {
+	return must(m.CheckedAdd(o))
+}
+
+// CheckedAdd is Add failing with ErrCurrencyMismatch or ErrMoneyOverflow rather
+// than panicking
+func (m Money) CheckedAdd(o Money) (Money, error) {
+	currency, err := m.sharedCurrency(o)
+	if err != nil {
+		return Money{}, err
+	}
+	sum := m.Amount + o.Amount
+	if (o.Amount > 0 && sum < m.Amount) || (o.Amount < 0 && sum > m.Amount) {
+		return Money{}, ErrMoneyOverflow
+	}
+	return Money{Amount: sum, Currency: currency}, nil
+}
+
+func (m Money) Sub(o Money) Money {
+	if o.Amount == math.MinInt64 {
+		panic(ErrMoneyOverflow)
+	}
+	return m.Add(Money{Amount: -o.Amount, Currency: o.Currency})
+}
+
+// Mul multiplies the amount by a whole number, such as a quantity
+func (m Money) Mul(n int64) Money {
+	return m.MulRatio(n, 1)
+}
+
+// CheckedMul is Mul failing with ErrMoneyOverflow rather than panicking
+func (m Money) CheckedMul(n int64) (Money, error) {
+	return m.CheckedMulRatio(n, 1)
+}
+
+// MulRatio scales the amount by num/den, rounding half away from zero. It is how a
+// share of an amount is taken, e.g. the part of a line's discount for some of its units.
+func (m Money) MulRatio(num, den int64) Money {
+	if den == 0 {
+		panic("models: Money.MulRatio with zero denominator")
+	}
+	return must(m.CheckedMulRatio(num, den))
+}
+
+// CheckedMulRatio is MulRatio failing with ErrMoneyOverflow rather than panicking
+func (m Money) CheckedMulRatio(num, den int64) (Money, error) {
+	if den == 0 {
+		return Money{}, ErrMoneyOverflow
+	}
+	product := new(big.Int).Mul(big.NewInt(m.Amount), big.NewInt(num))
+	amount, err := roundQuo(product, big.NewInt(den))
+	if err != nil {
+		return Money{}, err
+	}
+	return Money{Amount: amount, Currency: m.Currency}, nil
+}
+
+// Scale multiplies the amount by a rate such as 0.18, rounding half away from zero
+func (m Money) Scale(rate float64) Money {
+	scaled, err := scaleFloat(float64(m.Amount), rate)
+	if err != nil {
+		panic(err)
+	}
+	return Money{Amount: scaled, Currency: m.Currency}
+}
+
+// Percent returns rate percent of the amount
+func (m Money) Percent(rate float64) Money {
+	return m.Scale(rate / 100)
+}
+
+/*
+Allocate splits the amount in proportion to weights so the parts add up to exactly
+the amount. Minor units left over from rounding down go one each to the parts with
+the largest remainders, earlier parts first on ties. Zero total weight gives all
+zero parts.
+*/
+func (m Money) Allocate(weights []int64) []Money {
+	parts := make([]Money, len(weights))
+	var total int64
+	for i, w := range weights {
+		if w < 0 {
+			panic("models: Money.Allocate with a negative weight")
+		}
+		total += w
+		parts[i] = Money{Currency: m.Currency}
+	}
+	if total == 0 {
+		return parts
+	}
+
+	sign := int64(1)
+	amount := m.Amount
+	if amount < 0 {
+		sign, amount = -1, -amount
+	}
+
+	remainders := make([]int64, len(weights))
+	allocated := int64(0)
+	for i, w := range weights {
+		quo, rem := new(big.Int).QuoRem(
+			new(big.Int).Mul(big.NewInt(amount), big.NewInt(w)),
+			big.NewInt(total),
+			new(big.Int),
+		)
+		parts[i].Amount = quo.Int64()
+		remainders[i] = rem.Int64()
+		allocated += parts[i].Amount
+	}
+
+	for left := amount - allocated; left > 0; left-- {
+		best := -1
+		for i, r := range remainders {
+			if weights[i] > 0 && (best < 0 || r > remainders[best]) {
+				best = i
+			}
+		}
+		parts[best].Amount++
+		remainders[best] = -1
+	}
+
+	for i := range parts {
+		parts[i].Amount *= sign
+	}
+	return parts
+}
+
+// Cmp returns -1, 0 or +1 as m is less than, equal to or greater than o
+func (m Money) Cmp(o Money) int {
+	m.currencyWith(o)
+	switch {
+	case m.Amount < o.Amount:
+		return -1
+	case m.Amount > o.Amount:
+		return 1
+	}
+	return 0
+}
+
+// Min returns the smaller of m and o
+func (m Money) Min(o Money) Money {
+	if m.Cmp(o) <= 0 {
+		return Money{Amount: m.Amount, Currency: m.currencyWith(o)}
+	}
+	return Money{Amount: o.Amount, Currency: m.currencyWith(o)}
+}
+
+// Max returns the larger of m and o
+func (m Money) Max(o Money) Money {
+	if m.Cmp(o) >= 0 {
+		return Money{Amount: m.Amount, Currency: m.currencyWith(o)}
+	}
+	return Money{Amount: o.Amount, Currency: m.currencyWith(o)}
+}
+
+// Major is the amount in whole currency units. It is for display only; never
+// compute with it.
+func (m Money) Major() float64 {
+	return float64(m.Amount) / math.Pow10(CurrencyExponent(m.Currency))
+}
+
+// String formats the amount like "INR 1234.50"
+func (m Money) String() string {
+	exp := CurrencyExponent(m.Currency)
+	amount := new(big.Int).Abs(big.NewInt(m.Amount))
+	sign := ""
+	if m.Amount < 0 {
+		sign = "-"
+	}
+	if exp == 0 {
+		return fmt.Sprintf("%s %s%s", m.Currency, sign, amount)
+	}
+	unit := new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(exp)), nil)
+	whole, frac := new(big.Int).QuoRem(amount, unit, new(big.Int))
+	return fmt.Sprintf("%s %s%s.%0*d", m.Currency, sign, whole, exp, frac.Int64())
+}
+
+// roundQuo divides a by b, rounding half away from zero
+func roundQuo(a, b *big.Int) (int64, error) {
+	quo, rem := new(big.Int).QuoRem(a, b, new(big.Int))
+	// |2*rem| >= |b| means the remainder is at least half way
+	if new(big.Int).Abs(new(big.Int).Lsh(rem, 1)).Cmp(new(big.Int).Abs(b)) >= 0 {
+		if (a.Sign() < 0) != (b.Sign() < 0) {
+			quo.Sub(quo, big.NewInt(1))
+		} else {
+			quo.Add(quo, big.NewInt(1))
+		}
+	}
+	if !quo.IsInt64() {
+		return 0, ErrMoneyOverflow
+	}
+	return quo.Int64(), nil
+}
+
+// Convert changes the amount into currency at rate, the number of whole units of
+// currency one whole unit of m is worth, rounding to the nearest minor unit
+func (m Money) Convert(currency string, rate float64) Money {
+	return must(m.CheckedConvert(currency, rate))
+}
+
+// CheckedConvert is Convert failing with ErrMoneyOverflow rather than panicking
+func (m Money) CheckedConvert(currency string, rate float64) (Money, error) {
+	currency = NormalizeCurrency(currency)
+	shift := CurrencyExponent(currency) - CurrencyExponent(m.Currency)
+	amount, err := scaleFloat(float64(m.Amount), rate*math.Pow10(shift))
+	if err != nil {
+		return Money{}, err
+	}
+	return Money{Amount: amount, Currency: currency}, nil
+}
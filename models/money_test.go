@@ -0,0 +1,84 @@
+package models
+
+import (
+	"errors"
+	"math"
+	"testing"
+)
+
+func TestMoneyChecked(t *testing.T) {
+	inr := func(amount int64) Money { return NewMoney(amount, "INR") }
+
+	tests := []struct {
+		name    string
+		op      func() (Money, error)
+		want    Money
+		wantErr error
+	}{
+		{name: "add", op: func() (Money, error) { return inr(150).CheckedAdd(inr(250)) }, want: inr(400)},
+		{name: "add to an unset amount", op: func() (Money, error) { return Money{}.CheckedAdd(inr(250)) }, want: inr(250)},
+		{name: "add across currencies", op: func() (Money, error) { return inr(150).CheckedAdd(NewMoney(1, "USD")) }, wantErr: ErrCurrencyMismatch},
+		{name: "add past the top", op: func() (Money, error) { return inr(math.MaxInt64).CheckedAdd(inr(1)) }, wantErr: ErrMoneyOverflow},
+		{name: "add past the bottom", op: func() (Money, error) { return inr(math.MinInt64).CheckedAdd(inr(-1)) }, wantErr: ErrMoneyOverflow},
+		{name: "multiply", op: func() (Money, error) { return inr(499).CheckedMul(3) }, want: inr(1497)},
+		{name: "multiply past the top", op: func() (Money, error) { return inr(math.MaxInt64 / 2).CheckedMul(3) }, wantErr: ErrMoneyOverflow},
+		{name: "ratio rounds half away from zero", op: func() (Money, error) { return inr(5).CheckedMulRatio(1, 2) }, want: inr(3)},
+		{name: "negative ratio rounds half away from zero", op: func() (Money, error) { return inr(-5).CheckedMulRatio(1, 2) }, want: inr(-3)},
+		{name: "ratio with a large product", op: func() (Money, error) { return inr(math.MaxInt64).CheckedMulRatio(3, 3) }, want: inr(math.MaxInt64)},
+		{name: "zero denominator", op: func() (Money, error) { return inr(5).CheckedMulRatio(1, 0) }, wantErr: ErrMoneyOverflow},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.op()
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("err = %v, want %v", err, tt.wantErr)
+			}
+			if err == nil && got != tt.want {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMoneyFromMajor(t *testing.T) {
+	tests := []struct {
+		name     string
+		major    float64
+		currency string
+		want     Money
+		wantErr  error
+	}{
+		{name: "two decimals", major: 12.34, currency: "inr", want: NewMoney(1234, "INR")},
+		{name: "rounds to the minor unit", major: 0.125, currency: "USD", want: NewMoney(13, "USD")},
+		{name: "no minor unit", major: 1500, currency: "JPY", want: NewMoney(1500, "JPY")},
+		{name: "too large", major: 1e300, currency: "INR", wantErr: ErrMoneyOverflow},
+		{name: "not a number", major: math.NaN(), currency: "INR", wantErr: ErrMoneyOverflow},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := MoneyFromMajor(tt.major, tt.currency)
+			if err != tt.wantErr {
+				t.Fatalf("err = %v, want %v", err, tt.wantErr)
+			}
+			if err == nil && got != tt.want {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMoneyAllocate(t *testing.T) {
+	parts := NewMoney(100, "INR").Allocate([]int64{1, 1, 1})
+	total := NewMoney(0, "INR")
+	for _, p := range parts {
+		total = total.Add(p)
+	}
+	if total.Amount != 100 {
+		t.Errorf("parts add up to %d, want 100", total.Amount)
+	}
+	if parts[0].Amount != 34 || parts[1].Amount != 33 || parts[2].Amount != 33 {
+		t.Errorf("parts = %v, want the leftover unit on the first", parts)
+	}
+}
@@ -0,0 +1,80 @@
+package models
+
+import "time"
+
+// Order lifecycle states. The partial states are for orders split across several
+// shipments, some of which are on their way or delivered while others are not.
+const (
+	OrderPendingPayment     = "pending_payment"
+	OrderPaymentFailed      = "payment_failed"
+	OrderPaid               = "paid"
+	OrderPacked             = "packed"
+	OrderPartiallyShipped   = "partially_shipped"
+	OrderShipped            = "shipped"
+	OrderPartiallyDelivered = "partially_delivered"
+	OrderDelivered          = "delivered"
+	OrderCancelled          = "cancelled"
+	OrderRefunded           = "refunded"
+)
+
+// orderTransitions lists the states each state may move to. An order on its way can
+// still be cancelled, e.g. when its parcels come back undelivered, or refunded in full.
+var orderTransitions = map[string][]string{
+	OrderPendingPayment:     {OrderPaid, OrderPaymentFailed, OrderCancelled},
+	OrderPaid:               {OrderPacked, OrderCancelled, OrderRefunded},
+	OrderPacked:             {OrderShipped, OrderPartiallyShipped, OrderCancelled},
+	OrderPartiallyShipped:   {OrderShipped, OrderPartiallyDelivered, OrderDelivered, OrderCancelled, OrderRefunded},
+	OrderShipped:            {OrderPartiallyDelivered, OrderDelivered, OrderCancelled, OrderRefunded},
+	OrderPartiallyDelivered: {OrderDelivered, OrderRefunded},
+	OrderDelivered:          {OrderRefunded},
+}
+
+// Dispatched reports whether an order in status has had goods leave the warehouse
+func Dispatched(status string) bool {
+	switch status {
+	case OrderPartiallyShipped, OrderShipped, OrderPartiallyDelivered, OrderDelivered:
+		return true
+	}
+	return false
+}
+
+// Side effects of a status change. They are saved in the order's Effects along with
+// the change and cleared one by one once carried out, so any that fail can be retried.
+// Returning coupons sets the order's Unredeemed so a retry can't give a use back twice.
+const (
+	EffectConfirmReservation = "confirm_reservation"
+	EffectReleaseReservation = "release_reservation"
+	EffectReturnCoupons      = "return_coupons"
+	EffectVoidPayment        = "void_payment"
+	EffectRefundRemaining    = "refund_remaining"
+)
+
+// OrderStatusChange is one entry in an order's status history
+type OrderStatusChange struct {
+	Status string    `json:"status" bson:"status"`
+	At     time.Time `json:"at" bson:"at"`
+	By     string    `json:"by" bson:"by"`
+	Note   string    `json:"note,omitempty" bson:"note,omitempty"`
+}
+
+// ValidOrderStatus reports whether status is a known order state
+func ValidOrderStatus(status string) bool {
+	if _, ok := orderTransitions[status]; ok {
+		return true
+	}
+	return status == OrderPaymentFailed || status == OrderCancelled || status == OrderRefunded
+}
+
+// CanTransition reports whether the order may move from its current status to next.
+// Cash on delivery orders are packed without waiting for payment.
+func (o *Order) CanTransition(next string) bool {
+	if o.Status == OrderPendingPayment && next == OrderPacked {
+		return o.PaymentMode == PaymentModeCOD
+	}
+	for _, allowed := range orderTransitions[o.Status] {
+		if allowed == next {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,91 @@
+package models
+
+import (
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestCanTransition(t *testing.T) {
+	tests := []struct {
+		name        string
+		from        string
+		paymentMode string
+		to          string
+		want        bool
+	}{
+		{name: "card payment confirmed", from: OrderPendingPayment, paymentMode: PaymentModeDigital, to: OrderPaid, want: true},
+		{name: "card order packed unpaid", from: OrderPendingPayment, paymentMode: PaymentModeDigital, to: OrderPacked, want: false},
+		{name: "cash order packed unpaid", from: OrderPendingPayment, paymentMode: PaymentModeCOD, to: OrderPacked, want: true},
+		{name: "paid order packed", from: OrderPaid, to: OrderPacked, want: true},
+		{name: "paid order shipped unpacked", from: OrderPaid, to: OrderShipped, want: false},
+		{name: "packed order split", from: OrderPacked, to: OrderPartiallyShipped, want: true},
+		{name: "shipped order delivered", from: OrderShipped, to: OrderDelivered, want: true},
+		{name: "shipped order cancelled", from: OrderShipped, to: OrderCancelled, want: true},
+		{name: "partly delivered order cancelled", from: OrderPartiallyDelivered, to: OrderCancelled, want: false},
+		{name: "delivered order refunded", from: OrderDelivered, to: OrderRefunded, want: true},
+		{name: "delivered order back in transit", from: OrderDelivered, to: OrderShipped, want: false},
+		{name: "cancelled order paid", from: OrderCancelled, to: OrderPaid, want: false},
+		{name: "refunded order refunded again", from: OrderRefunded, to: OrderRefunded, want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			order := &Order{Status: tt.from, PaymentMode: tt.paymentMode}
+			if got := order.CanTransition(tt.to); got != tt.want {
+				t.Errorf("CanTransition(%s -> %s) = %v, want %v", tt.from, tt.to, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFulfillmentStatus(t *testing.T) {
+	a, b := primitive.NewObjectID(), primitive.NewObjectID()
+	shipment := func(status string, lines ...ShipmentLine) Shipment {
+		return Shipment{Status: status, Lines: lines}
+	}
+
+	tests := []struct {
+		name      string
+		refunded  int
+		shipments []Shipment
+		want      string
+	}{
+		{name: "nothing shipped", want: OrderPacked},
+		{name: "some units on their way", shipments: []Shipment{shipment(ShipmentInTransit, ShipmentLine{a, 1})}, want: OrderPartiallyShipped},
+		{name: "every unit on its way", shipments: []Shipment{shipment(ShipmentShipped, ShipmentLine{a, 2}, ShipmentLine{b, 1})}, want: OrderShipped},
+		{name: "the rest refunded", refunded: 1, shipments: []Shipment{shipment(ShipmentShipped, ShipmentLine{a, 2})}, want: OrderShipped},
+		{
+			name: "one parcel delivered",
+			shipments: []Shipment{
+				shipment(ShipmentDelivered, ShipmentLine{a, 2}),
+				shipment(ShipmentInTransit, ShipmentLine{b, 1}),
+			},
+			want: OrderPartiallyDelivered,
+		},
+		{
+			name: "every parcel delivered",
+			shipments: []Shipment{
+				shipment(ShipmentDelivered, ShipmentLine{a, 2}),
+				shipment(ShipmentDelivered, ShipmentLine{b, 1}),
+			},
+			want: OrderDelivered,
+		},
+		{name: "shipment recorded before orders could be split", shipments: []Shipment{shipment(ShipmentDelivered)}, want: OrderDelivered},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			order := &Order{
+				Status:    OrderPacked,
+				OrderCart: []ProductUser{{ID: a, Quantity: 2}, {ID: b, Quantity: 1}},
+			}
+			if tt.refunded > 0 {
+				order.Refunds = []Refund{{Lines: []RefundLine{{ProductID: b, Quantity: tt.refunded}}}}
+			}
+			if got := order.FulfillmentStatus(tt.shipments); got != tt.want {
+				t.Errorf("FulfillmentStatus = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,160 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Refund states. A refund is recorded as pending before the provider is asked to pay
+// it out and completed once it has, so a failure in between can be retried. Refunds
+// recorded before this have no status and were paid out.
+const (
+	RefundPending   = "pending"
+	RefundCompleted = "completed"
+)
+
+// Refund records money given back to the customer for some or all of an order.
+// Reference is the payment provider's ID for the refund. Amount is in the store
+// currency and Charged is what was paid back in the currency the order was paid in.
+// Shipping is the part of Amount that gives back the shipping charge.
+type Refund struct {
+	ID        primitive.ObjectID `json:"_id" bson:"_id"`
+	Status    string             `json:"status,omitempty" bson:"status,omitempty"`
+	Amount    Money              `json:"amount" bson:"amount"`
+	Charged   Money              `json:"charged" bson:"charged,omitempty"`
+	Lines     []RefundLine       `json:"lines" bson:"lines"`
+	Shipping  Money              `json:"shipping" bson:"shipping,omitempty"`
+	Reference string             `json:"reference,omitempty" bson:"reference,omitempty"`
+	Reason    string             `json:"reason,omitempty" bson:"reason,omitempty"`
+	By        string             `json:"by" bson:"by"`
+	At        time.Time          `json:"at" bson:"at"`
+}
+
+// PendingRefunds lists the refunds recorded but not paid out yet
+func (o *Order) PendingRefunds() []Refund {
+	var pending []Refund
+	for _, r := range o.Refunds {
+		if r.Status == RefundPending {
+			pending = append(pending, r)
+		}
+	}
+	return pending
+}
+
+// RefundLine is the part of a refund covering one product of the order. Restocked
+// lines had their quantity put back into the catalog when the refund was made.
+type RefundLine struct {
+	ProductID primitive.ObjectID `json:"product_id" bson:"product_id"`
+	Quantity  int                `json:"quantity" bson:"quantity"`
+	Amount    Money              `json:"amount" bson:"amount"`
+	Restocked bool               `json:"restocked" bson:"restocked"`
+}
+
+// PaymentCollected reports whether the customer has paid for the order at some point
+func (o *Order) PaymentCollected() bool {
+	if o.Payment.Status == PaymentCaptured {
+		return true
+	}
+	for _, change := range o.StatusHistory {
+		if change.Status == OrderPaid || change.Status == OrderDelivered {
+			return true
+		}
+	}
+	return false
+}
+
+// RefundedAmount totals every refund made against the order, counting pending ones
+// so nothing is refunded twice
+func (o *Order) RefundedAmount() Money {
+	total := Money{Currency: o.Price.Currency}
+	for _, r := range o.Refunds {
+		total = total.Add(r.Amount)
+	}
+	return total
+}
+
+// RefundedShipping totals the shipping charge given back so far
+func (o *Order) RefundedShipping() Money {
+	total := Money{Currency: o.Price.Currency}
+	for _, r := range o.Refunds {
+		total = total.Add(r.Shipping)
+	}
+	return total
+}
+
+// Refundable is what is left of the amount charged after earlier refunds
+func (o *Order) Refundable() Money {
+	return o.Payable().Sub(o.RefundedAmount()).Max(Money{})
+}
+
+// LineRefund is what the next quantity units of a line to be refunded cost the
+// customer: their list price less their share of any coupon discount on the line,
+// plus their share of tax added on top of it. Shares are taken cumulatively so
+// refunding a line bit by bit adds up to exactly what refunding it at once would.
+func (o *Order) LineRefund(line ProductUser, quantity int) Money {
+	amount := line.Price.Mul(int64(quantity))
+	if line.Quantity <= 0 {
+		return amount
+	}
+
+	done := int64(o.RefundedQuantity(line.ID))
+	upTo := done + int64(quantity)
+	share := func(total Money) Money {
+		return total.MulRatio(upTo, int64(line.Quantity)).Sub(total.MulRatio(done, int64(line.Quantity)))
+	}
+
+	for _, d := range o.Discounts {
+		for _, dl := range d.Lines {
+			if dl.ProductID == line.ID {
+				amount = amount.Sub(share(dl.Amount))
+			}
+		}
+	}
+	for _, t := range o.Taxes {
+		if t.ProductID == line.ID && !t.Inclusive {
+			amount = amount.Add(share(t.Amount))
+		}
+	}
+	return amount.Max(Money{})
+}
+
+// RefundedQuantity counts the units of a product already refunded
+func (o *Order) RefundedQuantity(productID primitive.ObjectID) int {
+	return o.refundedQuantity(productID, false)
+}
+
+func (o *Order) refundedQuantity(productID primitive.ObjectID, restockedOnly bool) int {
+	quantity := 0
+	for _, r := range o.Refunds {
+		for _, line := range r.Lines {
+			if line.ProductID == productID && (line.Restocked || !restockedOnly) {
+				quantity += line.Quantity
+			}
+		}
+	}
+	return quantity
+}
+
+// HeldLines returns the order's lines less any quantity already put back into
+// stock by a refund, i.e. what releasing the reservation has to return
+func (o *Order) HeldLines() []ProductUser {
+	lines := make([]ProductUser, 0, len(o.OrderCart))
+	for _, line := range o.OrderCart {
+		line.Quantity -= o.refundedQuantity(line.ID, true)
+		if line.Quantity > 0 {
+			lines = append(lines, line)
+		}
+	}
+	return lines
+}
+
+// FullyRefunded reports whether every unit of the order has been refunded
+func (o *Order) FullyRefunded() bool {
+	for _, line := range o.OrderCart {
+		if o.RefundedQuantity(line.ID) < line.Quantity {
+			return false
+		}
+	}
+	return true
+}
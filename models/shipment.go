@@ -0,0 +1,188 @@
+package models
+
+import (
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Shipment states, as reported by tracking events
+const (
+	ShipmentShipped        = "shipped"
+	ShipmentInTransit      = "in_transit"
+	ShipmentOutForDelivery = "out_for_delivery"
+	ShipmentFailedAttempt  = "failed_attempt"
+	ShipmentDelivered      = "delivered"
+	ShipmentReturned       = "returned"
+)
+
+// ValidShipmentStatus reports whether status is a known shipment state
+func ValidShipmentStatus(status string) bool {
+	switch status {
+	case ShipmentShipped, ShipmentInTransit, ShipmentOutForDelivery,
+		ShipmentFailedAttempt, ShipmentDelivered, ShipmentReturned:
+		return true
+	}
+	return false
+}
+
+// NormalizeCarrier lower-cases and trims a carrier name so lookups by it match
+func NormalizeCarrier(carrier string) string {
+	return strings.ToLower(strings.TrimSpace(carrier))
+}
+
+/*
+Shipment is a parcel of an order handed to a carrier, holding some or all of the
+order's units. A tracking number is unique per carrier. Sequence numbers an order's
+shipments from 1, and is unique per order so two shipments can't be made from the
+same view of what is left to ship. Status follows the most recent of its tracking
+events, which come from admins and from the carrier's webhook.
+*/
+type Shipment struct {
+	ID             primitive.ObjectID `json:"_id" bson:"_id"`
+	OrderID        primitive.ObjectID `json:"order_id" bson:"order_id"`
+	Carrier        string             `json:"carrier" bson:"carrier"`
+	TrackingNumber string             `json:"tracking_number" bson:"tracking_number"`
+	Sequence       int                `json:"sequence" bson:"sequence"`
+	Lines          []ShipmentLine     `json:"lines" bson:"lines,omitempty"`
+	Status         string             `json:"status" bson:"status"`
+	Events         []TrackingEvent    `json:"events" bson:"events"`
+	CreatedAt      time.Time          `json:"created_at" bson:"created_at"`
+	CreatedBy      string             `json:"created_by" bson:"created_by"`
+}
+
+// ShipmentLine is how many units of one order line a shipment holds
+type ShipmentLine struct {
+	ProductID primitive.ObjectID `json:"product_id" bson:"product_id"`
+	Quantity  int                `json:"quantity" bson:"quantity"`
+}
+
+// TrackingEvent is one scan or status update on a shipment. ExternalID is the
+// carrier's ID for the event, so a redelivered webhook isn't recorded twice.
+type TrackingEvent struct {
+	ExternalID  string    `json:"external_id,omitempty" bson:"external_id,omitempty"`
+	Status      string    `json:"status" bson:"status"`
+	Description string    `json:"description,omitempty" bson:"description,omitempty"`
+	Location    string    `json:"location,omitempty" bson:"location,omitempty"`
+	At          time.Time `json:"at" bson:"at"`
+	By          string    `json:"by" bson:"by"`
+}
+
+// HasEvent reports whether the carrier event externalID is already recorded
+func (s *Shipment) HasEvent(externalID string) bool {
+	if externalID == "" {
+		return false
+	}
+	for _, e := range s.Events {
+		if e.ExternalID == externalID {
+			return true
+		}
+	}
+	return false
+}
+
+// CurrentStatus is the status of the latest tracking event; carriers may report
+// events out of order, so the event time decides rather than when it arrived
+func (s *Shipment) CurrentStatus() string {
+	status := s.Status
+	var latest time.Time
+	for _, e := range s.Events {
+		if !e.At.Before(latest) {
+			status, latest = e.Status, e.At
+		}
+	}
+	return status
+}
+
+// Quantity counts the units of a product in the shipment. Shipments recorded before
+// orders could be split have no lines and hold the whole of order.
+func (s *Shipment) Quantity(order *Order, productID primitive.ObjectID) int {
+	if len(s.Lines) == 0 {
+		if line, ok := order.Line(productID); ok {
+			return line.Quantity
+		}
+		return 0
+	}
+	quantity := 0
+	for _, line := range s.Lines {
+		if line.ProductID == productID {
+			quantity += line.Quantity
+		}
+	}
+	return quantity
+}
+
+// Line finds the order line for a product
+func (o *Order) Line(productID primitive.ObjectID) (ProductUser, bool) {
+	for _, line := range o.OrderCart {
+		if line.ID == productID {
+			return line, true
+		}
+	}
+	return ProductUser{}, false
+}
+
+// ShippedQuantity counts the units of a product sent out in shipments, or with
+// deliveredOnly just those in delivered shipments
+func (o *Order) ShippedQuantity(productID primitive.ObjectID, shipments []Shipment, deliveredOnly bool) int {
+	quantity := 0
+	for i := range shipments {
+		if !deliveredOnly || shipments[i].Status == ShipmentDelivered {
+			quantity += shipments[i].Quantity(o, productID)
+		}
+	}
+	return quantity
+}
+
+// toShip is how many units of a line have to go out: those ordered less any refunded,
+// which are taken to be units that couldn't be sent
+func (o *Order) toShip(line ProductUser) int {
+	return max(line.Quantity-o.RefundedQuantity(line.ID), 0)
+}
+
+// UnshippedQuantity is how many units of a line are still waiting for a shipment
+func (o *Order) UnshippedQuantity(line ProductUser, shipments []Shipment) int {
+	return max(o.toShip(line)-o.ShippedQuantity(line.ID, shipments, false), 0)
+}
+
+// UnshippedLines lists the units of each line still waiting for a shipment
+func (o *Order) UnshippedLines(shipments []Shipment) []ShipmentLine {
+	lines := []ShipmentLine{}
+	for _, line := range o.OrderCart {
+		if quantity := o.UnshippedQuantity(line, shipments); quantity > 0 {
+			lines = append(lines, ShipmentLine{ProductID: line.ID, Quantity: quantity})
+		}
+	}
+	return lines
+}
+
+/*
+FulfillmentStatus is the status the order's shipments add up to: delivered once every
+unit to be sent has been delivered, partially_delivered once some have, and otherwise
+shipped or partially_shipped by how many units are on their way. An order without
+shipments keeps its status.
+*/
+func (o *Order) FulfillmentStatus(shipments []Shipment) string {
+	toShip, shipped, delivered := 0, 0, 0
+	for _, line := range o.OrderCart {
+		units := o.toShip(line)
+		toShip += units
+		shipped += min(o.ShippedQuantity(line.ID, shipments, false), units)
+		delivered += min(o.ShippedQuantity(line.ID, shipments, true), units)
+	}
+
+	switch {
+	case len(shipments) == 0 || toShip == 0:
+		return o.Status
+	case delivered == toShip:
+		return OrderDelivered
+	case delivered > 0:
+		return OrderPartiallyDelivered
+	case shipped == toShip:
+		return OrderShipped
+	case shipped > 0:
+		return OrderPartiallyShipped
+	}
+	return o.Status
+}
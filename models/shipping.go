@@ -0,0 +1,130 @@
+package models
+
+import (
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Shipping methods offered at checkout, in the order they are quoted
+const (
+	ShippingStandard = "standard"
+	ShippingExpress  = "express"
+	ShippingPickup   = "pickup"
+)
+
+// ShippingMethods lists every shipping method
+var ShippingMethods = []string{ShippingStandard, ShippingExpress, ShippingPickup}
+
+// ValidShippingMethod reports whether method is one of the shipping methods
+func ValidShippingMethod(method string) bool {
+	for _, m := range ShippingMethods {
+		if m == method {
+			return true
+		}
+	}
+	return false
+}
+
+/*
+ShippingRate is one row of the shipping table, pricing a method for a zone. The zone
+is a list of pincode prefixes; a rate without any serves every address. A parcel
+matches when its weight falls in [MinWeightGrams, MaxWeightGrams] and the cart value
+reaches MinCartValue, a zero maximum meaning no limit. It costs Cost plus PerKg for
+every started kilogram, and nothing once the cart value reaches a non-zero FreeAbove.
+*/
+type ShippingRate struct {
+	ID             primitive.ObjectID `json:"_id" bson:"_id"`
+	Method         string             `json:"method" bson:"method"`
+	Name           string             `json:"name" bson:"name"`
+	Pincodes       []string           `json:"pincodes,omitempty" bson:"pincodes,omitempty"`
+	MinWeightGrams int                `json:"min_weight_grams" bson:"min_weight_grams"`
+	MaxWeightGrams int                `json:"max_weight_grams" bson:"max_weight_grams"`
+	MinCartValue   Money              `json:"min_cart_value" bson:"min_cart_value"`
+	Cost           Money              `json:"cost" bson:"cost"`
+	PerKg          Money              `json:"per_kg" bson:"per_kg"`
+	FreeAbove      Money              `json:"free_above" bson:"free_above"`
+	EstimatedDays  int                `json:"estimated_days" bson:"estimated_days"`
+	Active         bool               `json:"active" bson:"active"`
+	CreatedAt      time.Time          `json:"created_at" bson:"created_at"`
+	CreatedBy      string             `json:"created_by" bson:"created_by"`
+	UpdatedAt      time.Time          `json:"updated_at,omitempty" bson:"updated_at,omitempty"`
+	UpdatedBy      string             `json:"updated_by,omitempty" bson:"updated_by,omitempty"`
+}
+
+// ZoneMatch is the length of the longest of the rate's pincode prefixes that
+// pincode starts with, 0 for a rate serving everywhere, or -1 if the pincode is
+// outside its zone
+func (r *ShippingRate) ZoneMatch(pincode string) int {
+	if len(r.Pincodes) == 0 {
+		return 0
+	}
+	pincode = strings.TrimSpace(pincode)
+	best := -1
+	for _, prefix := range r.Pincodes {
+		if prefix != "" && strings.HasPrefix(pincode, prefix) && len(prefix) > best {
+			best = len(prefix)
+		}
+	}
+	return best
+}
+
+// Quote prices a parcel of weightGrams for a cart worth value, or reports false if
+// the parcel is outside the rate's weight or cart value limits. A rate set in another
+// currency, from before the store currency changed, or whose price would run past
+// MaxAmount doesn't apply either.
+func (r *ShippingRate) Quote(weightGrams int, value Money) (Money, bool) {
+	if weightGrams < r.MinWeightGrams || (r.MaxWeightGrams > 0 && weightGrams > r.MaxWeightGrams) {
+		return Money{}, false
+	}
+	for _, m := range []Money{r.MinCartValue, r.Cost, r.PerKg, r.FreeAbove} {
+		if _, err := m.sharedCurrency(value); err != nil {
+			return Money{}, false
+		}
+	}
+	if value.Cmp(r.MinCartValue) < 0 {
+		return Money{}, false
+	}
+	if r.FreeAbove.IsPositive() && value.Cmp(r.FreeAbove) >= 0 {
+		return NewMoney(0, r.Cost.Currency), true
+	}
+	kilograms := int64((weightGrams + 999) / 1000)
+	perKg, err := r.PerKg.CheckedMul(kilograms)
+	if err != nil {
+		return Money{}, false
+	}
+	cost, err := r.Cost.CheckedAdd(perKg)
+	if err != nil || cost.Amount > MaxAmount {
+		return Money{}, false
+	}
+	return cost, true
+}
+
+// ShippingOption is a priced shipping method for a cart or order. RateID is the
+// shipping rate it was priced by.
+type ShippingOption struct {
+	Method        string             `json:"method" bson:"method"`
+	Name          string             `json:"name" bson:"name"`
+	RateID        primitive.ObjectID `json:"rate_id" bson:"rate_id"`
+	Cost          Money              `json:"cost" bson:"cost"`
+	EstimatedDays int                `json:"estimated_days" bson:"estimated_days"`
+	WeightGrams   int                `json:"weight_grams" bson:"weight_grams"`
+}
+
+// ShippingCost is what the order charges for shipping
+func (o *Order) ShippingCost() Money {
+	if o.Shipping == nil {
+		return Money{}
+	}
+	return o.Shipping.Cost
+}
+
+// CartWeight totals the weight of the lines in grams
+func CartWeight(lines []ProductUser) int {
+	grams := 0
+	for _, line := range lines {
+		grams += line.WeightGrams * line.Quantity
+	}
+	return grams
+}
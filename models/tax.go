@@ -0,0 +1,84 @@
+package models
+
+import (
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+/*
+TaxRule is one row of the tax table. A rule matches shipping addresses by pincode,
+else by city, and a rule with neither applies everywhere. Category limits it to
+products of that category. Rate is a percentage; Inclusive rates are already part
+of the catalog price, exclusive ones are added on top of it.
+*/
+type TaxRule struct {
+	ID        primitive.ObjectID `json:"_id" bson:"_id"`
+	Name      string             `json:"name" bson:"name"`
+	City      string             `json:"city,omitempty" bson:"city,omitempty"`
+	Pincode   string             `json:"pincode,omitempty" bson:"pincode,omitempty"`
+	Category  string             `json:"category,omitempty" bson:"category,omitempty"`
+	Rate      float64            `json:"rate" bson:"rate"`
+	Inclusive bool               `json:"inclusive" bson:"inclusive"`
+	Active    bool               `json:"active" bson:"active"`
+	CreatedAt time.Time          `json:"created_at" bson:"created_at"`
+	CreatedBy string             `json:"created_by" bson:"created_by"`
+	UpdatedAt time.Time          `json:"updated_at,omitempty" bson:"updated_at,omitempty"`
+	UpdatedBy string             `json:"updated_by,omitempty" bson:"updated_by,omitempty"`
+}
+
+// Specificity ranks how closely the rule matches address and category, or returns
+// -1 if it doesn't match at all. Pincode beats city beats everywhere, and a
+// category rule beats a catch-all one for the same place.
+func (r *TaxRule) Specificity(address Address, category string) int {
+	score := 0
+	switch {
+	case r.Pincode != "":
+		if r.Pincode != strings.TrimSpace(address.Pincode) {
+			return -1
+		}
+		score = 4
+	case r.City != "":
+		if !strings.EqualFold(r.City, strings.TrimSpace(address.City)) {
+			return -1
+		}
+		score = 2
+	}
+	if r.Category != "" {
+		if !strings.EqualFold(r.Category, category) {
+			return -1
+		}
+		score++
+	}
+	return score
+}
+
+// TaxLine is the tax charged on one product line. Taxable is the line's price
+// after discounts; for inclusive rates Amount is already part of it.
+type TaxLine struct {
+	ProductID primitive.ObjectID `json:"product_id" bson:"product_id"`
+	RuleID    primitive.ObjectID `json:"rule_id" bson:"rule_id"`
+	Name      string             `json:"name" bson:"name"`
+	Rate      float64            `json:"rate" bson:"rate"`
+	Inclusive bool               `json:"inclusive" bson:"inclusive"`
+	Taxable   Money              `json:"taxable" bson:"taxable"`
+	Amount    Money              `json:"amount" bson:"amount"`
+}
+
+// AddedTax totals the exclusive tax lines, i.e. the tax charged on top of prices
+func AddedTax(lines []TaxLine) Money {
+	var total Money
+	for _, line := range lines {
+		if !line.Inclusive {
+			total = total.Add(line.Amount)
+		}
+	}
+	return total
+}
+
+// Payable is what the customer is charged for the order: its price less discounts
+// plus any tax not already included in the price and shipping
+func (o *Order) Payable() Money {
+	return o.Price.Sub(o.Discount).Add(AddedTax(o.Taxes)).Add(o.ShippingCost())
+}
@@ -0,0 +1,72 @@
+package payments
+
+import (
+	"context"
+	"time"
+
+	"github.com/nerokome/econo/models"
+)
+
+// CashOnDelivery accepts every order and collects the cash when it is delivered.
+// Refunds are paid back by hand, so they only get a reference for the books.
+type CashOnDelivery struct{}
+
+func NewCashOnDelivery() *CashOnDelivery {
+	return &CashOnDelivery{}
+}
+
+func (CashOnDelivery) Name() string {
+	return "cod"
+}
+
+func (p CashOnDelivery) Authorize(ctx context.Context, req AuthorizeRequest) (models.Payment, error) {
+	now := time.Now()
+	return models.Payment{
+		Provider:     p.Name(),
+		Reference:    "cod_" + req.OrderID.Hex(),
+		Status:       models.PaymentAuthorized,
+		Amount:       req.Amount,
+		AuthorizedAt: &now,
+	}, nil
+}
+
+func (CashOnDelivery) Capture(ctx context.Context, payment models.Payment) (models.Payment, error) {
+	return capture(payment)
+}
+
+func (CashOnDelivery) Void(ctx context.Context, payment models.Payment) (models.Payment, error) {
+	return void(payment)
+}
+
+func (CashOnDelivery) Refund(ctx context.Context, payment models.Payment, amount models.Money, key string) (string, error) {
+	if payment.Status != models.PaymentCaptured {
+		return "", ErrNotCaptured
+	}
+	return "cod_refund_" + key, nil
+}
+
+// capture marks an authorized payment as collected; capturing twice is a no-op
+func capture(payment models.Payment) (models.Payment, error) {
+	switch payment.Status {
+	case models.PaymentCaptured:
+		return payment, nil
+	case models.PaymentAuthorized:
+		now := time.Now()
+		payment.Status = models.PaymentCaptured
+		payment.CapturedAt = &now
+		return payment, nil
+	}
+	return payment, ErrNotAuthorized
+}
+
+// void drops an authorization that was never captured; voiding twice is a no-op
+func void(payment models.Payment) (models.Payment, error) {
+	switch payment.Status {
+	case models.PaymentVoided:
+		return payment, nil
+	case models.PaymentAuthorized:
+		payment.Status = models.PaymentVoided
+		return payment, nil
+	}
+	return payment, ErrNotAuthorized
+}
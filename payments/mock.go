@@ -0,0 +1,153 @@
+package payments
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/nerokome/econo/models"
+	"github.com/nerokome/econo/utils"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Test card tokens understood by the mock gateway. Any other token is approved.
+// MockTokenCaptureFails is authorized but fails when the payment is captured.
+const (
+	MockTokenApproved          = "tok_visa"
+	MockTokenDeclined          = "tok_declined"
+	MockTokenInsufficientFunds = "tok_insufficient_funds"
+	MockTokenCaptureFails      = "tok_capture_fails"
+)
+
+// Authorizations that will fail on capture carry this suffix in their reference,
+// which keeps the gateway itself stateless
+const mockCaptureFailsSuffix = "_nocapture"
+
+/*
+MockGateway is an offline card gateway whose answers depend only on the card token,
+so checkout can be exercised end to end without a real processor. By default it
+captures on the spot; once EmitWebhooks is called it confirms captures the way real
+gateways do, with a signed webhook delivered a little later.
+*/
+type MockGateway struct {
+	secret  []byte
+	deliver WebhookDeliverer
+	delay   time.Duration
+}
+
+func NewMockGateway() *MockGateway {
+	return &MockGateway{}
+}
+
+// EmitWebhooks makes captures asynchronous. Each outcome is signed with secret and
+// handed to deliver after delay.
+func (g *MockGateway) EmitWebhooks(secret []byte, deliver WebhookDeliverer, delay time.Duration) {
+	g.secret = secret
+	g.deliver = deliver
+	g.delay = delay
+}
+
+func (g *MockGateway) Name() string {
+	return "mock"
+}
+
+func (g *MockGateway) Authorize(ctx context.Context, req AuthorizeRequest) (models.Payment, error) {
+	if req.Token == "" {
+		return models.Payment{}, ErrPaymentTokenMissing
+	}
+
+	payment := models.Payment{
+		Provider:  g.Name(),
+		Reference: "mock_" + req.OrderID.Hex(),
+		Amount:    req.Amount,
+	}
+
+	switch req.Token {
+	case MockTokenDeclined:
+		payment.Status = models.PaymentFailed
+		payment.FailureReason = "card declined"
+		return payment, ErrPaymentDeclined
+	case MockTokenInsufficientFunds:
+		payment.Status = models.PaymentFailed
+		payment.FailureReason = "insufficient funds"
+		return payment, ErrPaymentDeclined
+	case MockTokenCaptureFails:
+		payment.Reference += mockCaptureFailsSuffix
+	}
+
+	now := time.Now()
+	payment.Status = models.PaymentAuthorized
+	payment.AuthorizedAt = &now
+	return payment, nil
+}
+
+func (g *MockGateway) Capture(ctx context.Context, payment models.Payment) (models.Payment, error) {
+	fails := strings.HasSuffix(payment.Reference, mockCaptureFailsSuffix)
+
+	if g.deliver == nil {
+		if fails && payment.Status == models.PaymentAuthorized {
+			return payment, ErrPaymentDeclined
+		}
+		return capture(payment)
+	}
+
+	if payment.Status != models.PaymentAuthorized {
+		return payment, ErrNotAuthorized
+	}
+	payment.Status = models.PaymentPending
+
+	event := WebhookEvent{
+		ID:        "evt_" + payment.Reference + "_captured",
+		Type:      EventPaymentCaptured,
+		Reference: payment.Reference,
+		Amount:    payment.Amount,
+	}
+	if fails {
+		event.ID = "evt_" + payment.Reference + "_failed"
+		event.Type = EventPaymentFailed
+		event.FailureReason = "capture rejected by issuer"
+	}
+	event.OrderID = mockOrderID(payment.Reference)
+
+	go g.emit(event)
+	return payment, nil
+}
+
+// mockOrderID reads the order ID back out of a reference made by Authorize
+func mockOrderID(reference string) primitive.ObjectID {
+	hex := strings.TrimSuffix(strings.TrimPrefix(reference, "mock_"), mockCaptureFailsSuffix)
+	orderID, _ := primitive.ObjectIDFromHex(hex)
+	return orderID
+}
+
+// emit delivers an event once the delay has passed, as a gateway calling back would
+func (g *MockGateway) emit(event WebhookEvent) {
+	time.Sleep(g.delay)
+	event.CreatedAt = time.Now()
+
+	body, err := json.Marshal(event)
+	if err != nil {
+		log.Println("Mock gateway webhook error:", err)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := g.deliver(ctx, body, utils.SignBody(g.secret, body)); err != nil {
+		log.Println("Mock gateway webhook error:", err)
+	}
+}
+
+func (g *MockGateway) Void(ctx context.Context, payment models.Payment) (models.Payment, error) {
+	return void(payment)
+}
+
+// Refund derives its reference from key, so a retried refund gets the same one back
+func (g *MockGateway) Refund(ctx context.Context, payment models.Payment, amount models.Money, key string) (string, error) {
+	if payment.Status != models.PaymentCaptured {
+		return "", ErrNotCaptured
+	}
+	return "mock_refund_" + key, nil
+}
@@ -0,0 +1,61 @@
+package payments
+
+import (
+	"context"
+	"errors"
+
+	"github.com/nerokome/econo/models"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+var (
+	ErrPaymentDeclined     = errors.New("payment declined")
+	ErrPaymentTokenMissing = errors.New("payment_token is required for card payments")
+	ErrNotAuthorized       = errors.New("payment is not authorized")
+	ErrNotCaptured         = errors.New("payment has not been captured")
+	ErrUnknownPaymentMode  = errors.New("no payment provider for this payment mode")
+)
+
+// AuthorizeRequest asks a provider to hold amount for an order
+type AuthorizeRequest struct {
+	OrderID primitive.ObjectID
+	Amount  models.Money
+	// Token identifies the customer's card with the gateway; cash on delivery ignores it
+	Token string
+}
+
+/*
+PaymentProvider moves money for orders. Authorize holds the amount, Capture collects
+it, Void drops an authorization that was never captured and Refund gives back part or
+all of a captured payment. Each call takes the order's current payment record and
+returns it updated, so providers keep no state of their own.
+*/
+type PaymentProvider interface {
+	Name() string
+	Authorize(ctx context.Context, req AuthorizeRequest) (models.Payment, error)
+	Capture(ctx context.Context, payment models.Payment) (models.Payment, error)
+	Void(ctx context.Context, payment models.Payment) (models.Payment, error)
+	// Refund returns amount of a captured payment and gives back the provider's refund
+	// reference. Calls repeated with the same key pay out only once.
+	Refund(ctx context.Context, payment models.Payment, amount models.Money, key string) (string, error)
+}
+
+// Providers maps each payment mode to the provider that handles it
+type Providers map[string]PaymentProvider
+
+// For returns the provider for a payment mode
+func (p Providers) For(paymentMode string) (PaymentProvider, error) {
+	provider, ok := p[paymentMode]
+	if !ok {
+		return nil, ErrUnknownPaymentMode
+	}
+	return provider, nil
+}
+
+// NewLocalProviders handles cash on delivery and sends card payments to the mock gateway
+func NewLocalProviders() Providers {
+	return Providers{
+		models.PaymentModeCOD:     NewCashOnDelivery(),
+		models.PaymentModeDigital: NewMockGateway(),
+	}
+}
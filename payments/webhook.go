@@ -0,0 +1,43 @@
+package payments
+
+import (
+	"context"
+	"errors"
+	"os"
+	"time"
+
+	"github.com/nerokome/econo/models"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// SignatureHeader carries the utils.SignBody signature of the body the gateway posts
+const SignatureHeader = "X-Payment-Signature"
+
+// Webhook event types
+const (
+	EventPaymentCaptured = "payment.captured"
+	EventPaymentFailed   = "payment.failed"
+)
+
+// WebhookEvent is what a gateway posts to tell us how a payment turned out
+type WebhookEvent struct {
+	ID            string             `json:"id"`
+	Type          string             `json:"type"`
+	OrderID       primitive.ObjectID `json:"order_id"`
+	Reference     string             `json:"reference"`
+	Amount        models.Money       `json:"amount"`
+	FailureReason string             `json:"failure_reason,omitempty"`
+	CreatedAt     time.Time          `json:"created_at"`
+}
+
+// WebhookDeliverer hands a signed webhook body to whatever processes it
+type WebhookDeliverer func(ctx context.Context, body []byte, signature string) error
+
+// WebhookSecret returns the key shared with the gateway for signing webhooks
+func WebhookSecret() ([]byte, error) {
+	secret := os.Getenv("PAYMENT_WEBHOOK_SECRET")
+	if secret == "" {
+		return nil, errors.New("PAYMENT_WEBHOOK_SECRET not set")
+	}
+	return []byte(secret), nil
+}
@@ -4,29 +4,59 @@ import (
 	"github.com/gin-gonic/gin"
 	"github.com/nerokome/econo/controllers"
 	"github.com/nerokome/econo/middleware"
+	"github.com/nerokome/econo/models"
 )
 
 // UserRoutes registers all routes for the app
 func UserRoutes(router *gin.Engine, app *controllers.Application) {
 
+	// Lets clients safely retry cart changes, checkouts, cancellations and refunds
+	idempotent := middleware.Idempotency(app.Idempotency)
+
 	// Public routes 
 	public := router.Group("/api")
 	{
 		public.POST("/users/signup", app.SignUp())
 		public.POST("/users/login", app.Login())
+		public.POST("/users/refresh", app.RefreshToken())
 		public.GET("/users/productview", app.SearchProduct())
 		public.GET("/users/search", app.SearchProductByQuery())
+
+		// Signed by the payment gateway instead of carrying a token
+		public.POST("/webhooks/payments", app.PaymentWebhook())
+		// Signed by carriers in the same way
+		public.POST("/webhooks/carriers", app.CarrierWebhook())
 	}
 
 	// Protected routes 
 	protected := router.Group("/api")
-	protected.Use(middleware.Authenticate())
+	protected.Use(middleware.Authenticate(app.Tokens))
 	{
 		// Cart
-		protected.POST("/cart/add", app.AddToCart())
+		protected.POST("/cart/add", idempotent, app.AddToCart())
 		protected.GET("/cart/items", app.GetItemFromCart())
-		protected.POST("/cart/buy", app.BuyFromCart())
-		protected.POST("/cart/instantbuy", app.InstantBuy())
+		protected.GET("/cart/shipping", app.GetShippingOptions())
+		protected.PUT("/cart/items/:product_id", idempotent, app.SetCartItemQuantity())
+		protected.POST("/cart/items/:product_id/increment", idempotent, app.IncrementCartItem())
+		protected.POST("/cart/items/:product_id/decrement", idempotent, app.DecrementCartItem())
+		protected.DELETE("/cart/items/:product_id", idempotent, app.RemoveItem())
+		protected.DELETE("/cart", idempotent, app.ClearCart())
+		protected.PUT("/cart/coupon", idempotent, app.ApplyCartCoupon())
+		protected.DELETE("/cart/coupon", idempotent, app.RemoveCartCoupon())
+		protected.POST("/cart/buy", idempotent, app.BuyFromCart())
+		protected.POST("/cart/instantbuy", idempotent, app.InstantBuy())
+
+		// Orders
+		protected.GET("/orders", app.ListOrders())
+		protected.GET("/orders/:order_id", app.GetOrder())
+		protected.GET("/orders/:order_id/status", app.GetOrderStatus())
+		protected.GET("/orders/:order_id/shipments", app.GetOrderShipments())
+		protected.POST("/orders/:order_id/cancel", idempotent, app.CancelOrder())
+
+		// Session
+		protected.POST("/users/logout", app.Logout())
+		protected.POST("/users/logout-all", app.LogoutAll())
+		protected.POST("/users/bootstrap-admin", app.BootstrapAdmin())
 
 		// Address
 		protected.POST("/address", app.AddAddress())
@@ -36,10 +66,56 @@ func UserRoutes(router *gin.Engine, app *controllers.Application) {
 
 	// Admin routes
 	admin := router.Group("/admin")
-	admin.Use(middleware.Authenticate())
-	
+	admin.Use(
+		middleware.Authenticate(app.Tokens),
+		middleware.RequireRole(models.RoleAdmin, models.RoleStaff),
+	)
 	{
-		admin.POST("/addproducts", app.ProductViewerAdmin())
+		// Products
+		admin.GET("/products", app.ListProductsAdmin())
+		admin.POST("/products", app.CreateProduct())
+		admin.POST("/addproducts", app.CreateProduct())
+		admin.PATCH("/products/:product_id", app.UpdateProduct())
+		admin.DELETE("/products/:product_id", app.DeleteProduct())
+		admin.POST("/products/:product_id/restore", app.RestoreProduct())
+
+		// Coupons
+		admin.GET("/coupons", app.ListCoupons())
+		admin.POST("/coupons", app.CreateCoupon())
+		admin.PATCH("/coupons/:coupon_id", app.UpdateCoupon())
+
+		// Taxes
+		admin.GET("/tax-rules", app.ListTaxRules())
+		admin.POST("/tax-rules", app.CreateTaxRule())
+		admin.PATCH("/tax-rules/:rule_id", app.UpdateTaxRule())
+		admin.DELETE("/tax-rules/:rule_id", app.DeleteTaxRule())
 
+		// Shipping
+		admin.GET("/shipping-rates", app.ListShippingRates())
+		admin.POST("/shipping-rates", app.CreateShippingRate())
+		admin.PATCH("/shipping-rates/:rate_id", app.UpdateShippingRate())
+		admin.DELETE("/shipping-rates/:rate_id", app.DeleteShippingRate())
+
+		// Exchange rates
+		admin.GET("/exchange-rates", app.ListExchangeRates())
+		admin.POST("/exchange-rates", app.CreateExchangeRate())
+		admin.DELETE("/exchange-rates/:rate_id", app.DeleteExchangeRate())
+
+		// Orders
+		admin.PATCH("/orders/:order_id/status", app.UpdateOrderStatus())
+		admin.POST("/orders/:order_id/refunds", idempotent, app.RefundOrderLines())
+
+		// Shipments
+		admin.GET("/orders/:order_id/shipments", app.ListOrderShipmentsAdmin())
+		admin.POST("/orders/:order_id/shipments", idempotent, app.CreateShipment())
+		admin.POST("/shipments/:shipment_id/events", app.AddTrackingEvent())
+	}
+
+	// Role management is reserved for admins
+	roles := admin.Group("/users")
+	roles.Use(middleware.RequireRole(models.RoleAdmin))
+	{
+		roles.PUT("/:user_id/role", app.GrantRole())
+		roles.DELETE("/:user_id/role", app.RevokeRole())
 	}
 }
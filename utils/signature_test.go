@@ -0,0 +1,32 @@
+package utils
+
+import "testing"
+
+func TestVerifyBody(t *testing.T) {
+	secret := []byte("secret")
+	body := []byte(`{"id":"evt_1","type":"payment.captured"}`)
+	signature := SignBody(secret, body)
+
+	tests := []struct {
+		name      string
+		secret    []byte
+		body      []byte
+		signature string
+		want      bool
+	}{
+		{name: "signed body", secret: secret, body: body, signature: signature, want: true},
+		{name: "body changed", secret: secret, body: []byte(`{"id":"evt_1","type":"payment.failed"}`), signature: signature},
+		{name: "signed with another secret", secret: []byte("other"), body: body, signature: signature},
+		{name: "missing signature", secret: secret, body: body},
+		{name: "not hex", secret: secret, body: body, signature: "zz" + signature[2:]},
+		{name: "truncated", secret: secret, body: body, signature: signature[:len(signature)-2]},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := VerifyBody(tt.secret, tt.body, tt.signature); got != tt.want {
+				t.Errorf("VerifyBody = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
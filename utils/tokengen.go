@@ -2,24 +2,93 @@ package utils
 
 import (
 	"errors"
+	"math"
 	"os"
+	"time"
 
 	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+)
+
+const (
+	AccessTokenTTL  = 15 * time.Minute
+	RefreshTokenTTL = 30 * 24 * time.Hour
+
+	TokenTypeAccess  = "access"
+	TokenTypeRefresh = "refresh"
 )
 
 var ErrInvalidToken = errors.New("invalid token")
 
-func ValidateToken(tokenString string) (jwt.MapClaims, error) {
+func jwtSecret() ([]byte, error) {
 	secret := os.Getenv("JWT_SECRET")
 	if secret == "" {
 		return nil, errors.New("JWT_SECRET not set")
 	}
+	return []byte(secret), nil
+}
+
+func signToken(claims jwt.MapClaims) (string, error) {
+	secret, err := jwtSecret()
+	if err != nil {
+		return "", err
+	}
+	return jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(secret)
+}
+
+// NewTokenFamily returns an ID shared by every token pair descended from one login
+func NewTokenFamily() string {
+	return uuid.NewString()
+}
+
+// GenerateTokens mints a short-lived access token and a long-lived refresh token for a user.
+// Both tokens carry the family ID so a compromised session can be revoked as a whole.
+func GenerateTokens(userID, email, role, family string) (accessToken string, refreshToken string, err error) {
+	now := time.Now()
+	// In microseconds, so a login right after ending every session isn't caught by the cutoff
+	issuedAt := float64(now.UnixMicro()) / 1e6
+
+	accessToken, err = signToken(jwt.MapClaims{
+		"jti":        uuid.NewString(),
+		"user_id":    userID,
+		"email":      email,
+		"role":       role,
+		"family":     family,
+		"token_type": TokenTypeAccess,
+		"iat":        issuedAt,
+		"exp":        now.Add(AccessTokenTTL).Unix(),
+	})
+	if err != nil {
+		return "", "", err
+	}
+
+	refreshToken, err = signToken(jwt.MapClaims{
+		"jti":        uuid.NewString(),
+		"user_id":    userID,
+		"email":      email,
+		"family":     family,
+		"token_type": TokenTypeRefresh,
+		"iat":        issuedAt,
+		"exp":        now.Add(RefreshTokenTTL).Unix(),
+	})
+	if err != nil {
+		return "", "", err
+	}
+
+	return accessToken, refreshToken, nil
+}
+
+func ValidateToken(tokenString string) (jwt.MapClaims, error) {
+	secret, err := jwtSecret()
+	if err != nil {
+		return nil, err
+	}
 
 	token, err := jwt.Parse(tokenString, func(t *jwt.Token) (interface{}, error) {
 		if _, ok := t.Method.(*jwt.SigningMethodHMAC); !ok {
 			return nil, ErrInvalidToken
 		}
-		return []byte(secret), nil
+		return secret, nil
 	})
 
 	if err != nil || !token.Valid {
@@ -33,3 +102,32 @@ func ValidateToken(tokenString string) (jwt.MapClaims, error) {
 
 	return claims, nil
 }
+
+// UnverifiedClaims decodes a token we issued earlier without checking its
+// signature or expiry. Only use it on tokens loaded from our own store.
+func UnverifiedClaims(tokenString string) jwt.MapClaims {
+	claims := jwt.MapClaims{}
+	if _, _, err := jwt.NewParser().ParseUnverified(tokenString, claims); err != nil {
+		return nil
+	}
+	return claims
+}
+
+// TokenIssuedAt returns the iat claim to the microsecond, or the zero time if it is missing
+func TokenIssuedAt(claims jwt.MapClaims) time.Time {
+	// GetIssuedAt would round the fraction away to jwt.TimePrecision
+	iat, ok := claims["iat"].(float64)
+	if !ok {
+		return time.Time{}
+	}
+	return time.UnixMicro(int64(math.Round(iat * 1e6)))
+}
+
+// TokenExpiry returns the exp claim, or a refresh-token lifetime from now if it is missing
+func TokenExpiry(claims jwt.MapClaims) time.Time {
+	exp, err := claims.GetExpirationTime()
+	if err != nil || exp == nil {
+		return time.Now().Add(RefreshTokenTTL)
+	}
+	return exp.Time
+}
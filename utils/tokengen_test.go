@@ -0,0 +1,105 @@
+package utils
+
+import (
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func TestGenerateTokens(t *testing.T) {
+	t.Setenv("JWT_SECRET", "secret")
+
+	before := time.Now().Truncate(time.Microsecond)
+	access, refresh, err := GenerateTokens("user", "a@example.com", "admin", "family")
+	if err != nil {
+		t.Fatalf("generate: %v", err)
+	}
+	after := time.Now()
+
+	tests := []struct {
+		name     string
+		token    string
+		wantType string
+		wantTTL  time.Duration
+		wantRole string
+	}{
+		{name: "access token", token: access, wantType: TokenTypeAccess, wantTTL: AccessTokenTTL, wantRole: "admin"},
+		{name: "refresh token", token: refresh, wantType: TokenTypeRefresh, wantTTL: RefreshTokenTTL},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			claims, err := ValidateToken(tt.token)
+			if err != nil {
+				t.Fatalf("validate: %v", err)
+			}
+			if got, _ := claims["token_type"].(string); got != tt.wantType {
+				t.Errorf("token type = %q, want %q", got, tt.wantType)
+			}
+			if got, _ := claims["family"].(string); got != "family" {
+				t.Errorf("family = %q, want %q", got, "family")
+			}
+			// Only the access token is used for authorization, so only it carries the role
+			if got, _ := claims["role"].(string); got != tt.wantRole {
+				t.Errorf("role = %q, want %q", got, tt.wantRole)
+			}
+			// iat keeps microseconds, so a cutoff in the same second can tell tokens apart
+			issuedAt := TokenIssuedAt(claims)
+			if issuedAt.Before(before) || issuedAt.After(after) {
+				t.Errorf("issued at %v, want between %v and %v", issuedAt, before, after)
+			}
+			if ttl := TokenExpiry(claims).Sub(issuedAt); ttl <= tt.wantTTL-time.Second || ttl > tt.wantTTL {
+				t.Errorf("lifetime = %v, want %v", ttl, tt.wantTTL)
+			}
+		})
+	}
+
+	if a, r := UnverifiedClaims(access), UnverifiedClaims(refresh); a["jti"] == r["jti"] {
+		t.Error("access and refresh tokens share a jti")
+	}
+}
+
+func TestValidateToken(t *testing.T) {
+	t.Setenv("JWT_SECRET", "secret")
+	now := time.Now()
+
+	expired, err := signToken(jwt.MapClaims{
+		"user_id": "user",
+		"iat":     now.Add(-2 * AccessTokenTTL).Unix(),
+		"exp":     now.Add(-AccessTokenTTL).Unix(),
+	})
+	if err != nil {
+		t.Fatalf("sign: %v", err)
+	}
+	forged, err := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"user_id": "user",
+		"exp":     now.Add(AccessTokenTTL).Unix(),
+	}).SignedString([]byte("other secret"))
+	if err != nil {
+		t.Fatalf("sign: %v", err)
+	}
+	valid, _, err := GenerateTokens("user", "a@example.com", "customer", "family")
+	if err != nil {
+		t.Fatalf("generate: %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		token   string
+		wantErr error
+	}{
+		{name: "valid", token: valid},
+		{name: "expired", token: expired, wantErr: ErrInvalidToken},
+		{name: "signed with another secret", token: forged, wantErr: ErrInvalidToken},
+		{name: "not a token", token: "garbage", wantErr: ErrInvalidToken},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := ValidateToken(tt.token); err != tt.wantErr {
+				t.Errorf("err = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}